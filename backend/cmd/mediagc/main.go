@@ -0,0 +1,79 @@
+// Command mediagc reports stored media that no database row references.
+// By default it only reports; -delete removes the orphans, exactly as the
+// server's background collector does. It reads the server's configuration
+// (-config, -db, environment).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"social-network/backend/internal/config"
+	"social-network/backend/internal/db"
+	"social-network/backend/internal/services"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	fs := flag.NewFlagSet("mediagc", flag.ContinueOnError)
+	del := fs.Bool("delete", false, "delete the orphans instead of only reporting them")
+	grace := fs.Duration("grace", 0, "grace period (overrides uploads.orphan_grace_period)")
+	cfg, err := config.LoadFlags(fs, os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if *grace > 0 {
+		cfg.Uploads.OrphanGracePeriod = *grace
+	}
+
+	database, err := db.OpenSQLite(cfg.Database.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer database.Close()
+
+	cloudinarySvc, _ := services.NewCloudinaryService(&cfg.Cloudinary)
+	localStore, err := services.NewLocalStore(cfg.Uploads.LocalDir, "/images/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := services.SelectMediaStore(cfg.Uploads.Backend, cloudinarySvc, localStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gc := &services.MediaGC{DB: database, Store: store, GracePeriod: cfg.Uploads.OrphanGracePeriod}
+	report, err := gc.Reconcile(context.Background(), !*del)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mode := "dry run"
+	if !report.DryRun {
+		mode = "deleting"
+	}
+	fmt.Printf("media store %s (%s, grace period %s)\n", report.Storage, mode, gc.GracePeriod)
+	fmt.Printf("  scanned:             %d objects\n", report.Scanned)
+	fmt.Printf("  orphans:             %d (%d bytes)\n", len(report.Orphans), report.OrphanBytes)
+	for _, o := range report.Orphans {
+		fmt.Printf("    %s  %d bytes  %s old\n", o.Key, o.Bytes, time.Since(o.ModTime).Round(time.Second))
+	}
+	fmt.Printf("  expired attachments: %d\n", report.ExpiredAttachments)
+	fmt.Printf("  stale variant rows:  %d\n", report.StaleVariants)
+	if len(report.Missing) > 0 {
+		fmt.Printf("  missing from store:  %d\n", len(report.Missing))
+		for _, k := range report.Missing {
+			fmt.Printf("    %s\n", k)
+		}
+	}
+	if !report.DryRun {
+		fmt.Printf("  deleted:             %d\n", report.Deleted)
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	_ "time/tzdata" // event time zones without the system zone database
 
+	"social-network/backend/internal/config"
 	"social-network/backend/internal/db"
 	customhttp "social-network/backend/internal/http"
+	"social-network/backend/internal/services"
 
 	"github.com/joho/godotenv"
 )
@@ -18,25 +21,39 @@ func main() {
 		log.Printf("Warning: Error loading .env file: %v", err)
 	}
 
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	log.Print(cfg.Redacted())
+
 	// Open DB
-	database, err := db.OpenSQLite()
+	database, err := db.OpenSQLite(cfg.Database.Path)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer database.Close()
 
 	// Apply migrations
-	migrationsDir := filepath.Join("internal", "db", "migrations", "sqlite")
-	if envDir := os.Getenv("MIGRATIONS_DIR"); envDir != "" {
-		migrationsDir = envDir
-	}
-	if err := db.ApplyMigrations(database, migrationsDir); err != nil {
+	if err := db.ApplyMigrations(database, cfg.Database.MigrationsDir); err != nil {
 		log.Fatal(err)
 	}
 
-	h := customhttp.NewRouter(database)
-	log.Println("server starting on :8080")
-	if err := http.ListenAndServe(":8080", h); err != nil {
+	if cfg.Admin.Email != "" {
+		seeded, err := services.SeedAdmin(database, cfg.Admin.Email, cfg.Admin.Password)
+		switch {
+		case errors.Is(err, services.ErrAdminEmailTaken):
+			log.Printf("seed admin: %v", err)
+		case err != nil:
+			log.Fatalf("seed admin: %v", err)
+		case seeded:
+			log.Printf("created site admin %s", cfg.Admin.Email)
+		}
+	}
+
+	h := customhttp.NewRouter(database, cfg)
+	log.Printf("server starting on %s", cfg.Server.Addr)
+	if err := http.ListenAndServe(cfg.Server.Addr, h); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -5,16 +5,18 @@ go 1.24.5
 require github.com/go-chi/chi/v5 v5.2.3
 
 require (
+	github.com/cloudinary/cloudinary-go/v2 v2.13.0
+	github.com/go-chi/cors v1.2.2
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.32
 	golang.org/x/crypto v0.42.0
+	golang.org/x/image v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/cloudinary/cloudinary-go/v2 v2.13.0 // indirect
 	github.com/creasty/defaults v1.7.0 // indirect
-	github.com/go-chi/cors v1.2.2 // indirect
 	github.com/gorilla/schema v1.4.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 )
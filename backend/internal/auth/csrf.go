@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Double-submit CSRF protection: the token lives in a cookie readable by the
+// frontend, which echoes it back in the X-CSRF-Token header on every
+// state-changing request. A cross-site page can make the browser send the
+// cookie but cannot read it to fill in the header.
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueCSRFToken returns the current CSRF token for the request, creating and
+// setting a new cookie if none is present.
+func IssueCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(CSRFCookieName); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: false, // must be readable by the frontend
+		Secure:   IsSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(7 * 24 * time.Hour),
+	})
+	return token, nil
+}
+
+// IsSecureRequest reports whether the request reached us over TLS, either
+// directly or through a TLS-terminating proxy.
+func IsSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFProtect is middleware that rejects state-changing requests unless the
+// X-CSRF-Token header matches the csrf_token cookie. When the browser sends
+// an Origin (or Referer) header it must also be one of the allowed origins.
+// Requests authenticated with a bearer token carry no ambient credentials and
+// are exempt.
+func CSRFProtect(originAllowed func(origin string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, bearer := bearerToken(r); isSafeMethod(r.Method) || bearer {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if origin := requestOrigin(r); origin != "" && !originAllowed(origin) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			cookie, err := r.Cookie(CSRFCookieName)
+			header := r.Header.Get(CSRFHeaderName)
+			if err != nil || cookie.Value == "" || header == "" ||
+				subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+				http.Error(w, "invalid csrf token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestOrigin returns the scheme://host the request claims to come from,
+// preferring Origin and falling back to Referer.
+func requestOrigin(r *http.Request) string {
+	if o := r.Header.Get("Origin"); o != "" && o != "null" {
+		return o
+	}
+	if ref := r.Header.Get("Referer"); ref != "" {
+		if u, err := url.Parse(ref); err == nil && u.Scheme != "" && u.Host != "" {
+			return u.Scheme + "://" + u.Host
+		}
+	}
+	return ""
+}
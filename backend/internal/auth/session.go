@@ -16,9 +16,47 @@ type Session struct {
 	ID        string
 	UserID    string
 	ExpiresAt time.Time
+
+	// The user's site role and whether their account is suspended, as of
+	// the request.
+	Role      string
+	Suspended bool
+
+	// Set when the request authenticated with a personal access token
+	// instead of the session cookie.
+	TokenID string
+	Scopes  []string
+}
+
+// IsToken reports whether the session comes from a personal access token.
+func (s *Session) IsToken() bool { return s.TokenID != "" }
+
+// HasScope reports whether the session may act with the given scope. Cookie
+// sessions are unrestricted.
+func (s *Session) HasScope(scope string) bool {
+	if !s.IsToken() {
+		return true
+	}
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
 }
 
+// ErrSuspended is returned by CreateSession for suspended accounts.
+var ErrSuspended = errors.New("account suspended")
+
 func CreateSession(db *sql.DB, userID string, ttl time.Duration, ua, ip string) (*Session, error) {
+	var role string
+	var suspended bool
+	if err := db.QueryRow("SELECT role, suspended_at IS NOT NULL FROM users WHERE id = ?", userID).Scan(&role, &suspended); err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, ErrSuspended
+	}
 	id := uuid.NewString()
 	expires := time.Now().Add(ttl)
 	_, err := db.Exec(
@@ -28,7 +66,7 @@ func CreateSession(db *sql.DB, userID string, ttl time.Duration, ua, ip string)
 	if err != nil {
 		return nil, err
 	}
-	return &Session{ID: id, UserID: userID, ExpiresAt: expires}, nil
+	return &Session{ID: id, UserID: userID, ExpiresAt: expires, Role: role}, nil
 }
 
 func DeleteSession(db *sql.DB, id string) error {
@@ -39,7 +77,8 @@ func DeleteSession(db *sql.DB, id string) error {
 func GetSession(db *sql.DB, id string) (*Session, error) {
 	var s Session
 	var expires string
-	err := db.QueryRow("SELECT id, user_id, expires_at FROM sessions WHERE id = ?", id).Scan(&s.ID, &s.UserID, &expires)
+	err := db.QueryRow(`SELECT s.id, s.user_id, s.expires_at, u.role, u.suspended_at IS NOT NULL
+		FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = ?`, id).Scan(&s.ID, &s.UserID, &expires, &s.Role, &s.Suspended)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +116,23 @@ func SessionFromContext(r *http.Request) (*Session, bool) {
 
 func RequireAuth(next http.Handler, dbConn *sql.DB) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			sess, err := sessionFromToken(dbConn, token)
+			if err != nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if sess.Suspended {
+				http.Error(w, "account suspended", http.StatusForbidden)
+				return
+			}
+			if !sess.HasScope(requiredScope(r)) {
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, WithSession(r, sess))
+			return
+		}
 		cookie, err := r.Cookie(SessionCookieName)
 		if err != nil || cookie.Value == "" {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -87,28 +143,34 @@ func RequireAuth(next http.Handler, dbConn *sql.DB) http.Handler {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if sess.Suspended {
+			http.Error(w, "account suspended", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, WithSession(r, sess))
 	})
 }
 
-func SetSessionCookie(w http.ResponseWriter, s *Session) {
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, s *Session) {
 	cookie := &http.Cookie{
 		Name:     SessionCookieName,
 		Value:    s.ID,
 		Path:     "/",
 		HttpOnly: true,
+		Secure:   IsSecureRequest(r),
 		SameSite: http.SameSiteLaxMode,
 		Expires:  s.ExpiresAt,
 	}
 	http.SetCookie(w, cookie)
 }
 
-func ClearSessionCookie(w http.ResponseWriter) {
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
 	cookie := &http.Cookie{
 		Name:     SessionCookieName,
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
+		Secure:   IsSecureRequest(r),
 		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Unix(0, 0),
 	}
@@ -117,16 +179,75 @@ func ClearSessionCookie(w http.ResponseWriter) {
 
 var ErrUnauthorized = errors.New("unauthorized")
 
+// Site roles, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 1, RoleModerator: 2, RoleAdmin: 3}
+
+// HasRole reports whether the session's user holds role or a higher one.
+func (s *Session) HasRole(role string) bool {
+	return roleRank[s.Role] >= roleRank[role] && roleRank[role] > 0
+}
+
+// RoleOutranks reports whether role a is higher than role b.
+func RoleOutranks(a, b string) bool {
+	return roleRank[a] > roleRank[b]
+}
+
+// RequireRole is middleware, to be used after RequireAuth, that refuses
+// users without at least the given site role.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess, ok := SessionFromContext(r)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !sess.HasRole(role) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectTokens is middleware that refuses personal access tokens, for routes
+// only a signed-in session may use.
+func RejectTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := SessionFromContext(r); ok && sess.IsToken() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // LoadSession is middleware that tries to load a session from the request cookie
-// and attaches it to the request context if valid. Use this for routes that
-// need to know the current viewer but aren't strictly protected.
+// (or a bearer token) and attaches it to the request context if valid. Use this
+// for routes that need to know the current viewer but aren't strictly protected.
 func LoadSession(db *sql.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := bearerToken(r); ok {
+				// never fall back to the cookie when a token was presented
+				if sess, err := sessionFromToken(db, token); err == nil && !sess.Suspended && sess.HasScope(requiredScope(r)) {
+					next.ServeHTTP(w, WithSession(r, sess))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
 			cookie, err := r.Cookie(SessionCookieName)
 			if err == nil && cookie.Value != "" {
 				sess, err := GetSession(db, cookie.Value)
-				if err == nil && sess.ExpiresAt.After(time.Now()) {
+				if err == nil && !sess.Suspended && sess.ExpiresAt.After(time.Now()) {
 					next.ServeHTTP(w, WithSession(r, sess))
 					return
 				}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRejectTokens(t *testing.T) {
+	h := RejectTokens(RequireRole(RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	for _, tt := range []struct {
+		name string
+		sess *Session
+		want int
+	}{
+		{"cookie session", &Session{UserID: "a", Role: RoleAdmin}, http.StatusOK},
+		{"write token", &Session{UserID: "a", Role: RoleAdmin, TokenID: "t", Scopes: []string{ScopeRead, ScopeWrite}}, http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, WithSession(httptest.NewRequest(http.MethodGet, "/api/admin/users", nil), tt.sess))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
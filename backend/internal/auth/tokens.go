@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Personal access tokens let scripts and bots call the API with an
+// "Authorization: Bearer <token>" header instead of the sid cookie. Only a
+// SHA-256 hash of the token is stored.
+
+const accessTokenPrefix = "snpat_"
+
+// Token scopes.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeChat  = "chat"
+)
+
+var validScopes = map[string]bool{ScopeRead: true, ScopeWrite: true, ScopeChat: true}
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+type AccessToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HashAccessToken returns the stored form of a plaintext token.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAccessToken stores a new token and returns it together with the
+// plaintext value, which is never retrievable again. A zero ttl means the
+// token does not expire.
+func CreateAccessToken(db *sql.DB, userID, name string, scopes []string, ttl time.Duration) (*AccessToken, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !validScopes[s] {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	plain := accessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t := &AccessToken{ID: uuid.NewString(), UserID: userID, Name: name, Scopes: scopes, CreatedAt: time.Now()}
+	var expires sql.NullTime
+	if ttl > 0 {
+		e := time.Now().Add(ttl)
+		t.ExpiresAt = &e
+		expires = sql.NullTime{Time: e, Valid: true}
+	}
+	_, err := db.Exec(
+		"INSERT INTO personal_access_tokens(id, user_id, name, token_hash, scopes, expires_at, created_at) VALUES(?,?,?,?,?,?,?)",
+		t.ID, userID, name, HashAccessToken(plain), strings.Join(scopes, ","), expires, t.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, plain, nil
+}
+
+// ListAccessTokens returns the user's tokens, newest first.
+func ListAccessTokens(db *sql.DB, userID string) ([]AccessToken, error) {
+	rows, err := db.Query(`SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// DeleteAccessToken revokes one of the user's tokens.
+func DeleteAccessToken(db *sql.DB, userID, id string) (bool, error) {
+	res, err := db.Exec("DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// LookupAccessToken resolves a plaintext token, rejecting expired ones, and
+// records the time it was used.
+func LookupAccessToken(db *sql.DB, plain string) (*AccessToken, error) {
+	if !strings.HasPrefix(plain, accessTokenPrefix) {
+		return nil, ErrUnauthorized
+	}
+	row := db.QueryRow(`SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens WHERE token_hash = ?`, HashAccessToken(plain))
+	t, err := scanAccessToken(row)
+	if err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now()) {
+		return nil, ErrUnauthorized
+	}
+	now := time.Now()
+	_, _ = db.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?", now, t.ID)
+	t.LastUsedAt = &now
+	return t, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccessToken(row rowScanner) (*AccessToken, error) {
+	var t AccessToken
+	var scopes string
+	var expires, lastUsed sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &expires, &lastUsed, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	if expires.Valid {
+		t.ExpiresAt = &expires.Time
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = &lastUsed.Time
+	}
+	return &t, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// requiredScope maps a request to the scope a token needs to make it: chat
+// endpoints need "chat", other reads need "read" and everything else "write".
+func requiredScope(r *http.Request) string {
+	p := r.URL.Path
+	if p == "/ws" || strings.HasPrefix(p, "/api/chat/") {
+		return ScopeChat
+	}
+	if isSafeMethod(r.Method) {
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// sessionFromToken turns a bearer token into a request session.
+func sessionFromToken(db *sql.DB, plain string) (*Session, error) {
+	t, err := LookupAccessToken(db, plain)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{UserID: t.UserID, TokenID: t.ID, Scopes: t.Scopes}
+	if err := db.QueryRow("SELECT role, suspended_at IS NOT NULL FROM users WHERE id = ?", t.UserID).Scan(&s.Role, &s.Suspended); err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt != nil {
+		s.ExpiresAt = *t.ExpiresAt
+	}
+	return s, nil
+}
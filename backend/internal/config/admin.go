@@ -0,0 +1,14 @@
+package config
+
+// AdminConfig seeds the first site administrator. At startup, while no user
+// has the admin role, an admin account is created with Email and Password.
+// An existing account with Email is never promoted.
+type AdminConfig struct {
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
+func (c *AdminConfig) applyEnv() {
+	setString(&c.Email, "ADMIN_EMAIL")
+	setString(&c.Password, "ADMIN_PASSWORD")
+}
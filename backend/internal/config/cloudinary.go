@@ -1,42 +1,36 @@
 package config
 
-import (
-	"fmt"
-	"os"
-)
-
 type CloudinaryConfig struct {
-	CloudName   string
-	APIKey      string
-	APISecret   string
-	Environment string
+	CloudName string `yaml:"cloud_name"`
+	APIKey    string `yaml:"api_key"`
+	APISecret string `yaml:"api_secret"`
+	// Names the folder (social-network/<environment>/) this instance
+	// uploads to and collects from. Instances sharing an account need
+	// different names.
+	Environment string `yaml:"environment"`
 }
 
-func LoadCloudinaryConfig() *CloudinaryConfig {
-	config := &CloudinaryConfig{
-		CloudName:   getEnv("CLOUDINARY_CLOUD_NAME", ""),
-		APIKey:      getEnv("CLOUDINARY_API_KEY", ""),
-		APISecret:   getEnv("CLOUDINARY_API_SECRET", ""),
-		Environment: getEnv("CLOUDINARY_ENVIRONMENT", "production"),
-	}
-
-	// Debug logging
-	if config.CloudName == "" {
-		fmt.Println("Warning: CLOUDINARY_CLOUD_NAME not set")
-	}
-	if config.APIKey == "" {
-		fmt.Println("Warning: CLOUDINARY_API_KEY not set")
-	}
-	if config.APISecret == "" {
-		fmt.Println("Warning: CLOUDINARY_API_SECRET not set")
-	}
+func (c *CloudinaryConfig) applyEnv() {
+	setString(&c.CloudName, "CLOUDINARY_CLOUD_NAME")
+	setString(&c.APIKey, "CLOUDINARY_API_KEY")
+	setString(&c.APISecret, "CLOUDINARY_API_SECRET")
+	setString(&c.Environment, "CLOUDINARY_ENVIRONMENT")
+}
 
-	return config
+// Configured reports whether Cloudinary credentials were provided.
+func (c *CloudinaryConfig) Configured() bool {
+	return c.CloudName != "" && c.APIKey != "" && c.APISecret != ""
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// validFolderName reports whether s can be used as one folder of a public ID.
+func validFolderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
 	}
-	return defaultValue
+	return true
 }
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration. It is built from defaults,
+// then an optional YAML file, then environment variables, then command-line
+// flags, each layer overriding the previous one.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Session    SessionConfig    `yaml:"session"`
+	Uploads    UploadsConfig    `yaml:"uploads"`
+	Accounts   AccountsConfig   `yaml:"accounts"`
+	Events     EventsConfig     `yaml:"events"`
+	Security   SecurityConfig   `yaml:"security"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Cloudinary CloudinaryConfig `yaml:"cloudinary"`
+	OIDC       OIDCConfig       `yaml:"oidc"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type DatabaseConfig struct {
+	Path          string `yaml:"path"`
+	MigrationsDir string `yaml:"migrations_dir"`
+}
+
+type SessionConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type UploadsConfig struct {
+	// Media backend: "auto" (Cloudinary when configured, else local),
+	// "cloudinary" or "local".
+	Backend string `yaml:"backend"`
+	// Largest accepted multipart upload, in bytes.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Largest accepted image, in pixels (width*height), checked before
+	// decoding so small files can't expand into huge bitmaps.
+	MaxPixels int `yaml:"max_pixels"`
+	// Most images a single post may be created with.
+	MaxPostImages int `yaml:"max_post_images"`
+	// Directory for locally stored media (served under /images/).
+	LocalDir string `yaml:"local_dir"`
+	// How often stored media that nothing references is collected; 0
+	// disables the collector.
+	GCInterval time.Duration `yaml:"gc_interval"`
+	// How old an unreferenced object (or unclaimed attachment) must be
+	// before it is collected.
+	OrphanGracePeriod time.Duration `yaml:"orphan_grace_period"`
+	// Whether the collector may delete from a remote store (Cloudinary).
+	// Off by default: the collector then only logs what it would remove,
+	// since another instance sharing the account may own those objects.
+	GCRemote bool `yaml:"gc_remote"`
+}
+
+type AccountsConfig struct {
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Addr: ":8080"},
+		Database: DatabaseConfig{Path: "./data/app.db", MigrationsDir: "internal/db/migrations/sqlite"},
+		Session:  SessionConfig{TTL: 7 * 24 * time.Hour},
+		Uploads: UploadsConfig{
+			Backend: "auto", MaxBytes: 10 << 20, MaxPixels: 40_000_000, MaxPostImages: 4, LocalDir: "internal/images",
+			GCInterval: 6 * time.Hour, OrphanGracePeriod: 24 * time.Hour,
+		},
+		Accounts: AccountsConfig{DeletionGracePeriod: 14 * 24 * time.Hour},
+		Events:   EventsConfig{ReminderOffsets: []time.Duration{24 * time.Hour, time.Hour}, ReminderInterval: time.Minute},
+		Security: SecurityConfig{AllowedOrigins: []string{"http://localhost:5173", "http://127.0.0.1:5173"}},
+		Cloudinary: CloudinaryConfig{
+			Environment: "production",
+		},
+		OIDC: OIDCConfig{PostLoginRedirect: "http://localhost:5173/feed"},
+	}
+}
+
+// Load builds the configuration from the optional file named by -config (or
+// CONFIG_FILE), the environment and the given command-line arguments, and
+// validates the result.
+func Load(args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet("server", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with the configuration flags added to fs, so commands
+// can define flags of their own next to them.
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	addr := fs.String("addr", "", "listen address (overrides server.addr)")
+	dbPath := fs.String("db", "", "SQLite database path (overrides database.path)")
+	migrations := fs.String("migrations", "", "migrations directory (overrides database.migrations_dir)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *file != "" {
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", *file, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if *addr != "" {
+		cfg.Server.Addr = *addr
+	}
+	if *dbPath != "" {
+		cfg.Database.Path = *dbPath
+	}
+	if *migrations != "" {
+		cfg.Database.MigrationsDir = *migrations
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() error {
+	setString(&c.Server.Addr, "ADDR")
+	setString(&c.Database.Path, "DB_PATH")
+	setString(&c.Database.MigrationsDir, "MIGRATIONS_DIR")
+	setString(&c.Uploads.Backend, "MEDIA_BACKEND")
+	setString(&c.Uploads.LocalDir, "UPLOADS_DIR")
+	if err := setDuration(&c.Session.TTL, "SESSION_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Uploads.GCInterval, "MEDIA_GC_INTERVAL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Uploads.OrphanGracePeriod, "MEDIA_GC_GRACE"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Uploads.GCRemote, "MEDIA_GC_REMOTE"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Accounts.DeletionGracePeriod, "ACCOUNT_DELETION_GRACE"); err != nil {
+		return err
+	}
+	if v := os.Getenv("UPLOAD_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("UPLOAD_MAX_BYTES: %w", err)
+		}
+		c.Uploads.MaxBytes = n
+	}
+	if v := os.Getenv("UPLOAD_MAX_PIXELS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("UPLOAD_MAX_PIXELS: %w", err)
+		}
+		c.Uploads.MaxPixels = n
+	}
+	if v := os.Getenv("UPLOAD_MAX_POST_IMAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("UPLOAD_MAX_POST_IMAGES: %w", err)
+		}
+		c.Uploads.MaxPostImages = n
+	}
+	if err := c.Events.applyEnv(); err != nil {
+		return err
+	}
+	c.Security.applyEnv()
+	c.Admin.applyEnv()
+	c.Cloudinary.applyEnv()
+	return c.OIDC.applyEnv()
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path is required"))
+	}
+	if c.Session.TTL <= 0 {
+		errs = append(errs, errors.New("session.ttl must be positive"))
+	}
+	switch c.Uploads.Backend {
+	case "auto", "local", "cloudinary":
+	default:
+		errs = append(errs, fmt.Errorf("uploads.backend: unknown backend %q", c.Uploads.Backend))
+	}
+	if c.Uploads.Backend == "cloudinary" && !c.Cloudinary.Configured() {
+		errs = append(errs, errors.New("uploads.backend is cloudinary but cloudinary is not configured"))
+	}
+	if c.Uploads.Backend == "local" || c.Uploads.Backend == "auto" {
+		if c.Uploads.LocalDir == "" {
+			errs = append(errs, errors.New("uploads.local_dir is required for local storage"))
+		}
+	}
+	if c.Uploads.MaxBytes <= 0 {
+		errs = append(errs, errors.New("uploads.max_bytes must be positive"))
+	}
+	if c.Uploads.MaxPixels <= 0 {
+		errs = append(errs, errors.New("uploads.max_pixels must be positive"))
+	}
+	if c.Uploads.MaxPostImages < 0 {
+		errs = append(errs, errors.New("uploads.max_post_images must not be negative"))
+	}
+	if c.Uploads.GCInterval < 0 {
+		errs = append(errs, errors.New("uploads.gc_interval must not be negative"))
+	}
+	if c.Uploads.OrphanGracePeriod <= 0 {
+		errs = append(errs, errors.New("uploads.orphan_grace_period must be positive"))
+	}
+	if c.Accounts.DeletionGracePeriod < 0 {
+		errs = append(errs, errors.New("accounts.deletion_grace_period must not be negative"))
+	}
+	if c.Events.ReminderInterval < 0 {
+		errs = append(errs, errors.New("events.reminder_interval must not be negative"))
+	}
+	for _, d := range c.Events.ReminderOffsets {
+		if d < time.Minute {
+			errs = append(errs, fmt.Errorf("events.reminder_offsets: %s is less than a minute", d))
+		}
+	}
+	if len(c.Security.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("security.allowed_origins must not be empty"))
+	}
+	for _, o := range c.Security.AllowedOrigins {
+		if o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("security.allowed_origins: %q is not an origin", o))
+		}
+	}
+	if c.Admin.Password != "" && c.Admin.Email == "" {
+		errs = append(errs, errors.New("admin.password is set without admin.email"))
+	}
+	cl := c.Cloudinary
+	if set := btoi(cl.CloudName != "") + btoi(cl.APIKey != "") + btoi(cl.APISecret != ""); set != 0 && set != 3 {
+		errs = append(errs, errors.New("cloudinary: cloud_name, api_key and api_secret must be set together"))
+	}
+	if cl.Configured() && !validFolderName(cl.Environment) {
+		errs = append(errs, fmt.Errorf("cloudinary.environment %q must be letters, digits, '-' or '_'", cl.Environment))
+	}
+	for _, p := range c.OIDC.Providers {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			errs = append(errs, fmt.Errorf("oidc provider %q: name, issuer, client_id and redirect_url are required", p.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted renders the configuration for logging with secrets masked.
+func (c *Config) Redacted() string {
+	var b strings.Builder
+	line := func(k string, v any) { fmt.Fprintf(&b, "  %s: %v\n", k, v) }
+	b.WriteString("configuration:\n")
+	line("server.addr", c.Server.Addr)
+	line("database.path", c.Database.Path)
+	line("database.migrations_dir", c.Database.MigrationsDir)
+	line("session.ttl", c.Session.TTL)
+	line("uploads.backend", c.Uploads.Backend)
+	line("uploads.max_bytes", c.Uploads.MaxBytes)
+	line("uploads.max_pixels", c.Uploads.MaxPixels)
+	line("uploads.max_post_images", c.Uploads.MaxPostImages)
+	line("uploads.local_dir", c.Uploads.LocalDir)
+	line("uploads.gc_interval", c.Uploads.GCInterval)
+	line("uploads.orphan_grace_period", c.Uploads.OrphanGracePeriod)
+	line("uploads.gc_remote", c.Uploads.GCRemote)
+	line("accounts.deletion_grace_period", c.Accounts.DeletionGracePeriod)
+	line("events.reminder_offsets", c.Events.ReminderOffsets)
+	line("events.reminder_interval", c.Events.ReminderInterval)
+	line("security.allowed_origins", strings.Join(c.Security.AllowedOrigins, ","))
+	line("admin.email", c.Admin.Email)
+	line("admin.password", redact(c.Admin.Password))
+	line("cloudinary.cloud_name", c.Cloudinary.CloudName)
+	line("cloudinary.api_key", redact(c.Cloudinary.APIKey))
+	line("cloudinary.api_secret", redact(c.Cloudinary.APISecret))
+	line("cloudinary.environment", c.Cloudinary.Environment)
+	line("oidc.post_login_redirect", c.OIDC.PostLoginRedirect)
+	for _, p := range c.OIDC.Providers {
+		line("oidc.providers."+p.Name, fmt.Sprintf("issuer=%s client_id=%s client_secret=%s redirect_url=%s trust_email=%t",
+			p.Issuer, p.ClientID, redact(p.ClientSecret), p.RedirectURL, p.TrustEmail))
+	}
+	return b.String()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return "(unset)"
+	}
+	return "****"
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func setString(dst *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+	}
+}
+
+func setBool(dst *bool, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
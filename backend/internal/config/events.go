@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// EventsConfig controls group event reminders.
+type EventsConfig struct {
+	// How long before an event starts attendees are reminded; one
+	// notification per offset. Empty disables reminders.
+	ReminderOffsets []time.Duration `yaml:"reminder_offsets"`
+	// How often due reminders are looked for; 0 disables reminders.
+	ReminderInterval time.Duration `yaml:"reminder_interval"`
+}
+
+func (c *EventsConfig) applyEnv() error {
+	if v := os.Getenv("EVENT_REMINDER_OFFSETS"); v != "" {
+		var offsets []time.Duration
+		if v != "none" {
+			for _, s := range strings.Split(v, ",") {
+				d, err := time.ParseDuration(strings.TrimSpace(s))
+				if err != nil {
+					return fmt.Errorf("EVENT_REMINDER_OFFSETS: %w", err)
+				}
+				offsets = append(offsets, d)
+			}
+		}
+		c.ReminderOffsets = offsets
+	}
+	return setDuration(&c.ReminderInterval, "EVENT_REMINDER_INTERVAL")
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// OIDCProviderConfig configures one external identity provider. From the
+// environment, providers are listed in OIDC_PROVIDERS (comma-separated names)
+// and each reads OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and _TRUST_EMAIL.
+type OIDCProviderConfig struct {
+	Name         string `yaml:"name"`
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	// Whether a verified email from this provider is proof enough to sign
+	// in to the local account with that address. Without it, the owner has
+	// to sign in and link the provider themselves.
+	TrustEmail bool `yaml:"trust_email"`
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `yaml:"providers"`
+	// Where the browser lands after a successful external login.
+	PostLoginRedirect string `yaml:"post_login_redirect"`
+}
+
+func (c *OIDCConfig) applyEnv() error {
+	setString(&c.PostLoginRedirect, "OIDC_POST_LOGIN_REDIRECT")
+	names := os.Getenv("OIDC_PROVIDERS")
+	if names == "" {
+		return nil
+	}
+	c.Providers = nil
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		var trust bool
+		if err := setBool(&trust, prefix+"TRUST_EMAIL"); err != nil {
+			return err
+		}
+		c.Providers = append(c.Providers, OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", "http://localhost:8080/api/auth/oidc/"+strings.ToLower(name)+"/callback"),
+			TrustEmail:   trust,
+		})
+	}
+	return nil
+}
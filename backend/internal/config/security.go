@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// SecurityConfig holds the browser-facing security settings shared by CORS,
+// CSRF protection and the WebSocket origin check.
+type SecurityConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+func (c *SecurityConfig) applyEnv() {
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		var origins []string
+		for _, o := range strings.Split(v, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				origins = append(origins, o)
+			}
+		}
+		c.AllowedOrigins = origins
+	}
+}
+
+// OriginAllowed reports whether origin is one of the configured origins.
+func (c *SecurityConfig) OriginAllowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
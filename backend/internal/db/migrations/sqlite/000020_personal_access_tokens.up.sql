@@ -0,0 +1,14 @@
+-- personal access tokens for scripts and bots (Authorization: Bearer)
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE, -- sha256 hex of the plaintext token
+    scopes TEXT NOT NULL, -- comma-separated: read,write,chat
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pat_user ON personal_access_tokens(user_id);
@@ -0,0 +1,25 @@
+-- external (OIDC) identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL, -- the provider's "sub" claim
+    email TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, subject),
+    UNIQUE(user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- in-flight authorization requests (state, nonce and PKCE verifier)
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    link_user_id TEXT, -- set when a signed-in user is linking a new identity
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (link_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+-- scheduled account deletion (grace period before the hard delete)
+ALTER TABLE users ADD COLUMN delete_after TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_delete_after ON users(delete_after);
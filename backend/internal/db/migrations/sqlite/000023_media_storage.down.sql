@@ -0,0 +1,2 @@
+ALTER TABLE post_images DROP COLUMN storage;
+ALTER TABLE profiles DROP COLUMN avatar_storage;
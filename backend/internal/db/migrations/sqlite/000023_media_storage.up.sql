@@ -0,0 +1,7 @@
+-- record which media backend holds each stored image
+ALTER TABLE post_images ADD COLUMN storage TEXT;
+ALTER TABLE profiles ADD COLUMN avatar_storage TEXT;
+
+UPDATE post_images SET storage = CASE WHEN cloudinary_public_id IS NOT NULL THEN 'cloudinary' ELSE 'local' END;
+UPDATE profiles SET avatar_storage = CASE WHEN cloudinary_avatar_public_id IS NOT NULL THEN 'cloudinary' ELSE 'local' END
+WHERE avatar_path IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS media_variants;
+ALTER TABLE post_images DROP COLUMN blurhash;
@@ -0,0 +1,15 @@
+-- placeholder painted while a post image loads
+ALTER TABLE post_images ADD COLUMN blurhash TEXT;
+
+-- resized copies generated at upload time, keyed by the stored original
+CREATE TABLE IF NOT EXISTS media_variants (
+    storage TEXT NOT NULL,
+    source_key TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    key TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    format TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (storage, source_key, variant)
+);
@@ -0,0 +1,19 @@
+DELETE FROM media_variants WHERE variant = '';
+
+CREATE TABLE media_variants_old (
+    storage TEXT NOT NULL,
+    source_key TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    key TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    format TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (storage, source_key, variant)
+);
+
+INSERT OR IGNORE INTO media_variants_old(storage, source_key, variant, key, width, height, format, created_at)
+SELECT storage, source_key, variant, key, width, height, format, created_at FROM media_variants;
+
+DROP TABLE media_variants;
+ALTER TABLE media_variants_old RENAME TO media_variants;
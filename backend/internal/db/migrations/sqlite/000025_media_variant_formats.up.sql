@@ -0,0 +1,19 @@
+-- a size may exist in several formats (a WebP original next to its JPEG
+-- fallback); the empty variant name stands for the main image
+CREATE TABLE media_variants_new (
+    storage TEXT NOT NULL,
+    source_key TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    format TEXT NOT NULL,
+    key TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (storage, source_key, variant, format)
+);
+
+INSERT INTO media_variants_new(storage, source_key, variant, format, key, width, height, created_at)
+SELECT storage, source_key, variant, format, key, width, height, created_at FROM media_variants;
+
+DROP TABLE media_variants;
+ALTER TABLE media_variants_new RENAME TO media_variants;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_group_posts_attachments;
+DROP TRIGGER IF EXISTS trg_group_messages_attachments;
+DROP TRIGGER IF EXISTS trg_direct_messages_attachments;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,35 @@
+-- images attached to chat messages and group posts; an attachment is
+-- uploaded first and claimed by the message or post that references it
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,
+    uploader_id TEXT NOT NULL,
+    subject_type TEXT CHECK (subject_type IN ('direct_message', 'group_message', 'group_post')),
+    subject_id TEXT,
+    path TEXT NOT NULL,
+    storage TEXT NOT NULL,
+    mime TEXT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    blurhash TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_subject ON attachments(subject_type, subject_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_uploader ON attachments(uploader_id);
+
+-- the subject can't carry a foreign key, so deletes are cascaded by hand
+CREATE TRIGGER IF NOT EXISTS trg_direct_messages_attachments AFTER DELETE ON direct_messages
+BEGIN
+    DELETE FROM attachments WHERE subject_type = 'direct_message' AND subject_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_group_messages_attachments AFTER DELETE ON group_messages
+BEGIN
+    DELETE FROM attachments WHERE subject_type = 'group_message' AND subject_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_group_posts_attachments AFTER DELETE ON group_posts
+BEGIN
+    DELETE FROM attachments WHERE subject_type = 'group_post' AND subject_id = OLD.id;
+END;
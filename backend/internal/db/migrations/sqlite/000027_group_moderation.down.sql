@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_group_audit_log_group;
+DROP TABLE IF EXISTS group_audit_log;
+DROP TABLE IF EXISTS group_bans;
+UPDATE group_members SET role = 'member' WHERE role IN ('admin', 'moderator');
@@ -0,0 +1,30 @@
+-- group_members.role now also takes 'admin' and 'moderator'
+
+-- users banned from a group can't rejoin until unbanned
+CREATE TABLE IF NOT EXISTS group_bans (
+    group_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    banned_by TEXT,
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- membership and moderation actions, newest first per group
+CREATE TABLE IF NOT EXISTS group_audit_log (
+    id TEXT PRIMARY KEY,
+    group_id TEXT NOT NULL,
+    actor_user_id TEXT,
+    action TEXT NOT NULL,
+    target_user_id TEXT,
+    details TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_audit_log_group ON group_audit_log(group_id, created_at);
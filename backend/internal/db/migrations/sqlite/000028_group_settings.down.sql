@@ -0,0 +1,5 @@
+ALTER TABLE groups DROP COLUMN cover_storage;
+ALTER TABLE groups DROP COLUMN cover_path;
+ALTER TABLE groups DROP COLUMN avatar_storage;
+ALTER TABLE groups DROP COLUMN avatar_path;
+ALTER TABLE groups DROP COLUMN archived_at;
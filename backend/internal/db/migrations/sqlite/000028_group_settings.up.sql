@@ -0,0 +1,8 @@
+-- archived groups are read-only and hidden from the group list
+ALTER TABLE groups ADD COLUMN archived_at TIMESTAMP;
+
+-- group avatar and cover image, stored like profile avatars
+ALTER TABLE groups ADD COLUMN avatar_path TEXT;
+ALTER TABLE groups ADD COLUMN avatar_storage TEXT;
+ALTER TABLE groups ADD COLUMN cover_path TEXT;
+ALTER TABLE groups ADD COLUMN cover_storage TEXT;
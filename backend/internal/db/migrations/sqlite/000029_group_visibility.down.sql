@@ -0,0 +1,2 @@
+ALTER TABLE groups DROP COLUMN join_policy;
+ALTER TABLE groups DROP COLUMN visibility;
@@ -0,0 +1,7 @@
+-- who can find a group and read its content, and how people join it;
+-- the defaults keep what groups did before: listed, members-only content,
+-- joining on request
+ALTER TABLE groups ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('public', 'private', 'secret'));
+ALTER TABLE groups ADD COLUMN join_policy TEXT NOT NULL DEFAULT 'request'
+    CHECK (join_policy IN ('open', 'request', 'invite'));
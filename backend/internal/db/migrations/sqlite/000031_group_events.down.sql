@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS events (
+    id TEXT PRIMARY KEY,
+    group_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    datetime TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_group ON events(group_id);
+
+CREATE TABLE IF NOT EXISTS event_responses (
+    event_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('going','not_going')),
+    responded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO events(id, group_id, title, description, datetime, created_at)
+SELECT id, group_id, title, description, starts_at, created_at FROM group_events;
+
+INSERT INTO event_responses(event_id, user_id, status, responded_at)
+SELECT event_id, user_id, response, updated_at FROM group_event_responses WHERE response != 'maybe';
+
+DROP TABLE IF EXISTS group_event_reminders;
+DROP TABLE IF EXISTS group_event_responses;
+DROP TABLE IF EXISTS group_events;
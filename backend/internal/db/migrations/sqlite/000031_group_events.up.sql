@@ -0,0 +1,58 @@
+-- the event handlers always used group_events and group_event_responses,
+-- which were never created; they replace the unused events and
+-- event_responses tables
+
+-- start and end are stored in UTC; timezone is the IANA zone they were
+-- entered in, for display and for editing
+CREATE TABLE IF NOT EXISTS group_events (
+    id TEXT PRIMARY KEY,
+    group_id TEXT NOT NULL,
+    created_by TEXT,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    cancelled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_events_group ON group_events(group_id, starts_at);
+CREATE INDEX IF NOT EXISTS idx_group_events_starts ON group_events(starts_at);
+
+CREATE TABLE IF NOT EXISTS group_event_responses (
+    event_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- reminders already sent, per offset and start time so that moving an
+-- event re-arms them
+CREATE TABLE IF NOT EXISTS group_event_reminders (
+    event_id TEXT NOT NULL,
+    offset_minutes INTEGER NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, offset_minutes, starts_at),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE
+);
+
+INSERT INTO group_events(id, group_id, title, description, starts_at, ends_at, created_at)
+SELECT id, group_id, title, COALESCE(description, ''), datetime(datetime), datetime(datetime, '+1 hour'), created_at
+FROM events WHERE datetime(datetime) IS NOT NULL;
+
+INSERT INTO group_event_responses(event_id, user_id, response, created_at, updated_at)
+SELECT r.event_id, r.user_id, r.status, r.responded_at, r.responded_at
+FROM event_responses r JOIN group_events e ON e.id = r.event_id;
+
+DROP TABLE IF EXISTS event_responses;
+DROP TABLE IF EXISTS events;
@@ -0,0 +1,22 @@
+CREATE TABLE group_event_responses_old (
+    event_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- single events keep their answers; of a series only the latest per user
+INSERT OR REPLACE INTO group_event_responses_old(event_id, user_id, response, created_at, updated_at)
+SELECT event_id, user_id, response, created_at, updated_at FROM group_event_responses ORDER BY updated_at;
+
+DROP TABLE group_event_responses;
+ALTER TABLE group_event_responses_old RENAME TO group_event_responses;
+
+ALTER TABLE group_event_reminders DROP COLUMN occurrence;
+DROP TABLE IF EXISTS group_event_occurrences;
+ALTER TABLE group_events DROP COLUMN exdates;
+ALTER TABLE group_events DROP COLUMN rrule;
@@ -0,0 +1,41 @@
+-- an RFC 5545 RRULE makes the event a series starting at starts_at;
+-- exdates lists removed occurrences by their start, comma-separated UTC
+ALTER TABLE group_events ADD COLUMN rrule TEXT;
+ALTER TABLE group_events ADD COLUMN exdates TEXT NOT NULL DEFAULT '';
+
+-- edits to single occurrences of a series, keyed by the occurrence's
+-- original start in UTC; NULL fields keep the series' value
+CREATE TABLE IF NOT EXISTS group_event_occurrences (
+    event_id TEXT NOT NULL,
+    occurrence TEXT NOT NULL,
+    title TEXT,
+    description TEXT,
+    location TEXT,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    cancelled_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, occurrence),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE
+);
+
+-- answers are per occurrence; '' for events that don't repeat
+CREATE TABLE group_event_responses_new (
+    event_id TEXT NOT NULL,
+    occurrence TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL,
+    response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, occurrence, user_id),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO group_event_responses_new(event_id, user_id, response, created_at, updated_at)
+SELECT event_id, user_id, response, created_at, updated_at FROM group_event_responses;
+
+DROP TABLE group_event_responses;
+ALTER TABLE group_event_responses_new RENAME TO group_event_responses;
+
+ALTER TABLE group_event_reminders ADD COLUMN occurrence TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS calendar_feeds;
+ALTER TABLE group_event_occurrences DROP COLUMN sequence;
+ALTER TABLE group_events DROP COLUMN sequence;
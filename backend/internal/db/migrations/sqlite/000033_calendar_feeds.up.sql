@@ -0,0 +1,12 @@
+-- iCalendar SEQUENCE: bumped whenever the event or the occurrence changes
+ALTER TABLE group_events ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE group_event_occurrences ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+
+-- one private calendar feed URL per user; only the token's hash is kept
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
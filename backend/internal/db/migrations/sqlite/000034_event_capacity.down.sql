@@ -0,0 +1,22 @@
+CREATE TABLE group_event_responses_old (
+    event_id TEXT NOT NULL,
+    occurrence TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL,
+    response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, occurrence, user_id),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- the waitlist becomes maybe
+INSERT INTO group_event_responses_old(event_id, occurrence, user_id, response, created_at, updated_at)
+SELECT event_id, occurrence, user_id, CASE response WHEN 'waitlisted' THEN 'maybe' ELSE response END, created_at, updated_at
+FROM group_event_responses;
+
+DROP TABLE group_event_responses;
+ALTER TABLE group_event_responses_old RENAME TO group_event_responses;
+
+ALTER TABLE group_events DROP COLUMN rsvp_deadline;
+ALTER TABLE group_events DROP COLUMN capacity;
@@ -0,0 +1,26 @@
+-- capacity counts going members and their guests; NULL is unlimited.
+-- rsvp_deadline closes answers; for a series it is relative to each
+-- occurrence's start as it is to the first one's
+ALTER TABLE group_events ADD COLUMN capacity INTEGER;
+ALTER TABLE group_events ADD COLUMN rsvp_deadline TIMESTAMP;
+
+-- members who answer going to a full event wait in line by waitlisted_at
+CREATE TABLE group_event_responses_new (
+    event_id TEXT NOT NULL,
+    occurrence TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL,
+    response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going', 'waitlisted')),
+    guests INTEGER NOT NULL DEFAULT 0,
+    waitlisted_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, occurrence, user_id),
+    FOREIGN KEY (event_id) REFERENCES group_events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO group_event_responses_new(event_id, occurrence, user_id, response, created_at, updated_at)
+SELECT event_id, occurrence, user_id, response, created_at, updated_at FROM group_event_responses;
+
+DROP TABLE group_event_responses;
+ALTER TABLE group_event_responses_new RENAME TO group_event_responses;
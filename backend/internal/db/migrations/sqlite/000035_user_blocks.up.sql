@@ -0,0 +1,21 @@
+-- a block hides the two users from each other and stops them interacting;
+-- a mute only keeps the muted user out of the muter's feed and notifications
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_user_id TEXT NOT NULL,
+    blocked_user_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_user_id, blocked_user_id),
+    FOREIGN KEY (blocker_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_user_id);
+
+CREATE TABLE IF NOT EXISTS user_mutes (
+    muter_user_id TEXT NOT NULL,
+    muted_user_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (muter_user_id, muted_user_id),
+    FOREIGN KEY (muter_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
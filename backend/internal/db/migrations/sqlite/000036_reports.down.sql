@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS trg_moderation_actions_no_delete;
+DROP TRIGGER IF EXISTS trg_moderation_actions_no_update;
+DROP INDEX IF EXISTS idx_moderation_actions_created;
+DROP TABLE IF EXISTS moderation_actions;
+DROP INDEX IF EXISTS idx_reports_open;
+DROP INDEX IF EXISTS idx_reports_subject;
+DROP INDEX IF EXISTS idx_reports_queue;
+DROP TABLE IF EXISTS reports;
+ALTER TABLE users DROP COLUMN suspended_at;
+ALTER TABLE group_messages DROP COLUMN hidden_at;
+ALTER TABLE direct_messages DROP COLUMN hidden_at;
+ALTER TABLE group_comments DROP COLUMN hidden_at;
+ALTER TABLE group_posts DROP COLUMN hidden_at;
+ALTER TABLE comments DROP COLUMN hidden_at;
+ALTER TABLE posts DROP COLUMN hidden_at;
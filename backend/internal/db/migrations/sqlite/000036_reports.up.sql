@@ -0,0 +1,64 @@
+-- content a moderator hid stays in the database but is left out of every
+-- listing
+ALTER TABLE posts ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE comments ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE group_posts ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE group_comments ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE direct_messages ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE group_messages ADD COLUMN hidden_at TIMESTAMP;
+
+-- suspended users can't sign in
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+
+-- reports about content in a group (group_id set) go to that group's
+-- admins, all others to the site moderators
+CREATE TABLE IF NOT EXISTS reports (
+    id TEXT PRIMARY KEY,
+    reporter_user_id TEXT,
+    subject_type TEXT NOT NULL CHECK (subject_type IN ('post', 'comment', 'group_post', 'group_comment', 'direct_message', 'group_message', 'user', 'group')),
+    subject_id TEXT NOT NULL,
+    subject_user_id TEXT,
+    group_id TEXT,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    resolved_by TEXT,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reporter_user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (subject_user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_queue ON reports(group_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_reports_subject ON reports(subject_type, subject_id);
+-- one open report per reporter and subject
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open ON reports(reporter_user_id, subject_type, subject_id) WHERE status = 'open';
+
+-- what moderators did; rows are never changed or removed, so there are no
+-- foreign keys that could cascade into them
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id TEXT PRIMARY KEY,
+    report_id TEXT,
+    actor_user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    subject_user_id TEXT,
+    group_id TEXT,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_created ON moderation_actions(created_at);
+
+CREATE TRIGGER IF NOT EXISTS trg_moderation_actions_no_update BEFORE UPDATE ON moderation_actions
+BEGIN
+    SELECT RAISE(ABORT, 'moderation_actions is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_moderation_actions_no_delete BEFORE DELETE ON moderation_actions
+BEGIN
+    SELECT RAISE(ABORT, 'moderation_actions is append-only');
+END;
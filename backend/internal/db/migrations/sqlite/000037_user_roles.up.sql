@@ -0,0 +1,5 @@
+-- site-wide role: moderators work the site report queue and the admin API,
+-- admins also assign roles
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'));
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role) WHERE role != 'user';
@@ -0,0 +1,18 @@
+CREATE TABLE follow_requests_old (
+    id TEXT PRIMARY KEY,
+    from_user_id TEXT NOT NULL,
+    to_user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, accepted, declined
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(from_user_id, to_user_id),
+    FOREIGN KEY (from_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- only the latest request of each pair survives
+INSERT OR IGNORE INTO follow_requests_old(id, from_user_id, to_user_id, status, created_at)
+SELECT id, from_user_id, to_user_id, status, created_at FROM follow_requests
+ORDER BY created_at DESC, rowid DESC;
+
+DROP TABLE follow_requests;
+ALTER TABLE follow_requests_old RENAME TO follow_requests;
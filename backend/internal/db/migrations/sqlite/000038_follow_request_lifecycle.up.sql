@@ -0,0 +1,22 @@
+-- a pair may have any number of past requests but only one pending;
+-- responded_at starts the cooldown before a declined requester may ask again
+CREATE TABLE follow_requests_new (
+    id TEXT PRIMARY KEY,
+    from_user_id TEXT NOT NULL,
+    to_user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP,
+    FOREIGN KEY (from_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO follow_requests_new(id, from_user_id, to_user_id, status, created_at)
+SELECT id, from_user_id, to_user_id, status, created_at FROM follow_requests;
+
+DROP TABLE follow_requests;
+ALTER TABLE follow_requests_new RENAME TO follow_requests;
+
+CREATE UNIQUE INDEX idx_follow_requests_pending ON follow_requests(from_user_id, to_user_id) WHERE status = 'pending';
+CREATE INDEX idx_follow_requests_to ON follow_requests(to_user_id, status, created_at);
+CREATE INDEX idx_follow_requests_from ON follow_requests(from_user_id, to_user_id, created_at);
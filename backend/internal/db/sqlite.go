@@ -12,12 +12,8 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// OpenSQLite opens a SQLite database file from env DB_PATH or default path.
-func OpenSQLite() (*sql.DB, error) {
-	path := os.Getenv("DB_PATH")
-	if path == "" {
-		path = "./data/app.db"
-	}
+// OpenSQLite opens (creating if needed) the SQLite database file at path.
+func OpenSQLite(path string) (*sql.DB, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, fmt.Errorf("create data dir: %w", err)
 	}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+)
+
+// AccountHandler serves account-level operations: scheduled deletion and the
+// personal data export.
+type AccountHandler struct {
+	DB       *sql.DB
+	Accounts *services.AccountService
+	Media    services.MediaStore
+}
+
+// RequestDeletion schedules the caller's account for deletion after the
+// grace period. Until then it can be cancelled.
+func (h *AccountHandler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.IsToken() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	at, err := h.Accounts.ScheduleDeletion(sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "scheduled", "delete_after": at})
+}
+
+// CancelDeletion withdraws a pending deletion request.
+func (h *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.Accounts.CancelDeletion(sess.UserID); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "active"})
+}
+
+// DeletionStatus reports whether the caller's account is scheduled for deletion.
+func (h *AccountHandler) DeletionStatus(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	at, err := h.Accounts.DeletionScheduledAt(sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if at == nil {
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "active", "delete_after": nil})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "scheduled", "delete_after": at})
+}
+
+// exportSections lists the JSON files in the export and the query that fills
+// each one. Every query takes the user id once per placeholder.
+var exportSections = []struct {
+	file  string
+	query string
+}{
+	{"profile.json", `SELECT u.id, u.email, u.first_name, u.last_name, u.date_of_birth, u.created_at,
+		p.public, p.nickname, p.about, p.avatar_path, p.cloudinary_avatar_secure_url AS avatar_url
+		FROM users u LEFT JOIN profiles p ON p.user_id = u.id WHERE u.id = ?`},
+	{"posts.json", `SELECT id, text, privacy, created_at FROM posts WHERE user_id = ? ORDER BY created_at`},
+	{"post_images.json", `SELECT pi.id, pi.post_id, pi.path, pi.mime, pi.cloudinary_secure_url AS url, pi.width, pi.height, pi.format, pi.created_at
+		FROM post_images pi JOIN posts p ON p.id = pi.post_id WHERE p.user_id = ? ORDER BY pi.created_at`},
+	{"comments.json", `SELECT id, post_id, text, created_at FROM comments WHERE user_id = ? ORDER BY created_at`},
+	{"direct_messages.json", `SELECT id, from_user_id, to_user_id, text, created_at, read_at FROM direct_messages
+		WHERE from_user_id = ?1 OR to_user_id = ?1 ORDER BY created_at`},
+	{"group_messages.json", `SELECT id, group_id, text, created_at FROM group_messages WHERE from_user_id = ? ORDER BY created_at`},
+	{"attachments.json", `SELECT id, subject_type, subject_id, mime, width, height, created_at FROM attachments
+		WHERE uploader_id = ? ORDER BY created_at`},
+	{"followers.json", `SELECT follower_user_id AS user_id, created_at FROM follows WHERE followed_user_id = ?`},
+	{"following.json", `SELECT followed_user_id AS user_id, created_at FROM follows WHERE follower_user_id = ?`},
+	{"follow_requests.json", `SELECT id, from_user_id, to_user_id, status, created_at, responded_at FROM follow_requests
+		WHERE from_user_id = ?1 OR to_user_id = ?1`},
+	{"groups.json", `SELECT g.id, g.title, g.description, gm.role, gm.joined_at FROM group_members gm
+		JOIN groups g ON g.id = gm.group_id WHERE gm.user_id = ?`},
+	{"group_posts.json", `SELECT id, group_id, text, created_at FROM group_posts WHERE user_id = ? ORDER BY created_at`},
+	{"group_comments.json", `SELECT id, group_post_id, text, created_at FROM group_comments WHERE user_id = ? ORDER BY created_at`},
+	{"notifications.json", `SELECT id, type, actor_user_id, subject_id, created_at, read_at FROM notifications
+		WHERE user_id = ? ORDER BY created_at`},
+	{"blocks.json", `SELECT blocked_user_id AS user_id, created_at FROM user_blocks WHERE blocker_user_id = ?`},
+	{"mutes.json", `SELECT muted_user_id AS user_id, created_at FROM user_mutes WHERE muter_user_id = ?`},
+	{"reports.json", `SELECT id, subject_type, subject_id, reason, details, status, created_at, resolved_at FROM reports
+		WHERE reporter_user_id = ? ORDER BY created_at`},
+}
+
+// Export streams a ZIP archive of everything the user has stored with us,
+// as one JSON file per data set plus the image files under images/.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.IsToken() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// build the JSON up front so a query failure can still produce a clean error
+	files := map[string][]byte{}
+	for _, sec := range exportSections {
+		rows, err := queryMaps(h.DB, sec.query, sess.UserID)
+		if err != nil {
+			log.Printf("export %s: %v", sec.file, err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		b, _ := json.MarshalIndent(rows, "", "  ")
+		files[sec.file] = b
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.zip"`, time.Now().UTC().Format("20060102")))
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+	for _, sec := range exportSections {
+		f, err := createZipEntry(zw, sec.file)
+		if err != nil {
+			return
+		}
+		_, _ = f.Write(files[sec.file])
+	}
+	h.exportImages(r, zw, sess.UserID)
+}
+
+// exportImages adds the user's avatar, post images and attachments to the
+// archive. Images that can't be fetched are skipped and listed in
+// images/missing.txt.
+func (h *AccountHandler) exportImages(r *http.Request, zw *zip.Writer, userID string) {
+	rows, err := h.DB.Query(`
+		SELECT 'avatar', avatar_path, avatar_storage, cloudinary_avatar_secure_url FROM profiles
+		WHERE user_id = ?1 AND avatar_path IS NOT NULL
+		UNION ALL
+		SELECT pi.id, pi.path, pi.storage, pi.cloudinary_secure_url FROM post_images pi
+		JOIN posts p ON p.id = pi.post_id WHERE p.user_id = ?1
+		UNION ALL
+		SELECT 'attachments/' || id, path, storage, NULL FROM attachments WHERE uploader_id = ?1`, userID)
+	if err != nil {
+		return
+	}
+	type image struct{ name, key, storage, url string }
+	var images []image
+	for rows.Next() {
+		var name, key string
+		var storage, u sql.NullString
+		if err := rows.Scan(&name, &key, &storage, &u); err == nil {
+			images = append(images, image{name, key, storage.String, u.String})
+		}
+	}
+	rows.Close()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var missing []string
+	for _, img := range images {
+		var src io.ReadCloser
+		ext := path.Ext(img.key)
+		if img.storage == h.Media.Name() {
+			src, _ = h.Media.Open(r.Context(), img.key)
+		} else if img.url != "" {
+			// held by a backend we are no longer configured for; fetch it by URL
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, img.url, nil)
+			if err == nil {
+				if resp, err := client.Do(req); err == nil && resp.StatusCode == http.StatusOK {
+					src, ext = resp.Body, path.Ext(req.URL.Path)
+				} else if err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+		if src == nil {
+			missing = append(missing, img.name)
+			continue
+		}
+		if f, err := createZipEntry(zw, "images/"+img.name+ext); err == nil {
+			_, _ = io.Copy(f, src)
+		}
+		src.Close()
+	}
+	if len(missing) > 0 {
+		if f, err := createZipEntry(zw, "images/missing.txt"); err == nil {
+			_, _ = f.Write([]byte(strings.Join(missing, "\n") + "\n"))
+		}
+	}
+}
+
+func createZipEntry(zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+// queryMaps runs a query and returns each row as a column->value map.
+func queryMaps(db *sql.DB, query string, args ...any) ([]map[string]any, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := []map[string]any{}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		m := make(map[string]any, len(cols))
+		for i, c := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				m[c] = string(b)
+			} else {
+				m[c] = vals[i]
+			}
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
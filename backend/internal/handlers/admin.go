@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminHandler serves the site staff's API under /api/admin. Moderators
+// and admins manage accounts and remove content; only admins assign roles
+// and read platform statistics. Staff can't act on anyone of their own rank
+// or above, and every action is added to the moderation log.
+type AdminHandler struct {
+	DB  *sql.DB
+	Hub *websocket.Hub
+}
+
+// siteRole returns the user's site role; the error is sql.ErrNoRows when
+// there is no such user.
+func siteRole(db *sql.DB, userID string) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	return role, err
+}
+
+// targetUser reads the user named in the URL and writes 404, or 403 unless
+// the caller outranks them.
+func (h *AdminHandler) targetUser(w http.ResponseWriter, r *http.Request, sess *auth.Session) (string, bool) {
+	target := chi.URLParam(r, "id")
+	role, err := siteRole(h.DB, target)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return "", false
+	}
+	if !auth.RoleOutranks(sess.Role, role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+	return target, true
+}
+
+type adminUser struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	Role        string     `json:"role"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	Sessions    int        `json:"sessions"`
+}
+
+// ListUsers lists accounts, newest first. ?q= searches names and email,
+// ?role= and ?status=active|suspended filter, and ?limit= and ?offset=
+// page through the results.
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := []string{"1 = 1"}
+	var args []any
+	if s := strings.TrimSpace(q.Get("q")); s != "" {
+		where = append(where, "(u.first_name LIKE ? OR u.last_name LIKE ? OR u.email LIKE ?)")
+		args = append(args, "%"+s+"%", "%"+s+"%", "%"+s+"%")
+	}
+	if role := q.Get("role"); role != "" {
+		where = append(where, "u.role = ?")
+		args = append(args, role)
+	}
+	switch q.Get("status") {
+	case "":
+	case "active":
+		where = append(where, "u.suspended_at IS NULL")
+	case "suspended":
+		where = append(where, "u.suspended_at IS NOT NULL")
+	default:
+		http.Error(w, "unknown status", http.StatusBadRequest)
+		return
+	}
+	cond := strings.Join(where, " AND ")
+	var total int
+	if err := h.DB.QueryRow("SELECT COUNT(*) FROM users u WHERE "+cond, args...).Scan(&total); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	limit, offset := pageParams(r, 50, 200)
+	rows, err := h.DB.Query(`SELECT u.id, u.email, u.first_name, u.last_name, u.role, u.created_at, u.suspended_at, u.delete_after,
+		(SELECT COUNT(*) FROM sessions s WHERE s.user_id = u.id AND s.expires_at > ?)
+		FROM users u WHERE `+cond+` ORDER BY u.created_at DESC, u.id LIMIT ? OFFSET ?`,
+		append(append([]any{time.Now()}, args...), limit, offset)...)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []adminUser{}
+	for rows.Next() {
+		var u adminUser
+		var suspendedAt, deleteAfter sql.NullTime
+		if rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Role, &u.CreatedAt, &suspendedAt, &deleteAfter, &u.Sessions) != nil {
+			continue
+		}
+		if suspendedAt.Valid {
+			u.SuspendedAt = &suspendedAt.Time
+		}
+		if deleteAfter.Valid {
+			u.DeleteAfter = &deleteAfter.Time
+		}
+		out = append(out, u)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"users": out, "total": total, "limit": limit, "offset": offset})
+}
+
+type adminNoteReq struct {
+	Note string `json:"note"`
+}
+
+// readNote reads the optional note on an admin action.
+func readNote(r *http.Request) string {
+	var body adminNoteReq
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	return strings.TrimSpace(body.Note)
+}
+
+// Suspend suspends an account: its sessions end, its live connections are
+// closed, and it can't sign in or use its tokens until unsuspended.
+func (h *AdminHandler) Suspend(w http.ResponseWriter, r *http.Request) {
+	sess, _ := auth.SessionFromContext(r)
+	target, ok := h.targetUser(w, r, sess)
+	if !ok {
+		return
+	}
+	note := readNote(r)
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := suspendAccount(tx, target); err != nil {
+			return err
+		}
+		if err := logModeration(tx, "", sess.UserID, modSuspend, "user", target, target, "", note); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.DisconnectUser(target)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "suspended"})
+}
+
+// Unsuspend lifts a suspension.
+func (h *AdminHandler) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	sess, _ := auth.SessionFromContext(r)
+	target, ok := h.targetUser(w, r, sess)
+	if !ok {
+		return
+	}
+	note := readNote(r)
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		res, err := tx.Exec("UPDATE users SET suspended_at = NULL WHERE id = ? AND suspended_at IS NOT NULL", target)
+		if n, err := rowsAffected(res, err); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		if err := logModeration(tx, "", sess.UserID, "unsuspend", "user", target, target, "", note); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err == sql.ErrNoRows {
+		http.Error(w, "not suspended", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "active"})
+}
+
+// Logout ends all of a user's sessions and closes their live connections.
+// Personal access tokens are left alone.
+func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sess, _ := auth.SessionFromContext(r)
+	target, ok := h.targetUser(w, r, sess)
+	if !ok {
+		return
+	}
+	note := readNote(r)
+	var ended int64
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		res, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", target)
+		if ended, err = rowsAffected(res, err); err != nil {
+			return err
+		}
+		if err := logModeration(tx, "", sess.UserID, "logout", "user", target, target, "", note); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.DisconnectUser(target)
+	_ = json.NewEncoder(w).Encode(map[string]any{"sessions_ended": ended})
+}
+
+type setSiteRoleReq struct {
+	Role string `json:"role"`
+}
+
+// SetRole changes a user's site role. Admins only; an admin can't change
+// another admin's role or their own.
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	sess, _ := auth.SessionFromContext(r)
+	target, ok := h.targetUser(w, r, sess)
+	if !ok {
+		return
+	}
+	var body setSiteRoleReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	switch body.Role {
+	case auth.RoleUser, auth.RoleModerator, auth.RoleAdmin:
+	default:
+		http.Error(w, "unknown role", http.StatusBadRequest)
+		return
+	}
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", body.Role, target); err != nil {
+			return err
+		}
+		if err := logModeration(tx, "", sess.UserID, "set_role", "user", target, target, "", body.Role); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"role": body.Role})
+}
+
+// DeleteContent deletes a post, comment, group post or comment, or message
+// outright, whether or not it was reported. Open reports on it are closed
+// as actioned.
+func (h *AdminHandler) DeleteContent(w http.ResponseWriter, r *http.Request) {
+	sess, _ := auth.SessionFromContext(r)
+	typ, id := chi.URLParam(r, "type"), chi.URLParam(r, "contentID")
+	table, ok := contentTables[typ]
+	if !ok {
+		http.Error(w, "unknown content type", http.StatusBadRequest)
+		return
+	}
+	author := "user_id"
+	if typ == "direct_message" || typ == "group_message" {
+		author = "from_user_id"
+	}
+	var owner string
+	if err := h.DB.QueryRow("SELECT "+author+" FROM "+table+" WHERE id = ?", id).Scan(&owner); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if role, err := siteRole(h.DB, owner); err == nil && owner != sess.UserID && !auth.RoleOutranks(sess.Role, role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	note := readNote(r)
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE id = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE reports SET status = 'actioned', resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			WHERE subject_type = ? AND subject_id = ? AND status = 'open'`, sess.UserID, typ, id); err != nil {
+			return err
+		}
+		if err := logModeration(tx, "", sess.UserID, modDelete, typ, id, owner, "", note); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stats reports platform totals, with activity over the last day and week.
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	day, week := now.Add(-24*time.Hour).Format(dbTime), now.Add(-7*24*time.Hour).Format(dbTime)
+	counts := []struct {
+		key, query string
+		args       []any
+	}{
+		{"users", "SELECT COUNT(*) FROM users", nil},
+		{"users_new_week", "SELECT COUNT(*) FROM users WHERE created_at >= ?", []any{week}},
+		{"users_suspended", "SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL", nil},
+		{"users_pending_deletion", "SELECT COUNT(*) FROM users WHERE delete_after IS NOT NULL", nil},
+		{"users_active_day", "SELECT COUNT(DISTINCT user_id) FROM sessions WHERE created_at >= ?", []any{day}},
+		{"moderators", "SELECT COUNT(*) FROM users WHERE role != 'user'", nil},
+		{"posts", "SELECT COUNT(*) FROM posts", nil},
+		{"posts_day", "SELECT COUNT(*) FROM posts WHERE created_at >= ?", []any{day}},
+		{"comments", "SELECT COUNT(*) FROM comments", nil},
+		{"groups", "SELECT COUNT(*) FROM groups", nil},
+		{"group_posts", "SELECT COUNT(*) FROM group_posts", nil},
+		{"group_events", "SELECT COUNT(*) FROM group_events", nil},
+		{"direct_messages", "SELECT COUNT(*) FROM direct_messages", nil},
+		{"group_messages", "SELECT COUNT(*) FROM group_messages", nil},
+		{"messages_day", "SELECT (SELECT COUNT(*) FROM direct_messages WHERE created_at >= ?1) + (SELECT COUNT(*) FROM group_messages WHERE created_at >= ?1)", []any{day}},
+		{"reports_open", "SELECT COUNT(*) FROM reports WHERE status = 'open'", nil},
+		{"reports_open_site", "SELECT COUNT(*) FROM reports WHERE status = 'open' AND group_id IS NULL", nil},
+		{"reports_week", "SELECT COUNT(*) FROM reports WHERE created_at >= ?", []any{week}},
+	}
+	out := map[string]any{"generated_at": now}
+	for _, c := range counts {
+		var n int
+		if err := h.DB.QueryRow(c.query, c.args...).Scan(&n); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		out[c.key] = n
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/imaging"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Subjects an attachment can belong to.
+const (
+	subjectDirectMessage = "direct_message"
+	subjectGroupMessage  = "group_message"
+	subjectGroupPost     = "group_post"
+)
+
+// maxAttachments caps how many images one message or post may carry.
+const maxAttachments = 10
+
+var errInvalidAttachments = errors.New("invalid attachments")
+
+// AttachmentsHandler uploads and serves images attached to chat messages and
+// group posts. An upload is pending until a message or post claims it by id;
+// from then on only the people who can see that subject may fetch it.
+type AttachmentsHandler struct {
+	DB             *sql.DB
+	Media          services.MediaStore
+	MaxUploadBytes int64
+	Limits         imaging.Limits
+}
+
+func (h *AttachmentsHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	processed, ok := readImage(w, r, h.MaxUploadBytes, h.Limits, imaging.PostImageSpec)
+	if !ok {
+		return
+	}
+
+	id := uuid.NewString()
+	img, err := services.PutImage(r.Context(), h.Media, processed, services.PutOptions{
+		Kind:    services.MediaAttachment,
+		OwnerID: id,
+	})
+	if err == nil {
+		err = services.RecordVariants(h.DB, h.Media.Name(), img)
+	}
+	if err != nil {
+		services.DiscardImage(r.Context(), h.DB, h.Media, img)
+		log.Printf("%s upload error: %v", h.Media.Name(), err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_, err = h.DB.Exec(`INSERT INTO attachments(id, uploader_id, path, storage, mime, width, height, blurhash)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, sess.UserID, img.Main.Key, h.Media.Name(), processed.Main.ContentType,
+		processed.Main.Width, processed.Main.Height, img.Blurhash)
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(attachmentView(id, processed.Main.ContentType, processed.Main.Width, processed.Main.Height, img.Blurhash))
+}
+
+// Get streams an attachment (or ?size=medium|thumb) to a viewer of its subject.
+func (h *AttachmentsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var uploaderID, key, storage string
+	var subjectType, subjectID sql.NullString
+	err := h.DB.QueryRow("SELECT uploader_id, subject_type, subject_id, path, storage FROM attachments WHERE id = ?", id).
+		Scan(&uploaderID, &subjectType, &subjectID, &key, &storage)
+	if err != nil || !canViewAttachment(h.DB, sess.UserID, uploaderID, subjectType.String, subjectID.String) {
+		// don't reveal whether the attachment exists
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if storage != h.Media.Name() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	key, err = negotiateMedia(h.DB, storage, key, r.URL.Query().Get("size"), r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("Vary", "Accept")
+	if local, ok := h.Media.(*services.LocalStore); ok {
+		local.ServeKey(w, r, key)
+		return
+	}
+	rc, err := h.Media.Open(r.Context(), key)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", contentTypeOf(key))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = io.Copy(w, rc)
+}
+
+// canViewAttachment applies the visibility of the attachment's subject:
+// conversation participants for direct messages, group members for group
+// messages, and whoever may read the group for group posts. Pending uploads
+// are only visible to their uploader.
+func canViewAttachment(db *sql.DB, userID, uploaderID, subjectType, subjectID string) bool {
+	var ok bool
+	var err error
+	switch subjectType {
+	case "":
+		return userID == uploaderID
+	case subjectDirectMessage:
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM direct_messages WHERE id = ? AND (from_user_id = ? OR to_user_id = ?))",
+			subjectID, userID, userID).Scan(&ok)
+	case subjectGroupMessage:
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_messages m JOIN group_members gm ON gm.group_id = m.group_id
+			WHERE m.id = ? AND gm.user_id = ?)`, subjectID, userID).Scan(&ok)
+	case subjectGroupPost:
+		var gid string
+		if err = db.QueryRow("SELECT group_id FROM group_posts WHERE id = ?", subjectID).Scan(&gid); err == nil {
+			a, aerr := loadGroupAccess(db, gid, userID)
+			ok, err = aerr == nil && a.canRead(), aerr
+		}
+	}
+	return err == nil && ok
+}
+
+// claimAttachments attaches the caller's pending uploads to a subject. Every
+// id must be a pending attachment uploaded by userID.
+func claimAttachments(tx *sql.Tx, ids []string, userID, subjectType, subjectID string) error {
+	if len(ids) > maxAttachments {
+		return errInvalidAttachments
+	}
+	for _, id := range ids {
+		res, err := tx.Exec(`UPDATE attachments SET subject_type = ?, subject_id = ?
+			WHERE id = ? AND uploader_id = ? AND subject_id IS NULL`, subjectType, subjectID, id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return errInvalidAttachments
+		}
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments of the given subjects, keyed by
+// subject id, in upload order.
+func loadAttachments(db *sql.DB, subjectType string, subjectIDs []string) map[string][]websocket.Attachment {
+	out := map[string][]websocket.Attachment{}
+	if len(subjectIDs) == 0 {
+		return out
+	}
+	args := []any{subjectType}
+	for _, id := range subjectIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`SELECT id, subject_id, mime, COALESCE(width, 0), COALESCE(height, 0), COALESCE(blurhash, '')
+		FROM attachments WHERE subject_type = ? AND subject_id IN (?`+strings.Repeat(",?", len(subjectIDs)-1)+`)
+		ORDER BY created_at`, args...)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, subjectID, mime, blurhash string
+		var width, height int
+		if err := rows.Scan(&id, &subjectID, &mime, &width, &height, &blurhash); err == nil {
+			out[subjectID] = append(out[subjectID], attachmentView(id, mime, width, height, blurhash))
+		}
+	}
+	return out
+}
+
+func attachmentView(id, mime string, width, height int, blurhash string) websocket.Attachment {
+	u := "/api/attachments/" + id
+	return websocket.Attachment{
+		ID:       id,
+		URL:      u,
+		ThumbURL: u + "?size=thumb",
+		Mime:     mime,
+		Width:    width,
+		Height:   height,
+		Blurhash: blurhash,
+	}
+}
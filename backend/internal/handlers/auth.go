@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -12,7 +13,8 @@ import (
 )
 
 type AuthHandler struct {
-	DB *sql.DB
+	DB         *sql.DB
+	SessionTTL time.Duration
 }
 
 type registerRequest struct {
@@ -35,6 +37,7 @@ type userResponse struct {
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -64,7 +67,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	_, _ = h.DB.Exec(`INSERT INTO profiles(user_id, public, nickname, about) VALUES(?,?,?,?)`, id, 1, req.Nickname, req.About)
 
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(userResponse{ID: id, Email: req.Email, FirstName: req.FirstName, LastName: req.LastName})
+	_ = json.NewEncoder(w).Encode(userResponse{ID: id, Email: req.Email, FirstName: req.FirstName, LastName: req.LastName, Role: auth.RoleUser})
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -73,8 +76,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	var id, hash, first, last string
-	err := h.DB.QueryRow("SELECT id, password_hash, first_name, last_name FROM users WHERE email = ?", req.Email).Scan(&id, &hash, &first, &last)
+	var id, hash, first, last, role string
+	err := h.DB.QueryRow("SELECT id, password_hash, first_name, last_name, role FROM users WHERE email = ?", req.Email).Scan(&id, &hash, &first, &last, &role)
 	if err != nil {
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
@@ -83,13 +86,17 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
-	sess, err := auth.CreateSession(h.DB, id, 7*24*time.Hour, r.UserAgent(), r.RemoteAddr)
+	sess, err := auth.CreateSession(h.DB, id, h.SessionTTL, r.UserAgent(), r.RemoteAddr)
+	if errors.Is(err, auth.ErrSuspended) {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
-	auth.SetSessionCookie(w, sess)
-	_ = json.NewEncoder(w).Encode(userResponse{ID: id, Email: req.Email, FirstName: first, LastName: last})
+	auth.SetSessionCookie(w, r, sess)
+	_ = json.NewEncoder(w).Encode(userResponse{ID: id, Email: req.Email, FirstName: first, LastName: last, Role: role})
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
@@ -97,7 +104,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	if err == nil && cookie.Value != "" {
 		_ = auth.DeleteSession(h.DB, cookie.Value)
 	}
-	auth.ClearSessionCookie(w)
+	auth.ClearSessionCookie(w, r)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -112,5 +119,16 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	_ = json.NewEncoder(w).Encode(userResponse{ID: sess.UserID, Email: email, FirstName: first, LastName: last})
+	_ = json.NewEncoder(w).Encode(userResponse{ID: sess.UserID, Email: email, FirstName: first, LastName: last, Role: sess.Role})
+}
+
+// CSRFToken issues (or returns the existing) double-submit CSRF token. The
+// frontend must echo it in the X-CSRF-Token header on state-changing requests.
+func (h *AuthHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.IssueCSRFToken(w, r)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"csrf_token": token})
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BlocksHandler manages blocks and mutes. A block works both ways: neither
+// user sees the other's posts, comments or profile, finds them in search,
+// or can message, follow or invite them. A mute is one-sided and only keeps
+// the muted user out of the muter's feed and notifications.
+type BlocksHandler struct{ DB *sql.DB }
+
+// notBlocked is an SQL condition on col, a user ID column, that holds
+// unless the viewer and that user have blocked one another. It takes the
+// viewer's ID twice.
+func notBlocked(col string) string {
+	return col + ` NOT IN (SELECT blocked_user_id FROM user_blocks WHERE blocker_user_id = ?
+		UNION SELECT blocker_user_id FROM user_blocks WHERE blocked_user_id = ?)`
+}
+
+// notMuted is an SQL condition on col that holds unless the viewer muted
+// that user or either blocked the other. It takes the viewer's ID three
+// times.
+func notMuted(col string) string {
+	return col + ` NOT IN (SELECT muted_user_id FROM user_mutes WHERE muter_user_id = ?
+		UNION SELECT blocked_user_id FROM user_blocks WHERE blocker_user_id = ?
+		UNION SELECT blocker_user_id FROM user_blocks WHERE blocked_user_id = ?)`
+}
+
+// isBlocked reports whether either user has blocked the other.
+func isBlocked(db *sql.DB, a, b string) bool {
+	var blocked bool
+	_ = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_blocks
+		WHERE (blocker_user_id = ?1 AND blocked_user_id = ?2) OR (blocker_user_id = ?2 AND blocked_user_id = ?1))`, a, b).Scan(&blocked)
+	return blocked
+}
+
+// otherUser reads the target user of a block or mute from the URL, writing
+// the error response when it names the caller or nobody.
+func (h *BlocksHandler) otherUser(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	target := chi.URLParam(r, "id")
+	if target == userID {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return "", false
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", target).Scan(&exists); err != nil || !exists {
+		http.Error(w, "not found", http.StatusNotFound)
+		return "", false
+	}
+	return target, true
+}
+
+// Block blocks a user: follows both ways end, pending follow requests and
+// group invitations between the two are withdrawn.
+func (h *BlocksHandler) Block(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := h.otherUser(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for _, q := range []string{
+		"INSERT OR IGNORE INTO user_blocks(blocker_user_id, blocked_user_id) VALUES(?1, ?2)",
+		"DELETE FROM user_mutes WHERE muter_user_id = ?1 AND muted_user_id = ?2",
+		`DELETE FROM follows WHERE (follower_user_id = ?1 AND followed_user_id = ?2)
+			OR (follower_user_id = ?2 AND followed_user_id = ?1)`,
+		`DELETE FROM follow_requests WHERE status = 'pending'
+			AND ((from_user_id = ?1 AND to_user_id = ?2) OR (from_user_id = ?2 AND to_user_id = ?1))`,
+		`DELETE FROM group_invitations WHERE status = 'pending'
+			AND ((from_user_id = ?1 AND to_user_id = ?2) OR (from_user_id = ?2 AND to_user_id = ?1))`,
+		`DELETE FROM post_allowed_followers WHERE
+			(follower_user_id = ?2 AND post_id IN (SELECT id FROM posts WHERE user_id = ?1))
+			OR (follower_user_id = ?1 AND post_id IN (SELECT id FROM posts WHERE user_id = ?2))`,
+	} {
+		if _, err := tx.Exec(q, sess.UserID, target); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "blocked"})
+}
+
+// Unblock lifts a block; follows it ended stay ended.
+func (h *BlocksHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM user_blocks WHERE blocker_user_id = ? AND blocked_user_id = ?", sess.UserID, chi.URLParam(r, "id"))
+	if n, err := rowsAffected(res, err); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Mute mutes a user.
+func (h *BlocksHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := h.otherUser(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+	if _, err := h.DB.Exec("INSERT OR IGNORE INTO user_mutes(muter_user_id, muted_user_id) VALUES(?, ?)", sess.UserID, target); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "muted"})
+}
+
+// Unmute lifts a mute.
+func (h *BlocksHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM user_mutes WHERE muter_user_id = ? AND muted_user_id = ?", sess.UserID, chi.URLParam(r, "id"))
+	if n, err := rowsAffected(res, err); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBlocks lists the users the caller blocked.
+func (h *BlocksHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, "SELECT blocked_user_id, created_at FROM user_blocks WHERE blocker_user_id = ? ORDER BY created_at DESC")
+}
+
+// ListMutes lists the users the caller muted.
+func (h *BlocksHandler) ListMutes(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, "SELECT muted_user_id, created_at FROM user_mutes WHERE muter_user_id = ? ORDER BY created_at DESC")
+}
+
+func (h *BlocksHandler) list(w http.ResponseWriter, r *http.Request, query string) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rows, err := h.DB.Query(query, sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	type entry struct {
+		User      websocket.UserSummary `json:"user"`
+		CreatedAt string                `json:"created_at"`
+	}
+	out := []entry{}
+	var ids []string
+	for rows.Next() {
+		var e entry
+		if rows.Scan(&e.User.ID, &e.CreatedAt) == nil {
+			out = append(out, e)
+			ids = append(ids, e.User.ID)
+		}
+	}
+	rows.Close()
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].User = users[out[i].User.ID]
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/ical"
+	"social-network/backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CalendarHandler manages the personal calendar feed: one secret URL per
+// user that calendar apps subscribe to without logging in.
+type CalendarHandler struct{ DB *sql.DB }
+
+// feedHistory is how long past single events stay in the personal feed.
+const feedHistory = 90 * 24 * time.Hour
+
+// eventUID is the stable iCalendar UID of an event and all its occurrences.
+func eventUID(id string) string {
+	return id + "@social-network"
+}
+
+// calendarEvents converts events to VEVENTs: a series with its RRULE and one
+// VEVENT per edited or cancelled occurrence. Occurrences in declined (event
+// ID to occurrence keys) are left out as EXDATEs.
+func calendarEvents(db *sql.DB, events []*groupEvent, declined map[string]map[string]bool) []ical.Event {
+	var out []ical.Event
+	for _, e := range events {
+		s := e.series()
+		ev := ical.Event{
+			UID:         eventUID(e.ID),
+			Sequence:    e.sequence,
+			Stamp:       e.UpdatedAt,
+			Created:     e.CreatedAt,
+			Start:       e.StartsAt,
+			End:         e.EndsAt,
+			Zone:        s.Location(),
+			Summary:     e.Title,
+			Description: e.Description,
+			Location:    e.Location,
+			Cancelled:   e.Cancelled,
+		}
+		if e.Recurrence == "" {
+			out = append(out, ev)
+			continue
+		}
+		if _, err := s.Rule(); err != nil {
+			continue // a rule that no longer parses has no occurrences
+		}
+		overrides, err := services.LoadOccurrenceOverrides(db, e.ID)
+		if err != nil {
+			continue
+		}
+		ev.RRule = e.Recurrence
+		ev.ExDates = append(ev.ExDates, e.ExDates...)
+		for key := range declined[e.ID] {
+			if occ, ok := s.Occurrence(key, overrides); ok {
+				ev.ExDates = append(ev.ExDates, occ.Original)
+			}
+		}
+		out = append(out, ev)
+		keys := make([]string, 0, len(overrides))
+		for key := range overrides {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o := overrides[key]
+			if declined[e.ID][key] {
+				continue
+			}
+			occ, ok := s.Occurrence(key, overrides)
+			if !ok {
+				continue
+			}
+			v := e.at(occ, nil)
+			out = append(out, ical.Event{
+				UID:          ev.UID,
+				Sequence:     e.sequence + o.Sequence,
+				Stamp:        v.UpdatedAt,
+				Created:      e.CreatedAt,
+				Start:        v.StartsAt,
+				End:          v.EndsAt,
+				Zone:         ev.Zone,
+				Summary:      v.Title,
+				Description:  v.Description,
+				Location:     v.Location,
+				RecurrenceID: occ.Original,
+				Cancelled:    v.Cancelled,
+			})
+		}
+	}
+	return out
+}
+
+// writeCalendar sends a calendar as text/calendar.
+func writeCalendar(w http.ResponseWriter, c *ical.Calendar) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	_ = c.Write(w)
+}
+
+// ExportICS returns all events of a group, past and future, as iCalendar
+func (h *GroupEventsHandler) ExportICS(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID := chi.URLParam(r, "id")
+	if !requireGroupRead(w, h.DB, groupID, sess.UserID) {
+		return
+	}
+	var title string
+	if err := h.DB.QueryRow(`SELECT title FROM groups WHERE id = ?`, groupID).Scan(&title); err != nil {
+		http.Error(w, "group not found", http.StatusNotFound)
+		return
+	}
+	rows, err := h.DB.Query(selectGroupEvents+`
+		WHERE ge.group_id = ?
+		GROUP BY ge.id
+		ORDER BY ge.starts_at ASC
+	`, groupID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	var events []*groupEvent
+	for rows.Next() {
+		if e, err := scanGroupEvent(rows); err == nil {
+			events = append(events, e)
+		}
+	}
+	rows.Close()
+	writeCalendar(w, &ical.Calendar{Name: title, Events: calendarEvents(h.DB, events, nil)})
+}
+
+// FeedStatus reports whether the caller has a calendar feed
+func (h *CalendarHandler) FeedStatus(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	var createdAt time.Time
+	var lastUsed sql.NullTime
+	err := h.DB.QueryRow(`SELECT created_at, last_used_at FROM calendar_feeds WHERE user_id = ?`, sess.UserID).
+		Scan(&createdAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		_ = json.NewEncoder(w).Encode(map[string]any{"enabled": false})
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]any{"enabled": true, "created_at": createdAt, "last_used_at": nil}
+	if lastUsed.Valid {
+		resp["last_used_at"] = lastUsed.Time
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// CreateFeed creates the caller's calendar feed, or replaces its URL with a
+// new one; the old URL stops working
+func (h *CalendarHandler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	_, err := h.DB.Exec(`INSERT INTO calendar_feeds(user_id, token_hash) VALUES(?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET token_hash = excluded.token_hash,
+			created_at = CURRENT_TIMESTAMP, last_used_at = NULL`, sess.UserID, auth.HashAccessToken(token))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// the token is only ever shown here
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"token": token, "url": "/api/calendar/" + token + ".ics"})
+}
+
+// DeleteFeed turns the caller's calendar feed off
+func (h *CalendarHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	res, err := h.DB.Exec(`DELETE FROM calendar_feeds WHERE user_id = ?`, sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "calendar feed not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Feed serves a personal calendar feed: the events of every group the user
+// belongs to, without those they answered not going. The token in the URL is
+// the only credential, and stops working while the account is suspended.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	var userID string
+	err := h.DB.QueryRow(`SELECT f.user_id FROM calendar_feeds f JOIN users u ON u.id = f.user_id
+		WHERE f.token_hash = ? AND u.suspended_at IS NULL`,
+		auth.HashAccessToken(chi.URLParam(r, "token"))).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_, _ = h.DB.Exec(`UPDATE calendar_feeds SET last_used_at = CURRENT_TIMESTAMP WHERE user_id = ?`, userID)
+
+	declined := map[string]map[string]bool{}
+	rows, err := h.DB.Query(`SELECT event_id, occurrence FROM group_event_responses
+		WHERE user_id = ? AND response = 'not_going'`, userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var eventID, key string
+		if rows.Scan(&eventID, &key) == nil {
+			if declined[eventID] == nil {
+				declined[eventID] = map[string]bool{}
+			}
+			declined[eventID][key] = true
+		}
+	}
+	rows.Close()
+
+	since := time.Now().Add(-feedHistory).UTC().Format(dbTime)
+	rows, err = h.DB.Query(selectGroupEvents+`
+		JOIN groups g ON g.id = ge.group_id
+		WHERE (g.owner_user_id = ?1 OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?1))
+		AND (ge.rrule IS NOT NULL OR ge.ends_at >= ?2)
+		GROUP BY ge.id
+		ORDER BY ge.starts_at ASC
+	`, userID, since)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	var events []*groupEvent
+	for rows.Next() {
+		e, err := scanGroupEvent(rows)
+		if err != nil || (e.Recurrence == "" && declined[e.ID][""]) {
+			continue
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	writeCalendar(w, &ical.Calendar{Name: "Group events", Events: calendarEvents(h.DB, events, declined)})
+}
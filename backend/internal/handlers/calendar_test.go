@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"social-network/backend/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCalendarFeedClosedWhileSuspended(t *testing.T) {
+	conn := newTestDB(t)
+	for _, q := range []string{
+		`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES('u1', 'u1@x', 'h', 'U', 'One', '2000-01-01')`,
+		`INSERT INTO calendar_feeds(user_id, token_hash) VALUES('u1', '` + auth.HashAccessToken("secret") + `')`,
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	h := &CalendarHandler{DB: conn}
+	r := chi.NewRouter()
+	r.Get("/api/calendar/{token}.ics", h.Feed)
+	get := func() int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/calendar/secret.ics", nil))
+		return rec.Code
+	}
+
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if err := suspendAccount(conn, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(); code != http.StatusNotFound {
+		t.Errorf("suspended: status %d, want 404", code)
+	}
+	if _, err := conn.Exec("UPDATE users SET suspended_at = NULL WHERE id = 'u1'"); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("reinstated: status %d, want 200", code)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -19,9 +20,38 @@ type ChatHandler struct {
 }
 
 type sendMessageReq struct {
-	Content     string `json:"content"`
-	RecipientID string `json:"recipient_id,omitempty"`
-	GroupID     string `json:"group_id,omitempty"`
+	Content       string   `json:"content"`
+	RecipientID   string   `json:"recipient_id,omitempty"`
+	GroupID       string   `json:"group_id,omitempty"`
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
+}
+
+// insertMessage stores a chat message and claims its attachments in one
+// transaction, so a message never points at someone else's upload.
+func insertMessage(db *sql.DB, w http.ResponseWriter, query string, args []any, attachmentIDs []string, userID, subjectType, messageID string) bool {
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return false
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(query, args...); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return false
+	}
+	if err := claimAttachments(tx, attachmentIDs, userID, subjectType, messageID); err != nil {
+		if errors.Is(err, errInvalidAttachments) {
+			http.Error(w, "invalid attachments", http.StatusBadRequest)
+		} else {
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
 }
 
 // SendDirectMessage sends a direct message to another user
@@ -33,7 +63,7 @@ func (h *ChatHandler) SendDirectMessage(w http.ResponseWriter, r *http.Request)
 	}
 
 	var body sendMessageReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Content == "" || body.RecipientID == "" {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Content == "" && len(body.AttachmentIDs) == 0) || body.RecipientID == "" {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
@@ -45,18 +75,20 @@ func (h *ChatHandler) SendDirectMessage(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "recipient not found", http.StatusNotFound)
 		return
 	}
+	if isBlocked(h.DB, sess.UserID, body.RecipientID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
 	messageID := uuid.NewString()
-	createdAt := time.Now().Format("2006-01-02T15:04:05Z")
+	createdAt := time.Now().UTC().Format("2006-01-02T15:04:05Z")
 
 	// Save message to database
-	_, err = h.DB.Exec(`
-		INSERT INTO direct_messages(id, sender_id, recipient_id, content, created_at)
+	if !insertMessage(h.DB, w, `
+		INSERT INTO direct_messages(id, from_user_id, to_user_id, text, created_at)
 		VALUES(?, ?, ?, ?, ?)
-	`, messageID, sess.UserID, body.RecipientID, body.Content, createdAt)
-
-	if err != nil {
-		http.Error(w, "server error", http.StatusInternalServerError)
+	`, []any{messageID, sess.UserID, body.RecipientID, body.Content, createdAt},
+		body.AttachmentIDs, sess.UserID, subjectDirectMessage, messageID) {
 		return
 	}
 
@@ -74,6 +106,8 @@ func (h *ChatHandler) SendDirectMessage(w http.ResponseWriter, r *http.Request)
 		Content:     body.Content,
 		CreatedAt:   createdAt,
 	}
+	message.Attachments = loadAttachments(h.DB, subjectDirectMessage, []string{messageID})[messageID]
+	message.Sender = loadUserSummary(h.DB, sess.UserID, avatarThumb)
 
 	// Send via WebSocket
 	h.Hub.SendMessage(message)
@@ -105,27 +139,28 @@ func (h *ChatHandler) SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 	`, groupID, sess.UserID, groupID, sess.UserID).Scan(&isMember)
 
 	if err != nil || !isMember {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		denyGroupMember(w, h.DB, groupID, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, groupID) {
 		return
 	}
 
 	var body sendMessageReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Content == "" {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Content == "" && len(body.AttachmentIDs) == 0) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
 	messageID := uuid.NewString()
-	createdAt := time.Now().Format("2006-01-02T15:04:05Z")
+	createdAt := time.Now().UTC().Format("2006-01-02T15:04:05Z")
 
 	// Save message to database
-	_, err = h.DB.Exec(`
-		INSERT INTO group_messages(id, group_id, sender_id, content, created_at)
+	if !insertMessage(h.DB, w, `
+		INSERT INTO group_messages(id, group_id, from_user_id, text, created_at)
 		VALUES(?, ?, ?, ?, ?)
-	`, messageID, groupID, sess.UserID, body.Content, createdAt)
-
-	if err != nil {
-		http.Error(w, "server error", http.StatusInternalServerError)
+	`, []any{messageID, groupID, sess.UserID, body.Content, createdAt},
+		body.AttachmentIDs, sess.UserID, subjectGroupMessage, messageID) {
 		return
 	}
 
@@ -143,6 +178,8 @@ func (h *ChatHandler) SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 		Content:    body.Content,
 		CreatedAt:  createdAt,
 	}
+	message.Attachments = loadAttachments(h.DB, subjectGroupMessage, []string{messageID})[messageID]
+	message.Sender = loadUserSummary(h.DB, sess.UserID, avatarThumb)
 
 	// Send via WebSocket
 	h.Hub.SendMessage(message)
@@ -162,12 +199,13 @@ func (h *ChatHandler) ListDirectMessages(w http.ResponseWriter, r *http.Request)
 	otherUserID := chi.URLParam(r, "userId")
 
 	rows, err := h.DB.Query(`
-		SELECT dm.id, dm.sender_id, dm.recipient_id, dm.content, dm.created_at, dm.read_at,
+		SELECT dm.id, dm.from_user_id, dm.to_user_id, dm.text, dm.created_at, dm.read_at,
 		       u.first_name, u.last_name
 		FROM direct_messages dm
-		JOIN users u ON u.id = dm.sender_id
-		WHERE (dm.sender_id = ? AND dm.recipient_id = ?) 
-		   OR (dm.sender_id = ? AND dm.recipient_id = ?)
+		JOIN users u ON u.id = dm.from_user_id
+		WHERE ((dm.from_user_id = ? AND dm.to_user_id = ?) 
+		   OR (dm.from_user_id = ? AND dm.to_user_id = ?))
+		  AND dm.hidden_at IS NULL
 		ORDER BY dm.created_at ASC
 		LIMIT 100
 	`, sess.UserID, otherUserID, otherUserID, sess.UserID)
@@ -187,6 +225,9 @@ func (h *ChatHandler) ListDirectMessages(w http.ResponseWriter, r *http.Request)
 		CreatedAt   string `json:"created_at"`
 		ReadAt      string `json:"read_at"`
 		IsFromMe    bool   `json:"is_from_me"`
+
+		Attachments []websocket.Attachment `json:"attachments"`
+		Sender      websocket.UserSummary  `json:"sender"`
 	}
 
 	var messages []message
@@ -207,6 +248,19 @@ func (h *ChatHandler) ListDirectMessages(w http.ResponseWriter, r *http.Request)
 		messages = append(messages, m)
 	}
 
+	ids := make([]string, len(messages))
+	senderIDs := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		senderIDs[i] = messages[i].SenderID
+	}
+	attachments := loadAttachments(h.DB, subjectDirectMessage, ids)
+	senders := loadUserSummaries(h.DB, senderIDs, avatarSize(r, avatarThumb))
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+		messages[i].Sender = senders[messages[i].SenderID]
+	}
+
 	_ = json.NewEncoder(w).Encode(messages)
 }
 
@@ -233,16 +287,16 @@ func (h *ChatHandler) ListGroupMessages(w http.ResponseWriter, r *http.Request)
 	`, groupID, sess.UserID, groupID, sess.UserID).Scan(&isMember)
 
 	if err != nil || !isMember {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		denyGroupMember(w, h.DB, groupID, sess.UserID)
 		return
 	}
 
 	rows, err := h.DB.Query(`
-		SELECT gm.id, gm.sender_id, gm.content, gm.created_at,
+		SELECT gm.id, gm.from_user_id, gm.text, gm.created_at,
 		       u.first_name, u.last_name
 		FROM group_messages gm
-		JOIN users u ON u.id = gm.sender_id
-		WHERE gm.group_id = ?
+		JOIN users u ON u.id = gm.from_user_id
+		WHERE gm.group_id = ? AND gm.hidden_at IS NULL
 		ORDER BY gm.created_at ASC
 		LIMIT 100
 	`, groupID)
@@ -260,6 +314,9 @@ func (h *ChatHandler) ListGroupMessages(w http.ResponseWriter, r *http.Request)
 		Content    string `json:"content"`
 		CreatedAt  string `json:"created_at"`
 		IsFromMe   bool   `json:"is_from_me"`
+
+		Attachments []websocket.Attachment `json:"attachments"`
+		Sender      websocket.UserSummary  `json:"sender"`
 	}
 
 	var messages []message
@@ -275,6 +332,19 @@ func (h *ChatHandler) ListGroupMessages(w http.ResponseWriter, r *http.Request)
 		messages = append(messages, m)
 	}
 
+	ids := make([]string, len(messages))
+	senderIDs := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		senderIDs[i] = messages[i].SenderID
+	}
+	attachments := loadAttachments(h.DB, subjectGroupMessage, ids)
+	senders := loadUserSummaries(h.DB, senderIDs, avatarSize(r, avatarThumb))
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+		messages[i].Sender = senders[messages[i].SenderID]
+	}
+
 	_ = json.NewEncoder(w).Encode(messages)
 }
 
@@ -292,7 +362,7 @@ func (h *ChatHandler) MarkMessageAsRead(w http.ResponseWriter, r *http.Request)
 	_, err := h.DB.Exec(`
 		UPDATE direct_messages 
 		SET read_at = CURRENT_TIMESTAMP 
-		WHERE id = ? AND recipient_id = ?
+		WHERE id = ? AND to_user_id = ?
 	`, messageID, sess.UserID)
 
 	if err != nil {
@@ -315,20 +385,20 @@ func (h *ChatHandler) GetConversations(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.DB.Query(`
 		SELECT 
 			CASE 
-				WHEN dm.sender_id = ? THEN dm.recipient_id
-				ELSE dm.sender_id
+				WHEN dm.from_user_id = ? THEN dm.to_user_id
+				ELSE dm.from_user_id
 			END as other_user_id,
 			u.first_name, u.last_name,
-			dm.content as last_message,
+			dm.text as last_message,
 			dm.created_at as last_message_time,
-			COUNT(CASE WHEN dm.recipient_id = ? AND dm.read_at IS NULL THEN 1 END) as unread_count
+			COUNT(CASE WHEN dm.to_user_id = ? AND dm.read_at IS NULL THEN 1 END) as unread_count
 		FROM direct_messages dm
 		JOIN users u ON u.id = CASE 
-			WHEN dm.sender_id = ? THEN dm.recipient_id
-			ELSE dm.sender_id
+			WHEN dm.from_user_id = ? THEN dm.to_user_id
+			ELSE dm.from_user_id
 		END
-		WHERE dm.sender_id = ? OR dm.recipient_id = ?
-		GROUP BY other_user_id, u.first_name, u.last_name, dm.content, dm.created_at
+		WHERE (dm.from_user_id = ? OR dm.to_user_id = ?) AND dm.hidden_at IS NULL
+		GROUP BY other_user_id, u.first_name, u.last_name, dm.text, dm.created_at
 		ORDER BY last_message_time DESC
 	`, sess.UserID, sess.UserID, sess.UserID, sess.UserID, sess.UserID)
 
@@ -339,15 +409,17 @@ func (h *ChatHandler) GetConversations(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type conversation struct {
-		UserID          string `json:"user_id"`
-		UserName        string `json:"user_name"`
-		LastMessage     string `json:"last_message"`
-		LastMessageTime string `json:"last_message_time"`
-		UnreadCount     int    `json:"unread_count"`
-		Type            string `json:"type"`
+		UserID          string                `json:"user_id"`
+		UserName        string                `json:"user_name"`
+		LastMessage     string                `json:"last_message"`
+		LastMessageTime string                `json:"last_message_time"`
+		UnreadCount     int                   `json:"unread_count"`
+		Type            string                `json:"type"`
+		User            websocket.UserSummary `json:"user"`
 	}
 
 	var conversations []conversation
+	var userIDs []string
 	for rows.Next() {
 		var c conversation
 		var firstName, lastName string
@@ -356,6 +428,11 @@ func (h *ChatHandler) GetConversations(w http.ResponseWriter, r *http.Request) {
 		c.UserName = firstName + " " + lastName
 		c.Type = "direct"
 		conversations = append(conversations, c)
+		userIDs = append(userIDs, c.UserID)
+	}
+	users := loadUserSummaries(h.DB, userIDs, avatarSize(r, avatarThumb))
+	for i := range conversations {
+		conversations[i].User = users[conversations[i].UserID]
 	}
 
 	_ = json.NewEncoder(w).Encode(conversations)
@@ -4,13 +4,21 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
+// followRequestCooldown is how long a declined requester waits before
+// asking the same user again.
+const followRequestCooldown = 7 * 24 * time.Hour
+
 type FollowHandler struct {
 	DB *sql.DB
 }
@@ -26,6 +34,10 @@ func (h *FollowHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	if isBlocked(h.DB, sess.UserID, toUserID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 	// check target profile public
 	var isPublic int
 	err := h.DB.QueryRow("SELECT public FROM profiles WHERE user_id = ?", toUserID).Scan(&isPublic)
@@ -40,6 +52,34 @@ func (h *FollowHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "followed"})
 		return
 	}
+	var following bool
+	_ = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM follows WHERE follower_user_id = ? AND followed_user_id = ?)", sess.UserID, toUserID).Scan(&following)
+	if following {
+		http.Error(w, "already following", http.StatusConflict)
+		return
+	}
+	// the latest request decides: one pending at a time, and a decline
+	// holds off another ask until the cooldown is over
+	var status string
+	var respondedAt sql.NullTime
+	err = h.DB.QueryRow(`SELECT status, responded_at FROM follow_requests
+		WHERE from_user_id = ? AND to_user_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1`, sess.UserID, toUserID).Scan(&status, &respondedAt)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	case status == "pending":
+		http.Error(w, "request pending", http.StatusConflict)
+		return
+	case status == "declined":
+		// declines from before responded_at existed are past any cooldown
+		if wait := time.Until(respondedAt.Time.Add(followRequestCooldown)); respondedAt.Valid && wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "request declined recently", http.StatusTooManyRequests)
+			return
+		}
+	}
 	// create request pending
 	id := uuid.NewString()
 	_, err = h.DB.Exec("INSERT INTO follow_requests(id, from_user_id, to_user_id, status) VALUES(?,?,?, 'pending')", id, sess.UserID, toUserID)
@@ -66,10 +106,10 @@ func (h *FollowHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	_, _ = h.DB.Exec("INSERT OR IGNORE INTO follows(follower_user_id, followed_user_id) VALUES(?,?)", fromID, toID)
-	_, _ = h.DB.Exec("UPDATE follow_requests SET status = 'accepted' WHERE id = ?", reqID)
-	// notify requester of acceptance
-	_, _ = h.DB.Exec("INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id) VALUES(?,?,?,?,?)", uuid.NewString(), fromID, "follow_accepted", toID, reqID)
+	if err := acceptFollowRequest(h.DB, reqID, fromID, toID); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
 }
@@ -81,7 +121,7 @@ func (h *FollowHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	reqID := chi.URLParam(r, "id")
-	_, err := h.DB.Exec("UPDATE follow_requests SET status = 'declined' WHERE id = ? AND to_user_id = ? AND status = 'pending'", reqID, sess.UserID)
+	_, err := h.DB.Exec("UPDATE follow_requests SET status = 'declined', responded_at = CURRENT_TIMESTAMP WHERE id = ? AND to_user_id = ? AND status = 'pending'", reqID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -90,6 +130,126 @@ func (h *FollowHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "declined"})
 }
 
+// CancelRequest withdraws the caller's own pending request along with the
+// notification it raised.
+func (h *FollowHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	reqID := chi.URLParam(r, "id")
+	n, err := rowsAffected(h.DB.Exec("DELETE FROM follow_requests WHERE id = ? AND from_user_id = ? AND status = 'pending'", reqID, sess.UserID))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	_, _ = h.DB.Exec("DELETE FROM notifications WHERE type = 'follow_request' AND subject_id = ?", reqID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// followRequest is a pending request as listed to either side; User is
+// the other side.
+type followRequest struct {
+	ID        string                `json:"id"`
+	User      websocket.UserSummary `json:"user"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// IncomingRequests lists the requests waiting on the caller, oldest first.
+func (h *FollowHandler) IncomingRequests(w http.ResponseWriter, r *http.Request) {
+	h.listRequests(w, r, "to_user_id", "from_user_id")
+}
+
+// OutgoingRequests lists the caller's requests still waiting on others,
+// newest first.
+func (h *FollowHandler) OutgoingRequests(w http.ResponseWriter, r *http.Request) {
+	h.listRequests(w, r, "from_user_id", "to_user_id")
+}
+
+func (h *FollowHandler) listRequests(w http.ResponseWriter, r *http.Request, self, other string) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	order := "ASC"
+	if self == "from_user_id" {
+		order = "DESC"
+	}
+	limit, offset := pageParams(r, 50, 200)
+	rows, err := h.DB.Query(`SELECT id, `+other+`, created_at FROM follow_requests
+		WHERE `+self+` = ? AND status = 'pending'
+		ORDER BY created_at `+order+`, rowid `+order+` LIMIT ? OFFSET ?`, sess.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []followRequest{}
+	var ids []string
+	for rows.Next() {
+		var fr followRequest
+		if err := rows.Scan(&fr.ID, &fr.User.ID, &fr.CreatedAt); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, fr)
+		ids = append(ids, fr.User.ID)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].User = users[out[i].User.ID]
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// acceptFollowRequest turns a pending request into a follow and lets the
+// requester know.
+func acceptFollowRequest(db services.Execer, reqID, fromID, toID string) error {
+	if _, err := db.Exec("INSERT OR IGNORE INTO follows(follower_user_id, followed_user_id) VALUES(?,?)", fromID, toID); err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE follow_requests SET status = 'accepted', responded_at = CURRENT_TIMESTAMP WHERE id = ?", reqID); err != nil {
+		return err
+	}
+	// notify requester of acceptance
+	_, err := db.Exec("INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id) VALUES(?,?,?,?,?)", uuid.NewString(), fromID, "follow_accepted", toID, reqID)
+	return err
+}
+
+// acceptPendingRequests accepts every request waiting on userID and
+// reports how many there were.
+func acceptPendingRequests(tx *sql.Tx, userID string) (int, error) {
+	rows, err := tx.Query("SELECT id, from_user_id FROM follow_requests WHERE to_user_id = ? AND status = 'pending'", userID)
+	if err != nil {
+		return 0, err
+	}
+	var pending [][2]string
+	for rows.Next() {
+		var id, from string
+		if err := rows.Scan(&id, &from); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, [2]string{id, from})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, p := range pending {
+		if err := acceptFollowRequest(tx, p[0], p[1], userID); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
 func (h *FollowHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -108,10 +268,9 @@ func (h *FollowHandler) ListFollowers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := h.DB.Query(`
-		SELECT u.id, u.first_name, u.last_name, p.nickname 
+		SELECT u.id, u.first_name, u.last_name
 		FROM follows f 
 		JOIN users u ON u.id = f.follower_user_id 
-		LEFT JOIN profiles p ON p.user_id = u.id 
 		WHERE f.followed_user_id = ?`, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -119,18 +278,21 @@ func (h *FollowHandler) ListFollowers(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 	type follower struct {
-		ID        string `json:"id"`
+		websocket.UserSummary
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
-		Nickname  string `json:"nickname"`
 	}
 	var followers []follower
+	var ids []string
 	for rows.Next() {
 		var f follower
-		var nickname sql.NullString
-		_ = rows.Scan(&f.ID, &f.FirstName, &f.LastName, &nickname)
-		f.Nickname = nickname.String
+		_ = rows.Scan(&f.ID, &f.FirstName, &f.LastName)
 		followers = append(followers, f)
+		ids = append(ids, f.ID)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range followers {
+		followers[i].UserSummary = users[followers[i].ID]
 	}
 	// Ensure we always return an array, even if empty
 	if followers == nil {
@@ -146,10 +308,9 @@ func (h *FollowHandler) ListFollowing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := h.DB.Query(`
-		SELECT u.id, u.first_name, u.last_name, p.nickname 
+		SELECT u.id, u.first_name, u.last_name
 		FROM follows f 
 		JOIN users u ON u.id = f.followed_user_id 
-		LEFT JOIN profiles p ON p.user_id = u.id 
 		WHERE f.follower_user_id = ?`, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -157,18 +318,21 @@ func (h *FollowHandler) ListFollowing(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 	type followingUser struct {
-		ID        string `json:"id"`
+		websocket.UserSummary
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
-		Nickname  string `json:"nickname"`
 	}
 	var following []followingUser
+	var ids []string
 	for rows.Next() {
 		var f followingUser
-		var nickname sql.NullString
-		_ = rows.Scan(&f.ID, &f.FirstName, &f.LastName, &nickname)
-		f.Nickname = nickname.String
+		_ = rows.Scan(&f.ID, &f.FirstName, &f.LastName)
 		following = append(following, f)
+		ids = append(ids, f.ID)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range following {
+		following[i].UserSummary = users[following[i].ID]
 	}
 	// Ensure we always return an array, even if empty
 	if following == nil {
@@ -176,3 +340,110 @@ func (h *FollowHandler) ListFollowing(w http.ResponseWriter, r *http.Request) {
 	}
 	_ = json.NewEncoder(w).Encode(following)
 }
+
+// RemoveFollower ends another user's follow of the caller without blocking
+// them; they lose any per-post access the caller gave them and have to ask
+// again to follow a private profile.
+func (h *FollowHandler) RemoveFollower(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	follower := chi.URLParam(r, "userID")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	n, err := rowsAffected(tx.Exec("DELETE FROM follows WHERE follower_user_id = ? AND followed_user_id = ?", follower, sess.UserID))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM post_allowed_followers WHERE follower_user_id = ?
+		AND post_id IN (SELECT id FROM posts WHERE user_id = ?)`, follower, sess.UserID); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// followEntry is a user in someone's followers or following list, with how
+// they relate to the viewer.
+type followEntry struct {
+	websocket.UserSummary
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	FollowedAt  time.Time `json:"followed_at"`
+	IsFollowing bool      `json:"is_following"`
+	FollowsYou  bool      `json:"follows_you"`
+	Mutual      bool      `json:"mutual"`
+}
+
+// UserFollowers lists who follows the user in the URL, newest first, to
+// anyone who may see their profile.
+func (h *FollowHandler) UserFollowers(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, "followed_user_id", "follower_user_id")
+}
+
+// UserFollowing lists who the user in the URL follows, newest first.
+func (h *FollowHandler) UserFollowing(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, "follower_user_id", "followed_user_id")
+}
+
+func (h *FollowHandler) listFollows(w http.ResponseWriter, r *http.Request, self, other string) {
+	viewerID := ""
+	if s, ok := auth.SessionFromContext(r); ok {
+		viewerID = s.UserID
+	}
+	userID := chi.URLParam(r, "id")
+	if !requireProfileRead(w, h.DB, viewerID, userID) {
+		return
+	}
+	limit, offset := pageParams(r, 50, 200)
+	// users blocked either way with the viewer are left out
+	where := `FROM follows f JOIN users u ON u.id = f.` + other + `
+		WHERE f.` + self + ` = ? AND ` + notBlocked("u.id")
+	var total int
+	if err := h.DB.QueryRow("SELECT COUNT(1) "+where, userID, viewerID, viewerID).Scan(&total); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	rows, err := h.DB.Query(`SELECT u.id, u.first_name, u.last_name, f.created_at,
+		EXISTS(SELECT 1 FROM follows x WHERE x.follower_user_id = ? AND x.followed_user_id = u.id),
+		EXISTS(SELECT 1 FROM follows x WHERE x.follower_user_id = u.id AND x.followed_user_id = ?)
+		`+where+` ORDER BY f.created_at DESC, f.rowid DESC LIMIT ? OFFSET ?`,
+		viewerID, viewerID, userID, viewerID, viewerID, limit, offset)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	users := []followEntry{}
+	var ids []string
+	for rows.Next() {
+		var e followEntry
+		if err := rows.Scan(&e.ID, &e.FirstName, &e.LastName, &e.FollowedAt, &e.IsFollowing, &e.FollowsYou); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		e.Mutual = e.IsFollowing && e.FollowsYou
+		users = append(users, e)
+		ids = append(ids, e.ID)
+	}
+	summaries := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range users {
+		users[i].UserSummary = summaries[users[i].ID]
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"users": users, "total": total, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/backend/internal/services"
+
+	"github.com/google/uuid"
+)
+
+// maxEventGuests is how many guests one member may bring.
+const maxEventGuests = 10
+
+// waitlistTime orders the waitlist finer than dbTime.
+const waitlistTime = "2006-01-02 15:04:05.000000"
+
+var (
+	errRSVPClosed = errors.New("responses are closed")
+	errNoSpots    = errors.New("not enough spots left")
+)
+
+// rsvpCounts are the answers to an event or one occurrence of a series.
+type rsvpCounts struct {
+	going, notGoing, maybe int
+	guests                 int // brought by going members
+	waitlisted             int
+}
+
+// setSpotsLeft derives SpotsLeft from the capacity and the going count.
+func (e *groupEvent) setSpotsLeft() {
+	e.SpotsLeft = nil
+	if e.Capacity == nil {
+		return
+	}
+	left := *e.Capacity - e.GoingCount - e.GuestCount
+	if left < 0 {
+		left = 0
+	}
+	e.SpotsLeft = &left
+}
+
+// occurrenceKey is the key answers to the view are stored under.
+func (e *groupEvent) occurrenceKey() string {
+	if e.Occurrence == nil {
+		return ""
+	}
+	return services.OccurrenceKey(*e.Occurrence)
+}
+
+// rsvpClosed reports whether the view's deadline has passed at now.
+func (e *groupEvent) rsvpClosed(now time.Time) bool {
+	return e.RSVPDeadline != nil && now.After(*e.RSVPDeadline)
+}
+
+// withMyResponses fills in userID's own answers to the events, which must
+// all belong to group gid, with their place on the waitlist.
+func withMyResponses(db *sql.DB, gid, userID string, events []*groupEvent) {
+	rows, err := db.Query(`SELECT r.event_id, r.occurrence, r.response, r.guests,
+		CASE WHEN r.response = 'waitlisted' THEN 1 + (SELECT COUNT(*) FROM group_event_responses w
+			WHERE w.event_id = r.event_id AND w.occurrence = r.occurrence AND w.response = 'waitlisted'
+			AND (w.waitlisted_at < r.waitlisted_at OR (w.waitlisted_at = r.waitlisted_at AND w.user_id < r.user_id)))
+		ELSE 0 END
+		FROM group_event_responses r JOIN group_events ge ON ge.id = r.event_id
+		WHERE r.user_id = ? AND ge.group_id = ?`, userID, gid)
+	if err != nil {
+		return
+	}
+	type answer struct {
+		response        string
+		guests, waiting int
+	}
+	mine := map[[2]string]answer{}
+	for rows.Next() {
+		var eventID, key string
+		var a answer
+		if rows.Scan(&eventID, &key, &a.response, &a.guests, &a.waiting) == nil {
+			mine[[2]string{eventID, key}] = a
+		}
+	}
+	rows.Close()
+	for _, e := range events {
+		if a, ok := mine[[2]string{e.ID, e.occurrenceKey()}]; ok {
+			e.MyResponse, e.MyGuests, e.WaitlistPosition = a.response, a.guests, a.waiting
+		}
+	}
+}
+
+// seatsTaken counts the going members of an occurrence and their guests,
+// leaving out userID.
+func seatsTaken(tx *sql.Tx, eventID, key, userID string) (int, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COALESCE(SUM(1 + guests), 0) FROM group_event_responses
+		WHERE event_id = ? AND occurrence = ? AND response = 'going' AND user_id != ?`, eventID, key, userID).Scan(&n)
+	return n, err
+}
+
+// saveResponse stores userID's answer to the occurrence key of e (its view
+// v) and returns the answer stored, which is waitlisted for going when the
+// event is full or others are already waiting, and the members promoted
+// from the waitlist by a seat it gave up. Once the deadline has passed only
+// not_going is taken.
+func saveResponse(tx *sql.Tx, e, v *groupEvent, key, userID, response string, guests int) (string, []string, error) {
+	if v.rsvpClosed(time.Now()) && response != "not_going" {
+		return "", nil, errRSVPClosed
+	}
+	var prev string
+	var waitlistedAt sql.NullTime
+	err := tx.QueryRow(`SELECT response, waitlisted_at FROM group_event_responses
+		WHERE event_id = ? AND occurrence = ? AND user_id = ?`, e.ID, key, userID).Scan(&prev, &waitlistedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+	if response != "going" {
+		guests = 0
+	} else if e.Capacity != nil {
+		taken, err := seatsTaken(tx, e.ID, key, userID)
+		if err != nil {
+			return "", nil, err
+		}
+		var waiting bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_event_responses
+			WHERE event_id = ? AND occurrence = ? AND response = 'waitlisted' AND user_id != ?)`,
+			e.ID, key, userID).Scan(&waiting); err != nil {
+			return "", nil, err
+		}
+		fits := taken+1+guests <= *e.Capacity
+		switch {
+		case prev == "going" && !fits:
+			// someone already going keeps their seat but can't add guests
+			// that don't fit
+			return "", nil, errNoSpots
+		case prev != "going" && (!fits || waiting):
+			response = "waitlisted"
+		}
+	}
+	var at any
+	if response == "waitlisted" {
+		t := time.Now()
+		if prev == "waitlisted" && waitlistedAt.Valid {
+			t = waitlistedAt.Time // keep their place in line
+		}
+		at = t.UTC().Format(waitlistTime)
+	}
+	_, err = tx.Exec(`INSERT INTO group_event_responses(event_id, occurrence, user_id, response, guests, waitlisted_at)
+		VALUES(?, ?, ?, ?, ?, ?)
+		ON CONFLICT(event_id, occurrence, user_id) DO UPDATE SET response = excluded.response, guests = excluded.guests,
+			waitlisted_at = excluded.waitlisted_at, updated_at = CURRENT_TIMESTAMP`,
+		e.ID, key, userID, response, guests, at)
+	if err != nil {
+		return "", nil, err
+	}
+	promoted, err := promoteWaitlist(tx, e.ID, key, e.Capacity)
+	return response, promoted, err
+}
+
+// promoteWaitlist moves members from the waitlist of an occurrence to
+// going, first come first served, for as long as the next party fits, and
+// returns who moved.
+func promoteWaitlist(tx *sql.Tx, eventID, key string, capacity *int) ([]string, error) {
+	taken, err := seatsTaken(tx, eventID, key, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`SELECT user_id, guests FROM group_event_responses
+		WHERE event_id = ? AND occurrence = ? AND response = 'waitlisted'
+		ORDER BY waitlisted_at, user_id`, eventID, key)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []string
+	for rows.Next() {
+		var userID string
+		var guests int
+		if err := rows.Scan(&userID, &guests); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if capacity != nil && taken+1+guests > *capacity {
+			break
+		}
+		taken += 1 + guests
+		promoted = append(promoted, userID)
+	}
+	rows.Close()
+	for _, userID := range promoted {
+		if _, err := tx.Exec(`UPDATE group_event_responses SET response = 'going', waitlisted_at = NULL,
+			updated_at = CURRENT_TIMESTAMP WHERE event_id = ? AND occurrence = ? AND user_id = ?`, eventID, key, userID); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// promoteAllWaitlists promotes on every waitlist of an event, after its
+// capacity changed.
+func promoteAllWaitlists(tx *sql.Tx, eventID string, capacity *int) ([]string, error) {
+	rows, err := tx.Query(`SELECT DISTINCT occurrence FROM group_event_responses
+		WHERE event_id = ? AND response = 'waitlisted'`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if rows.Scan(&key) == nil {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+	var promoted []string
+	for _, key := range keys {
+		p, err := promoteWaitlist(tx, eventID, key, capacity)
+		if err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, p...)
+	}
+	return promoted, nil
+}
+
+// notifyPromoted tells members they got a seat.
+func (h *GroupEventsHandler) notifyPromoted(eventID string, users []string) {
+	for _, userID := range users {
+		_, _ = h.DB.Exec(`INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id)
+			VALUES(?, ?, 'event_waitlist_promoted', NULL, ?)`, uuid.NewString(), userID, eventID)
+	}
+}
@@ -3,10 +3,17 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/rrule"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -14,15 +21,525 @@ import (
 
 type GroupEventsHandler struct{ DB *sql.DB }
 
-type createEventReq struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	EventDate   string `json:"event_date"`
-	Location    string `json:"location"`
+// defaultEventLength is used when an event is created without an end.
+const defaultEventLength = time.Hour
+
+// Events must start and end within these years, which also bounds the work
+// of expanding a series from its first occurrence.
+var (
+	minEventTime = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxEventTime = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// dbTime is how event times are stored: UTC, comparable with CURRENT_TIMESTAMP.
+const dbTime = "2006-01-02 15:04:05"
+
+// ListEvents shows the events starting in a window: by default from a month
+// ago to half a year ahead, never more than a year or MaxOccurrences events
+// at once.
+const (
+	defaultEventsBefore = 30 * 24 * time.Hour
+	defaultEventsAhead  = 180 * 24 * time.Hour
+	maxEventsWindow     = 366 * 24 * time.Hour
+)
+
+// eventReq creates an event or, with only some fields set, edits one. Times
+// are RFC 3339, or local times ("2006-01-02T15:04") in Timezone.
+type eventReq struct {
+	Title        *string   `json:"title"`
+	Description  *string   `json:"description"`
+	Location     *string   `json:"location"`
+	StartsAt     *string   `json:"starts_at"`
+	EndsAt       *string   `json:"ends_at"`
+	EventDate    *string   `json:"event_date"`    // the start, as sent by older clients
+	Timezone     *string   `json:"timezone"`      // IANA name; UTC by default
+	Recurrence   *string   `json:"recurrence"`    // RFC 5545 RRULE; "" stops repeating
+	ExDates      *[]string `json:"exdates"`       // starts of occurrences to leave out
+	Capacity     *int      `json:"capacity"`      // seats for going members and guests; 0 for no limit
+	RSVPDeadline *string   `json:"rsvp_deadline"` // when answers close; "" for at the start
 }
 
 type eventResponseReq struct {
-	Response string `json:"response"`
+	Response   string `json:"response"`
+	Occurrence string `json:"occurrence"` // original start, for repeating events
+	Guests     int    `json:"guests"`     // people coming along, with going
+}
+
+var (
+	errEventTime    = errors.New("invalid event time")
+	errNoOccurrence = errors.New("occurrence not found")
+)
+
+type groupEvent struct {
+	ID            string                 `json:"id"`
+	GroupID       string                 `json:"group_id"`
+	CreatedBy     string                 `json:"created_by"`
+	CreatedByName string                 `json:"created_by_name"`
+	Creator       *websocket.UserSummary `json:"creator,omitempty"`
+	Title         string                 `json:"title"`
+	Description   string                 `json:"description"`
+	Location      string                 `json:"location"`
+	StartsAt      time.Time              `json:"starts_at"`
+	EndsAt        time.Time              `json:"ends_at"`
+	Timezone      string                 `json:"timezone"`
+	LocalStartsAt string                 `json:"local_starts_at"` // wall time in Timezone, for edit forms
+	LocalEndsAt   string                 `json:"local_ends_at"`
+	EventDate     time.Time              `json:"event_date"` // same as StartsAt, for older clients
+	Recurrence    string                 `json:"recurrence,omitempty"`
+	ExDates       []time.Time            `json:"exdates,omitempty"`
+	Occurrence    *time.Time             `json:"occurrence,omitempty"` // original start of this occurrence of a series
+	Edited        bool                   `json:"edited,omitempty"`     // this occurrence differs from the series
+	Cancelled     bool                   `json:"cancelled"`
+	CancelledAt   *time.Time             `json:"cancelled_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	Capacity      *int                   `json:"capacity,omitempty"`
+	SpotsLeft     *int                   `json:"spots_left,omitempty"`
+	RSVPDeadline  *time.Time             `json:"rsvp_deadline,omitempty"` // of this occurrence, for a series
+	GoingCount    int                    `json:"going_count"`
+	GuestCount    int                    `json:"guest_count"` // guests of going members
+	NotGoingCount int                    `json:"not_going_count"`
+	MaybeCount    int                    `json:"maybe_count"`
+	WaitlistCount int                    `json:"waitlist_count"`
+
+	// the caller's own answer
+	MyResponse       string `json:"my_response,omitempty"`
+	MyGuests         int    `json:"my_guests,omitempty"`
+	WaitlistPosition int    `json:"waitlist_position,omitempty"`
+
+	exdates  string // as stored
+	sequence int    // iCalendar SEQUENCE
+}
+
+// the counts are those of single events; occurrences of a series are
+// counted by occurrenceCounts
+const selectGroupEvents = `
+	SELECT ge.id, ge.group_id, COALESCE(ge.created_by, ''), ge.title, ge.description, ge.location,
+	       ge.starts_at, ge.ends_at, ge.timezone, COALESCE(ge.rrule, ''), ge.exdates,
+	       ge.cancelled_at, ge.created_at, ge.updated_at, ge.sequence, ge.capacity, ge.rsvp_deadline,
+	       COUNT(CASE WHEN ger.response = 'going' THEN 1 END),
+	       COUNT(CASE WHEN ger.response = 'not_going' THEN 1 END),
+	       COUNT(CASE WHEN ger.response = 'maybe' THEN 1 END),
+	       COALESCE(SUM(CASE WHEN ger.response = 'going' THEN ger.guests END), 0),
+	       COUNT(CASE WHEN ger.response = 'waitlisted' THEN 1 END)
+	FROM group_events ge
+	LEFT JOIN group_event_responses ger ON ger.event_id = ge.id AND ger.occurrence = ''`
+
+func scanGroupEvent(s interface{ Scan(...any) error }) (*groupEvent, error) {
+	var e groupEvent
+	var cancelledAt, deadline sql.NullTime
+	var capacity sql.NullInt64
+	err := s.Scan(&e.ID, &e.GroupID, &e.CreatedBy, &e.Title, &e.Description, &e.Location,
+		&e.StartsAt, &e.EndsAt, &e.Timezone, &e.Recurrence, &e.exdates,
+		&cancelledAt, &e.CreatedAt, &e.UpdatedAt, &e.sequence, &capacity, &deadline,
+		&e.GoingCount, &e.NotGoingCount, &e.MaybeCount, &e.GuestCount, &e.WaitlistCount)
+	if err != nil {
+		return nil, err
+	}
+	if cancelledAt.Valid {
+		e.Cancelled, e.CancelledAt = true, &cancelledAt.Time
+	}
+	if capacity.Valid {
+		c := int(capacity.Int64)
+		e.Capacity = &c
+	}
+	if deadline.Valid {
+		d := deadline.Time.UTC()
+		e.RSVPDeadline = &d
+	}
+	for _, k := range e.series().ExDateKeys() {
+		if t, err := time.ParseInLocation(dbTime, k, time.UTC); err == nil {
+			e.ExDates = append(e.ExDates, t)
+		}
+	}
+	e.setTimes(e.StartsAt, e.EndsAt)
+	e.setSpotsLeft()
+	return &e, nil
+}
+
+func (e *groupEvent) series() *services.EventSeries {
+	return &services.EventSeries{ID: e.ID, StartsAt: e.StartsAt, EndsAt: e.EndsAt, Timezone: e.Timezone, RRule: e.Recurrence, ExDates: e.exdates}
+}
+
+// setTimes sets the start and end and the fields derived from them.
+func (e *groupEvent) setTimes(start, end time.Time) {
+	e.StartsAt, e.EndsAt, e.EventDate = start.UTC(), end.UTC(), start.UTC()
+	loc := e.series().Location()
+	e.LocalStartsAt = e.StartsAt.In(loc).Format("2006-01-02T15:04")
+	e.LocalEndsAt = e.EndsAt.In(loc).Format("2006-01-02T15:04")
+}
+
+// at returns the view of one occurrence of the series.
+func (e *groupEvent) at(occ services.Occurrence, counts map[string]rsvpCounts) *groupEvent {
+	v := *e
+	original := occ.Original
+	v.Occurrence = &original
+	v.setTimes(occ.StartsAt, occ.EndsAt)
+	if e.RSVPDeadline != nil {
+		d := occ.StartsAt.Add(e.RSVPDeadline.Sub(e.StartsAt)).UTC()
+		v.RSVPDeadline = &d
+	}
+	if o := occ.Override; o != nil {
+		v.Edited = o.Title != nil || o.Description != nil || o.Location != nil || o.StartsAt != nil || o.EndsAt != nil
+		if o.Title != nil {
+			v.Title = *o.Title
+		}
+		if o.Description != nil {
+			v.Description = *o.Description
+		}
+		if o.Location != nil {
+			v.Location = *o.Location
+		}
+		if o.CancelledAt != nil && !v.Cancelled {
+			v.Cancelled, v.CancelledAt = true, o.CancelledAt
+		}
+		if o.UpdatedAt.After(v.UpdatedAt) {
+			v.UpdatedAt = o.UpdatedAt
+		}
+	}
+	c := counts[occ.Key]
+	v.GoingCount, v.NotGoingCount, v.MaybeCount, v.GuestCount, v.WaitlistCount = c.going, c.notGoing, c.maybe, c.guests, c.waitlisted
+	v.setSpotsLeft()
+	return &v
+}
+
+// occurrenceCounts counts the answers to each occurrence of a series.
+func occurrenceCounts(db *sql.DB, eventID string) map[string]rsvpCounts {
+	out := map[string]rsvpCounts{}
+	rows, err := db.Query(`SELECT occurrence,
+		COUNT(CASE WHEN response = 'going' THEN 1 END),
+		COUNT(CASE WHEN response = 'not_going' THEN 1 END),
+		COUNT(CASE WHEN response = 'maybe' THEN 1 END),
+		COALESCE(SUM(CASE WHEN response = 'going' THEN guests END), 0),
+		COUNT(CASE WHEN response = 'waitlisted' THEN 1 END)
+		FROM group_event_responses WHERE event_id = ? GROUP BY occurrence`, eventID)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var c rsvpCounts
+		if rows.Scan(&key, &c.going, &c.notGoing, &c.maybe, &c.guests, &c.waitlisted) == nil {
+			out[key] = c
+		}
+	}
+	return out
+}
+
+// expandEvent returns the occurrences of e starting in [from, to); a
+// single event is its own only occurrence.
+func expandEvent(db *sql.DB, e *groupEvent, from, to time.Time) ([]*groupEvent, error) {
+	if e.Recurrence == "" {
+		if e.StartsAt.Before(from) || !e.StartsAt.Before(to) {
+			return nil, nil
+		}
+		return []*groupEvent{e}, nil
+	}
+	overrides, err := services.LoadOccurrenceOverrides(db, e.ID)
+	if err != nil {
+		return nil, err
+	}
+	occs, err := e.series().Occurrences(overrides, from, to)
+	if err != nil {
+		return nil, err
+	}
+	counts := occurrenceCounts(db, e.ID)
+	out := make([]*groupEvent, len(occs))
+	for i, occ := range occs {
+		out[i] = e.at(occ, counts)
+	}
+	return out, nil
+}
+
+// eventOccurrence resolves an occurrence named by its original start (RFC
+// 3339, or a local time in the event's zone) to its key and view.
+func eventOccurrence(db *sql.DB, e *groupEvent, name string) (string, *groupEvent, error) {
+	if e.Recurrence == "" {
+		return "", nil, errors.New("event does not repeat")
+	}
+	t, err := parseEventTime(name, e.series().Location())
+	if err != nil {
+		return "", nil, errors.New("invalid occurrence")
+	}
+	key := services.OccurrenceKey(t)
+	occ, err := occurrenceByKey(db, e, key)
+	return key, occ, err
+}
+
+// occurrenceByKey returns the view of the occurrence with the given key.
+func occurrenceByKey(db *sql.DB, e *groupEvent, key string) (*groupEvent, error) {
+	overrides, err := services.LoadOccurrenceOverrides(db, e.ID)
+	if err != nil {
+		return nil, err
+	}
+	occ, ok := e.series().Occurrence(key, overrides)
+	if !ok {
+		return nil, errNoOccurrence
+	}
+	return e.at(occ, occurrenceCounts(db, e.ID)), nil
+}
+
+// occurrenceError writes the response for an eventOccurrence error.
+func occurrenceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNoOccurrence) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// withCreators fills in the creator summaries.
+func withCreators(db *sql.DB, events []*groupEvent) {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.CreatedBy)
+	}
+	users := loadUserSummaries(db, ids, avatarThumb)
+	for _, e := range events {
+		if u, ok := users[e.CreatedBy]; ok {
+			e.Creator = &u
+			e.CreatedByName = u.DisplayName
+		}
+	}
+}
+
+// loadGroupEvent reads an event of the group; sql.ErrNoRows when the group
+// has no such event.
+func loadGroupEvent(db *sql.DB, gid, eventID string) (*groupEvent, error) {
+	e, err := scanGroupEvent(db.QueryRow(selectGroupEvents+` WHERE ge.id = ? AND ge.group_id = ? GROUP BY ge.id`, eventID, gid))
+	if err != nil {
+		return nil, err
+	}
+	withCreators(db, []*groupEvent{e})
+	return e, nil
+}
+
+// parseEventTime reads an RFC 3339 time, or a wall time in loc.
+func parseEventTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", dbTime} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errEventTime
+}
+
+// applyEventReq applies the set fields of body to e and validates the result.
+// Changing only the time zone keeps the wall-clock times.
+func applyEventReq(e *groupEvent, body *eventReq) error {
+	if body.Title != nil {
+		e.Title = strings.TrimSpace(*body.Title)
+	}
+	if e.Title == "" {
+		return errors.New("title is required")
+	}
+	if body.Description != nil {
+		e.Description = *body.Description
+	}
+	if body.Location != nil {
+		e.Location = *body.Location
+	}
+	oldStart, oldLoc := e.StartsAt, e.series().Location()
+	loc := oldLoc
+	if body.Timezone != nil {
+		var err error
+		if loc, err = time.LoadLocation(*body.Timezone); err != nil || *body.Timezone == "" || *body.Timezone == "Local" {
+			return errors.New("unknown time zone")
+		}
+		e.Timezone = loc.String()
+	}
+	start, end := body.StartsAt, body.EndsAt
+	if start == nil {
+		start = body.EventDate
+	}
+	length := e.EndsAt.Sub(e.StartsAt)
+	if length <= 0 {
+		length = defaultEventLength
+	}
+	var err error
+	if start != nil {
+		if e.StartsAt, err = parseEventTime(*start, loc); err != nil {
+			return err
+		}
+	} else if !e.StartsAt.IsZero() && loc != oldLoc {
+		e.StartsAt = rezone(e.StartsAt, oldLoc, loc)
+	}
+	if e.StartsAt.IsZero() {
+		return errors.New("starts_at is required")
+	}
+	switch {
+	case end != nil:
+		if e.EndsAt, err = parseEventTime(*end, loc); err != nil {
+			return err
+		}
+	case start != nil || e.EndsAt.IsZero():
+		e.EndsAt = e.StartsAt.Add(length)
+	case loc != oldLoc:
+		e.EndsAt = rezone(e.EndsAt, oldLoc, loc)
+	}
+	if !e.EndsAt.After(e.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if e.StartsAt.Before(minEventTime) || e.EndsAt.After(maxEventTime) {
+		return errors.New("events must take place between 1970 and 2100")
+	}
+	e.setTimes(e.StartsAt, e.EndsAt)
+
+	if body.Capacity != nil {
+		switch c := *body.Capacity; {
+		case c < 0:
+			return errors.New("capacity must not be negative")
+		case c == 0:
+			e.Capacity = nil
+		default:
+			e.Capacity = &c
+		}
+	}
+	// a deadline moves with the start unless it is given
+	switch {
+	case body.RSVPDeadline != nil && *body.RSVPDeadline == "":
+		e.RSVPDeadline = nil
+	case body.RSVPDeadline != nil:
+		d, err := parseEventTime(*body.RSVPDeadline, loc)
+		if err != nil {
+			return errors.New("invalid rsvp_deadline")
+		}
+		e.RSVPDeadline = &d
+	case e.RSVPDeadline != nil && !oldStart.IsZero():
+		d := e.RSVPDeadline.Add(e.StartsAt.Sub(oldStart))
+		e.RSVPDeadline = &d
+	}
+	if e.RSVPDeadline != nil && e.RSVPDeadline.After(e.StartsAt) {
+		return errors.New("rsvp_deadline must not be after starts_at")
+	}
+
+	if body.Recurrence != nil {
+		e.Recurrence = ""
+		if *body.Recurrence != "" {
+			rule, err := rrule.Parse(*body.Recurrence, loc)
+			if err != nil {
+				return err
+			}
+			e.Recurrence = rule.String()
+		}
+	}
+	// moving the series moves the occurrences left out with it
+	if shift := occurrenceShift(oldStart, oldLoc, e.StartsAt, loc); shift != nil && body.ExDates == nil && e.exdates != "" {
+		keys := strings.Split(e.exdates, ",")
+		for i, k := range keys {
+			keys[i] = shift(k)
+		}
+		sort.Strings(keys)
+		e.exdates = strings.Join(keys, ",")
+	}
+	if body.ExDates != nil {
+		var keys []string
+		for _, s := range *body.ExDates {
+			t, err := parseEventTime(s, loc)
+			if err != nil {
+				return errors.New("invalid exdate")
+			}
+			keys = append(keys, services.OccurrenceKey(t))
+		}
+		sort.Strings(keys)
+		e.exdates = strings.Join(keys, ",")
+	}
+	if e.Recurrence == "" {
+		if body.ExDates != nil && len(*body.ExDates) > 0 {
+			return errors.New("exdates need a recurrence")
+		}
+		e.exdates = ""
+	}
+	return nil
+}
+
+// rezone keeps t's wall-clock time in from, moved to the zone to.
+func rezone(t time.Time, from, to *time.Location) time.Time {
+	w := t.In(from)
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, to).UTC()
+}
+
+// occurrenceShift maps the key of an occurrence of a series that started at
+// oldStart to the key it has once the series starts at newStart instead: as
+// many days later, at the new wall-clock time. It is nil when the start did
+// not move.
+func occurrenceShift(oldStart time.Time, oldLoc *time.Location, newStart time.Time, newLoc *time.Location) func(string) string {
+	if oldStart.IsZero() || (oldStart.Equal(newStart) && oldLoc.String() == newLoc.String()) {
+		return nil
+	}
+	was, now := oldStart.In(oldLoc), newStart.In(newLoc)
+	days := int((civilDate(now).Unix() - civilDate(was).Unix()) / 86400)
+	hh, mm, ss := now.Clock()
+	return func(key string) string {
+		t, err := time.Parse(dbTime, key)
+		if err != nil {
+			return key
+		}
+		w := t.In(oldLoc)
+		return services.OccurrenceKey(time.Date(w.Year(), w.Month(), w.Day()+days, hh, mm, ss, 0, newLoc))
+	}
+}
+
+// civilDate is t's calendar date as midnight UTC.
+func civilDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// shiftOccurrences renames the answers to and edits of a series' occurrences
+// with shift. New keys go through a "~" prefix so that none collides with
+// an old one still waiting to be renamed.
+func shiftOccurrences(tx *sql.Tx, eventID string, shift func(string) string) error {
+	for _, table := range []string{"group_event_responses", "group_event_occurrences"} {
+		rows, err := tx.Query("SELECT DISTINCT occurrence FROM "+table+" WHERE event_id = ? AND occurrence != ''", eventID)
+		if err != nil {
+			return err
+		}
+		var keys []string
+		for rows.Next() {
+			var k string
+			if rows.Scan(&k) == nil {
+				keys = append(keys, k)
+			}
+		}
+		rows.Close()
+		for _, k := range keys {
+			if _, err := tx.Exec("UPDATE "+table+" SET occurrence = ? WHERE event_id = ? AND occurrence = ?", "~"+shift(k), eventID, k); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("UPDATE "+table+" SET occurrence = substr(occurrence, 2) WHERE event_id = ? AND occurrence LIKE '~%'", eventID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canManageEvent: the event's creator and the group's moderators and up.
+func canManageEvent(db *sql.DB, e *groupEvent, userID string) bool {
+	role, _ := groupRole(db, e.GroupID, userID)
+	if e.CreatedBy == userID {
+		return role != ""
+	}
+	return roleCan(role, permManageEvents)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(dbTime)
 }
 
 // CreateEvent creates a new group event
@@ -36,120 +553,389 @@ func (h *GroupEventsHandler) CreateEvent(w http.ResponseWriter, r *http.Request)
 	groupID := chi.URLParam(r, "id")
 
 	// Check if user is a member of the group
-	var isMember bool
-	err := h.DB.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM group_members 
-			WHERE group_id = ? AND user_id = ?
-		) OR EXISTS(
-			SELECT 1 FROM groups 
-			WHERE id = ? AND owner_user_id = ?
-		)
-	`, groupID, sess.UserID, groupID, sess.UserID).Scan(&isMember)
-
-	if err != nil || !isMember {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if role, _ := groupRole(h.DB, groupID, sess.UserID); role == "" {
+		denyGroupMember(w, h.DB, groupID, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, groupID) {
 		return
 	}
 
-	var body createEventReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Title == "" || body.EventDate == "" {
+	var body eventReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	e := &groupEvent{ID: uuid.NewString(), GroupID: groupID, CreatedBy: sess.UserID, Timezone: "UTC"}
+	if err := applyEventReq(e, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Parse and validate event date
-	eventDate, err := time.Parse("2006-01-02T15:04", body.EventDate)
+	_, err := h.DB.Exec(`
+		INSERT INTO group_events(id, group_id, created_by, title, description, location, starts_at, ends_at, timezone, rrule, exdates,
+			capacity, rsvp_deadline)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ID, groupID, sess.UserID, e.Title, e.Description, e.Location,
+		e.StartsAt.Format(dbTime), e.EndsAt.Format(dbTime), e.Timezone, nullIfEmpty(e.Recurrence), e.exdates,
+		e.Capacity, nullTime(e.RSVPDeadline))
 	if err != nil {
-		http.Error(w, "invalid date format", http.StatusBadRequest)
+		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	eventID := uuid.NewString()
-	_, err = h.DB.Exec(`
-		INSERT INTO group_events(id, group_id, created_by, title, description, event_date, location)
-		VALUES(?, ?, ?, ?, ?, ?, ?)
-	`, eventID, groupID, sess.UserID, body.Title, body.Description, eventDate.Format("2006-01-02 15:04:05"), body.Location)
+	// Notify group members about the new event
+	h.notifyGroupMembers(groupID, sess.UserID, "group_event_created", e.ID)
 
+	created, err := loadGroupEvent(h.DB, groupID, e.ID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
 
-	// Notify group members about the new event
-	h.notifyGroupMembers(groupID, sess.UserID, "group_event_created", eventID)
+// eventsWindow reads the from and to query parameters (RFC 3339 times or
+// dates).
+func eventsWindow(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	now := time.Now().UTC()
+	from, to := now.Add(-defaultEventsBefore), now.Add(defaultEventsAhead)
+	parse := func(name string, dst *time.Time) error {
+		v := q.Get(name)
+		if v == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				return errors.New("invalid " + name)
+			}
+		}
+		*dst = t.UTC()
+		return nil
+	}
+	if err := parse("from", &from); err != nil {
+		return from, to, err
+	}
+	if q.Get("from") != "" {
+		to = from.Add(defaultEventsBefore + defaultEventsAhead)
+	}
+	if err := parse("to", &to); err != nil {
+		return from, to, err
+	}
+	if !to.After(from) {
+		return from, to, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxEventsWindow {
+		return from, to, errors.New("window is longer than a year")
+	}
+	return from, to, nil
+}
+
+// ListEvents lists the events of a group starting in a window, each
+// occurrence of a repeating event on its own, cancelled ones included, with
+// the caller's own answers
+func (h *GroupEventsHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID := chi.URLParam(r, "id")
+	if !requireGroupRead(w, h.DB, groupID, sess.UserID) {
+		return
+	}
+	from, to, err := eventsWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Return the created event
-	eventData := map[string]interface{}{
-		"ID":          eventID,
-		"GroupID":     groupID,
-		"CreatedBy":   sess.UserID,
-		"Title":       body.Title,
-		"Description": body.Description,
-		"EventDate":   eventDate.Format("2006-01-02T15:04:05Z"),
-		"Location":    body.Location,
-		"CreatedAt":   time.Now().Format("2006-01-02T15:04:05Z"),
+	rows, err := h.DB.Query(selectGroupEvents+`
+		WHERE ge.group_id = ? AND ge.starts_at < ? AND (ge.rrule IS NOT NULL OR ge.starts_at >= ?)
+		GROUP BY ge.id
+		ORDER BY ge.starts_at ASC
+	`, groupID, to.Format(dbTime), from.Format(dbTime))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
 	}
+	var series []*groupEvent
+	for rows.Next() {
+		if e, err := scanGroupEvent(rows); err == nil {
+			series = append(series, e)
+		}
+	}
+	rows.Close()
 
-	_ = json.NewEncoder(w).Encode(eventData)
+	withCreators(h.DB, series)
+	events := []*groupEvent{}
+	for _, e := range series {
+		if occs, err := expandEvent(h.DB, e, from, to); err == nil {
+			events = append(events, occs...)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartsAt.Before(events[j].StartsAt) })
+	// refuse rather than cut the window short where the client can't tell
+	if len(events) > services.MaxOccurrences {
+		http.Error(w, fmt.Sprintf("more than %d events in the window; narrow it with from and to", services.MaxOccurrences), http.StatusBadRequest)
+		return
+	}
+	withMyResponses(h.DB, groupID, sess.UserID, events)
+	_ = json.NewEncoder(w).Encode(events)
 }
 
-// ListEvents lists all events for a group
-func (h *GroupEventsHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+// GetEvent returns one event, or with ?occurrence= one occurrence of a
+// repeating event
+func (h *GroupEventsHandler) GetEvent(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	groupID := chi.URLParam(r, "id")
+	if !requireGroupRead(w, h.DB, groupID, sess.UserID) {
+		return
+	}
+	e, err := loadGroupEvent(h.DB, groupID, chi.URLParam(r, "eventId"))
+	if err != nil {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+	if name := r.URL.Query().Get("occurrence"); name != "" {
+		if _, e, err = eventOccurrence(h.DB, e, name); err != nil {
+			occurrenceError(w, err)
+			return
+		}
+	}
+	withMyResponses(h.DB, groupID, sess.UserID, []*groupEvent{e})
+	_ = json.NewEncoder(w).Encode(e)
+}
 
-	rows, err := h.DB.Query(`
-		SELECT ge.id, ge.group_id, ge.created_by, ge.title, ge.description, 
-		       ge.event_date, ge.location, ge.created_at,
-		       u.first_name, u.last_name,
-		       COUNT(CASE WHEN ger.response = 'going' THEN 1 END) as going_count,
-		       COUNT(CASE WHEN ger.response = 'not_going' THEN 1 END) as not_going_count,
-		       COUNT(CASE WHEN ger.response = 'maybe' THEN 1 END) as maybe_count
-		FROM group_events ge
-		JOIN users u ON u.id = ge.created_by
-		LEFT JOIN group_event_responses ger ON ger.event_id = ge.id
-		WHERE ge.group_id = ?
-		GROUP BY ge.id, ge.group_id, ge.created_by, ge.title, ge.description, 
-		         ge.event_date, ge.location, ge.created_at, u.first_name, u.last_name
-		ORDER BY ge.event_date ASC
-	`, groupID)
+// UpdateEvent edits an event (its creator, or moderators and up) and
+// notifies everyone who responded to it. With ?occurrence= only that
+// occurrence of a repeating event changes.
+func (h *GroupEventsHandler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID := chi.URLParam(r, "id")
+	e, ok := h.manageableEvent(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+	if e.Cancelled {
+		http.Error(w, "event is cancelled", http.StatusConflict)
+		return
+	}
 
+	var body eventReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if name := r.URL.Query().Get("occurrence"); name != "" {
+		h.updateOccurrence(w, e, name, &body, sess.UserID)
+		return
+	}
+	wasRecurring, oldCapacity := e.Recurrence != "", e.Capacity
+	oldStart, oldLoc := e.StartsAt, e.series().Location()
+	if err := applyEventReq(e, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE group_events SET title = ?, description = ?, location = ?, starts_at = ?, ends_at = ?,
+		timezone = ?, rrule = ?, exdates = ?, capacity = ?, rsvp_deadline = ?, sequence = sequence + 1,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		e.Title, e.Description, e.Location, e.StartsAt.Format(dbTime), e.EndsAt.Format(dbTime), e.Timezone,
+		nullIfEmpty(e.Recurrence), e.exdates, e.Capacity, nullTime(e.RSVPDeadline), e.ID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// answers to a single event become answers to the first occurrence of
+	// the series it turns into, and back; those to a moved series move
+	// with its occurrences
+	first := services.OccurrenceKey(e.StartsAt)
+	switch shift := occurrenceShift(oldStart, oldLoc, e.StartsAt, e.series().Location()); {
+	case wasRecurring && e.Recurrence != "" && shift != nil:
+		err = shiftOccurrences(tx, e.ID, shift)
+	case !wasRecurring && e.Recurrence != "":
+		_, err = tx.Exec("UPDATE group_event_responses SET occurrence = ? WHERE event_id = ? AND occurrence = ''", first, e.ID)
+	case wasRecurring && e.Recurrence == "":
+		if _, err = tx.Exec("DELETE FROM group_event_responses WHERE event_id = ? AND occurrence != ?", e.ID, first); err == nil {
+			_, err = tx.Exec("UPDATE group_event_responses SET occurrence = '' WHERE event_id = ?", e.ID)
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM group_event_occurrences WHERE event_id = ?", e.ID)
+		}
+	}
+	// more seats take people off the waitlists; fewer don't cost anyone
+	// theirs
+	var promoted []string
+	if err == nil && (e.Capacity == nil || oldCapacity == nil || *e.Capacity > *oldCapacity) {
+		promoted, err = promoteAllWaitlists(tx, e.ID, e.Capacity)
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.notifyResponders(e.ID, sess.UserID, "group_event_updated")
+	h.notifyPromoted(e.ID, promoted)
 
-	type event struct {
-		ID            string `json:"id"`
-		GroupID       string `json:"group_id"`
-		CreatedBy     string `json:"created_by"`
-		CreatedByName string `json:"created_by_name"`
-		Title         string `json:"title"`
-		Description   string `json:"description"`
-		EventDate     string `json:"event_date"`
-		Location      string `json:"location"`
-		CreatedAt     string `json:"created_at"`
-		GoingCount    int    `json:"going_count"`
-		NotGoingCount int    `json:"not_going_count"`
-		MaybeCount    int    `json:"maybe_count"`
-	}
-
-	var events []event
-	for rows.Next() {
-		var e event
-		var firstName, lastName string
-		_ = rows.Scan(&e.ID, &e.GroupID, &e.CreatedBy, &e.Title, &e.Description,
-			&e.EventDate, &e.Location, &e.CreatedAt, &firstName, &lastName,
-			&e.GoingCount, &e.NotGoingCount, &e.MaybeCount)
-		e.CreatedByName = firstName + " " + lastName
-		events = append(events, e)
+	updated, err := loadGroupEvent(h.DB, groupID, e.ID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
 	}
+	_ = json.NewEncoder(w).Encode(updated)
+}
 
-	_ = json.NewEncoder(w).Encode(events)
+// updateOccurrence edits one occurrence of a series. Only the fields sent
+// become the occurrence's own; the rest follow the series.
+func (h *GroupEventsHandler) updateOccurrence(w http.ResponseWriter, e *groupEvent, name string, body *eventReq, userID string) {
+	if body.Timezone != nil || body.Recurrence != nil || body.ExDates != nil || body.Capacity != nil || body.RSVPDeadline != nil {
+		http.Error(w, "timezone, recurrence, exdates, capacity and rsvp_deadline apply to the whole series", http.StatusBadRequest)
+		return
+	}
+	key, occ, err := eventOccurrence(h.DB, e, name)
+	if err != nil {
+		occurrenceError(w, err)
+		return
+	}
+	if occ.Cancelled {
+		http.Error(w, "occurrence is cancelled", http.StatusConflict)
+		return
+	}
+	if err := applyEventReq(occ, body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var title, desc, location, start, end any
+	if body.Title != nil {
+		title = occ.Title
+	}
+	if body.Description != nil {
+		desc = occ.Description
+	}
+	if body.Location != nil {
+		location = occ.Location
+	}
+	if body.StartsAt != nil || body.EventDate != nil || body.EndsAt != nil {
+		start, end = occ.StartsAt.Format(dbTime), occ.EndsAt.Format(dbTime)
+	}
+	_, err = h.DB.Exec(`INSERT INTO group_event_occurrences(event_id, occurrence, title, description, location, starts_at, ends_at, sequence)
+		VALUES(?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(event_id, occurrence) DO UPDATE SET
+			title = COALESCE(excluded.title, title), description = COALESCE(excluded.description, description),
+			location = COALESCE(excluded.location, location), starts_at = COALESCE(excluded.starts_at, starts_at),
+			ends_at = COALESCE(excluded.ends_at, ends_at), sequence = sequence + 1, updated_at = CURRENT_TIMESTAMP`,
+		e.ID, key, title, desc, location, start, end)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.notifyOccurrenceResponders(e.ID, key, userID, "group_event_updated")
+
+	updated, err := occurrenceByKey(h.DB, e, key)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(updated)
 }
 
-// RespondToEvent handles user responses to events
+// CancelEvent marks an event cancelled (its creator, or moderators and up)
+// and notifies everyone who responded to it. Cancelled events stay listed.
+// With ?occurrence= only that occurrence of a repeating event is cancelled.
+func (h *GroupEventsHandler) CancelEvent(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	e, ok := h.manageableEvent(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+	if e.Cancelled {
+		http.Error(w, "event is cancelled", http.StatusConflict)
+		return
+	}
+	if name := r.URL.Query().Get("occurrence"); name != "" {
+		key, occ, err := eventOccurrence(h.DB, e, name)
+		if err != nil {
+			occurrenceError(w, err)
+			return
+		}
+		if occ.Cancelled {
+			http.Error(w, "occurrence is cancelled", http.StatusConflict)
+			return
+		}
+		_, err = h.DB.Exec(`INSERT INTO group_event_occurrences(event_id, occurrence, cancelled_at, sequence) VALUES(?, ?, CURRENT_TIMESTAMP, 1)
+			ON CONFLICT(event_id, occurrence) DO UPDATE SET cancelled_at = CURRENT_TIMESTAMP, sequence = sequence + 1,
+				updated_at = CURRENT_TIMESTAMP`, e.ID, key)
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		h.notifyOccurrenceResponders(e.ID, key, sess.UserID, "group_event_cancelled")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "cancelled"})
+		return
+	}
+	res, err := h.DB.Exec(`UPDATE group_events SET cancelled_at = CURRENT_TIMESTAMP, sequence = sequence + 1,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ? AND cancelled_at IS NULL`, e.ID)
+	if n, err := rowsAffected(res, err); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "event is cancelled", http.StatusConflict)
+		return
+	}
+	h.notifyResponders(e.ID, sess.UserID, "group_event_cancelled")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "cancelled"})
+}
+
+// manageableEvent loads the event named in the URL for an edit by userID,
+// writing the error response when they may not.
+func (h *GroupEventsHandler) manageableEvent(w http.ResponseWriter, r *http.Request, userID string) (*groupEvent, bool) {
+	groupID := chi.URLParam(r, "id")
+	if groupHidden(h.DB, groupID, userID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	e, err := loadGroupEvent(h.DB, groupID, chi.URLParam(r, "eventId"))
+	if err != nil {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !canManageEvent(h.DB, e, userID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	if rejectArchived(w, h.DB, groupID) {
+		return nil, false
+	}
+	return e, true
+}
+
+// RespondToEvent handles user responses to events; answers to repeating
+// events are per occurrence
 func (h *GroupEventsHandler) RespondToEvent(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -157,24 +943,20 @@ func (h *GroupEventsHandler) RespondToEvent(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	groupID := chi.URLParam(r, "id")
 	eventID := chi.URLParam(r, "eventId")
 
 	// Check if user is a member of the group
-	var groupID string
-	err := h.DB.QueryRow(`
-		SELECT ge.group_id 
-		FROM group_events ge
-		JOIN group_members gm ON gm.group_id = ge.group_id
-		WHERE ge.id = ? AND gm.user_id = ?
-		UNION
-		SELECT ge.group_id 
-		FROM group_events ge
-		JOIN groups g ON g.id = ge.group_id
-		WHERE ge.id = ? AND g.owner_user_id = ?
-	`, eventID, sess.UserID, eventID, sess.UserID).Scan(&groupID)
-
+	if role, _ := groupRole(h.DB, groupID, sess.UserID); role == "" {
+		denyGroupMember(w, h.DB, groupID, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, groupID) {
+		return
+	}
+	e, err := loadGroupEvent(h.DB, groupID, eventID)
 	if err != nil {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		http.Error(w, "event not found", http.StatusNotFound)
 		return
 	}
 
@@ -188,36 +970,91 @@ func (h *GroupEventsHandler) RespondToEvent(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "invalid response", http.StatusBadRequest)
 		return
 	}
+	if body.Guests < 0 || body.Guests > maxEventGuests {
+		http.Error(w, "invalid guests", http.StatusBadRequest)
+		return
+	}
+	series, key := e, ""
+	if e.Recurrence != "" || body.Occurrence != "" {
+		if body.Occurrence == "" {
+			http.Error(w, "occurrence is required", http.StatusBadRequest)
+			return
+		}
+		if key, e, err = eventOccurrence(h.DB, e, body.Occurrence); err != nil {
+			occurrenceError(w, err)
+			return
+		}
+	}
+	if e.Cancelled {
+		http.Error(w, "event is cancelled", http.StatusConflict)
+		return
+	}
 
-	responseID := uuid.NewString()
-	_, err = h.DB.Exec(`
-		INSERT OR REPLACE INTO group_event_responses(id, event_id, user_id, response)
-		VALUES(?, ?, ?, ?)
-	`, responseID, eventID, sess.UserID, body.Response)
-
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	response, promoted, err := saveResponse(tx, series, e, key, sess.UserID, body.Response, body.Guests)
+	if errors.Is(err, errRSVPClosed) || errors.Is(err, errNoSpots) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
 	// Notify event creator about the response
-	h.notifyEventCreator(eventID, sess.UserID, body.Response)
+	h.notifyEventCreator(e, sess.UserID)
+	h.notifyPromoted(eventID, promoted)
 
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	withMyResponses(h.DB, groupID, sess.UserID, []*groupEvent{e})
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "success", "response": response, "waitlist_position": e.WaitlistPosition})
 }
 
-// GetEventResponses gets all responses for an event
+// GetEventResponses gets all responses for an event, or for one occurrence
+// of a repeating event
 func (h *GroupEventsHandler) GetEventResponses(w http.ResponseWriter, r *http.Request) {
-	eventID := chi.URLParam(r, "eventId")
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID := chi.URLParam(r, "id")
+	// who is coming is for members, whoever may read the group
+	if role, _ := groupRole(h.DB, groupID, sess.UserID); role == "" {
+		denyGroupMember(w, h.DB, groupID, sess.UserID)
+		return
+	}
+	e, err := loadGroupEvent(h.DB, groupID, chi.URLParam(r, "eventId"))
+	if err != nil {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+	key := ""
+	if name := r.URL.Query().Get("occurrence"); name != "" || e.Recurrence != "" {
+		if name == "" {
+			http.Error(w, "occurrence is required", http.StatusBadRequest)
+			return
+		}
+		if key, _, err = eventOccurrence(h.DB, e, name); err != nil {
+			occurrenceError(w, err)
+			return
+		}
+	}
 
+	// the waitlist last, in line
 	rows, err := h.DB.Query(`
-		SELECT ger.id, ger.user_id, ger.response, ger.created_at,
-		       u.first_name, u.last_name
-		FROM group_event_responses ger
-		JOIN users u ON u.id = ger.user_id
-		WHERE ger.event_id = ?
-		ORDER BY ger.created_at ASC
-	`, eventID)
+		SELECT user_id, response, guests, created_at, updated_at
+		FROM group_event_responses
+		WHERE event_id = ? AND occurrence = ?
+		ORDER BY response = 'waitlisted', waitlisted_at, created_at ASC
+	`, e.ID, key)
 
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
@@ -226,20 +1063,34 @@ func (h *GroupEventsHandler) GetEventResponses(w http.ResponseWriter, r *http.Re
 	defer rows.Close()
 
 	type response struct {
-		ID        string `json:"id"`
-		UserID    string `json:"user_id"`
-		UserName  string `json:"user_name"`
-		Response  string `json:"response"`
-		CreatedAt string `json:"created_at"`
+		UserID    string                `json:"user_id"`
+		UserName  string                `json:"user_name"`
+		User      websocket.UserSummary `json:"user"`
+		Response  string                `json:"response"`
+		Guests    int                   `json:"guests"`
+		Position  int                   `json:"waitlist_position,omitempty"`
+		CreatedAt string                `json:"created_at"`
+		UpdatedAt string                `json:"updated_at"`
 	}
 
-	var responses []response
+	responses := []response{}
+	var ids []string
+	waiting := 0
 	for rows.Next() {
 		var r response
-		var firstName, lastName string
-		_ = rows.Scan(&r.ID, &r.UserID, &r.Response, &r.CreatedAt, &firstName, &lastName)
-		r.UserName = firstName + " " + lastName
-		responses = append(responses, r)
+		if err := rows.Scan(&r.UserID, &r.Response, &r.Guests, &r.CreatedAt, &r.UpdatedAt); err == nil {
+			if r.Response == "waitlisted" {
+				waiting++
+				r.Position = waiting
+			}
+			responses = append(responses, r)
+			ids = append(ids, r.UserID)
+		}
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range responses {
+		responses[i].User = users[responses[i].UserID]
+		responses[i].UserName = responses[i].User.DisplayName
 	}
 
 	_ = json.NewEncoder(w).Encode(responses)
@@ -257,27 +1108,54 @@ func (h *GroupEventsHandler) notifyGroupMembers(groupID, creatorID, eventType, s
 	if err != nil {
 		return
 	}
-	defer rows.Close()
+	h.notifyAll(rows, eventType, creatorID, subjectID)
+}
+
+// notifyResponders tells everyone who responded to the event, or to any
+// occurrence of it, whatever their answer, except the actor.
+func (h *GroupEventsHandler) notifyResponders(eventID, actorID, eventType string) {
+	rows, err := h.DB.Query("SELECT DISTINCT user_id FROM group_event_responses WHERE event_id = ? AND user_id != ?", eventID, actorID)
+	if err != nil {
+		return
+	}
+	h.notifyAll(rows, eventType, actorID, eventID)
+}
 
+// notifyOccurrenceResponders tells those who responded to one occurrence.
+func (h *GroupEventsHandler) notifyOccurrenceResponders(eventID, key, actorID, eventType string) {
+	rows, err := h.DB.Query("SELECT user_id FROM group_event_responses WHERE event_id = ? AND occurrence = ? AND user_id != ?",
+		eventID, key, actorID)
+	if err != nil {
+		return
+	}
+	h.notifyAll(rows, eventType, actorID, eventID)
+}
+
+// notifyAll notifies the users in rows and closes them.
+func (h *GroupEventsHandler) notifyAll(rows *sql.Rows, eventType, actorID, eventID string) {
+	var users []string
 	for rows.Next() {
 		var userID string
-		_ = rows.Scan(&userID)
-		_, _ = h.DB.Exec(`
-			INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id)
-			VALUES(?, ?, ?, ?, ?)
-		`, uuid.NewString(), userID, eventType, creatorID, subjectID)
+		if rows.Scan(&userID) == nil {
+			users = append(users, userID)
+		}
+	}
+	rows.Close()
+	for _, userID := range users {
+		h.notify(userID, eventType, actorID, eventID)
 	}
 }
 
 // Helper function to notify event creator about responses
-func (h *GroupEventsHandler) notifyEventCreator(eventID, responderID, response string) {
-	var creatorID string
-	_ = h.DB.QueryRow("SELECT created_by FROM group_events WHERE id = ?", eventID).Scan(&creatorID)
-
-	if creatorID != responderID {
-		_, _ = h.DB.Exec(`
-			INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id)
-			VALUES(?, ?, ?, ?, ?)
-		`, uuid.NewString(), creatorID, "event_response", responderID, eventID)
+func (h *GroupEventsHandler) notifyEventCreator(e *groupEvent, responderID string) {
+	if e.CreatedBy != "" && e.CreatedBy != responderID {
+		h.notify(e.CreatedBy, "event_response", responderID, e.ID)
 	}
 }
+
+func (h *GroupEventsHandler) notify(userID, eventType, actorID, eventID string) {
+	_, _ = h.DB.Exec(`
+		INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id)
+		VALUES(?, ?, ?, ?, ?)
+	`, uuid.NewString(), userID, eventType, actorID, eventID)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestApplyEventReqBoundsDates(t *testing.T) {
+	str := func(s string) *string { return &s }
+	for _, tt := range []struct {
+		start, end string
+		ok         bool
+	}{
+		{"2026-10-19T18:00:00Z", "2026-10-19T20:00:00Z", true},
+		{"0001-01-01T00:00:00Z", "0001-01-01T01:00:00Z", false},
+		{"1969-12-31T23:00:00Z", "1970-01-01T01:00:00Z", false},
+		{"2099-12-31T22:00:00Z", "2100-01-01T01:00:00Z", false},
+	} {
+		e := &groupEvent{}
+		err := applyEventReq(e, &eventReq{Title: str("Meetup"), StartsAt: str(tt.start), EndsAt: str(tt.end), Recurrence: str("FREQ=DAILY")})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s to %s: err = %v", tt.start, tt.end, err)
+		}
+	}
+}
+
+func newEventsFixture(t *testing.T) *groupFixture {
+	f := newGroupFixture(t)
+	h := &GroupEventsHandler{DB: f.db}
+	f.router.Post("/api/groups/{id}/events", h.CreateEvent)
+	f.router.Get("/api/groups/{id}/events", h.ListEvents)
+	f.router.Patch("/api/groups/{id}/events/{eventId}", h.UpdateEvent)
+	f.router.Post("/api/groups/{id}/events/{eventId}/respond", h.RespondToEvent)
+	return f
+}
+
+func TestListEventsRefusesTruncation(t *testing.T) {
+	f := newEventsFixture(t)
+	str := func(s string) *string { return &s }
+	for i := 0; i < 2; i++ {
+		body := eventReq{Title: str("Daily"), StartsAt: str("2026-01-01T09:00:00Z"), Recurrence: str("FREQ=DAILY")}
+		if code := f.do("owner", http.MethodPost, "/api/groups/g1/events", body, nil); code != http.StatusCreated && code != http.StatusOK {
+			t.Fatalf("create: status %d", code)
+		}
+	}
+	var events []groupEvent
+	if code := f.do("owner", http.MethodGet, "/api/groups/g1/events?from=2026-01-01&to=2026-06-01", nil, &events); code != http.StatusOK || len(events) != 2*151 {
+		t.Fatalf("five months: status %d, %d events", code, len(events))
+	}
+	// two daily series over a year make 730 occurrences
+	if code := f.do("owner", http.MethodGet, "/api/groups/g1/events?from=2026-01-01&to=2026-12-31", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("a year: status %d, want 400", code)
+	}
+}
+
+func TestUpdateEventMovesOccurrenceKeys(t *testing.T) {
+	f := newEventsFixture(t)
+	f.addMember("bob", "member")
+	str := func(s string) *string { return &s }
+
+	var e groupEvent
+	code := f.do("owner", http.MethodPost, "/api/groups/g1/events", eventReq{
+		Title: str("Weekly"), StartsAt: str("2026-11-02T18:00"), Timezone: str("Europe/Paris"),
+		Recurrence: str("FREQ=WEEKLY;COUNT=5"), ExDates: &[]string{"2026-11-16T18:00"},
+	}, &e)
+	if code >= 300 {
+		t.Fatalf("create: status %d", code)
+	}
+	events := "/api/groups/g1/events/" + e.ID
+	if code := f.do("bob", http.MethodPost, events+"/respond", eventResponseReq{Response: "going", Occurrence: "2026-11-09T18:00"}, nil); code >= 300 {
+		t.Fatalf("respond: status %d", code)
+	}
+	// an edit of the last occurrence
+	f.exec("INSERT INTO group_event_occurrences(event_id, occurrence, title) VALUES(?, '2026-11-30 17:00:00', 'Last one')", e.ID)
+
+	check := func(step string, want []string) {
+		t.Helper()
+		var list []groupEvent
+		if code := f.do("bob", http.MethodGet, "/api/groups/g1/events?from=2026-11-01&to=2026-12-15", nil, &list); code != http.StatusOK {
+			t.Fatalf("%s: list: status %d", step, code)
+		}
+		var got []string
+		for _, o := range list {
+			got = append(got, o.LocalStartsAt)
+			if o.LocalStartsAt == want[1] && (o.GoingCount != 1 || o.MyResponse != "going") {
+				t.Errorf("%s: answered occurrence has %d going, my response %q", step, o.GoingCount, o.MyResponse)
+			}
+			if o.LocalStartsAt == want[len(want)-1] && o.Title != "Last one" {
+				t.Errorf("%s: last occurrence lost its edit", step)
+			}
+		}
+		if !equalStrings(got, want) {
+			t.Errorf("%s: occurrences %v, want %v", step, got, want)
+		}
+	}
+
+	if code := f.do("owner", http.MethodPatch, events, eventReq{StartsAt: str("2026-11-03T19:00")}, nil); code != http.StatusOK {
+		t.Fatalf("move: status %d", code)
+	}
+	check("moved a day later, an hour later", []string{"2026-11-03T19:00", "2026-11-10T19:00", "2026-11-24T19:00", "2026-12-01T19:00"})
+
+	if code := f.do("owner", http.MethodPatch, events, eventReq{Timezone: str("America/New_York")}, nil); code != http.StatusOK {
+		t.Fatalf("rezone: status %d", code)
+	}
+	check("new zone", []string{"2026-11-03T19:00", "2026-11-10T19:00", "2026-11-24T19:00", "2026-12-01T19:00"})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
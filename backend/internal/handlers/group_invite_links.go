@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Invite links expire after a week unless asked otherwise, and after 30
+// days at most.
+const (
+	defaultInviteLinkTTL = 7 * 24 * time.Hour
+	maxInviteLinkTTL     = 30 * 24 * time.Hour
+)
+
+// activeInviteLink matches links that can still be redeemed.
+const activeInviteLink = `revoked_at IS NULL AND (max_uses IS NULL OR uses < max_uses)
+	AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+
+// inviteLinkGranted reports whether a link created by createdBy may still
+// admit people with role: its creator must still be allowed to make links,
+// and to make this one. Links die with their creator's rank.
+func inviteLinkGranted(db *sql.DB, gid, createdBy, role string) bool {
+	creatorRole, _ := groupRole(db, gid, createdBy)
+	return roleCan(creatorRole, permInviteLinks) && (role == roleMember || roleRank[role] < roleRank[creatorRole])
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type createInviteLinkReq struct {
+	Role           string `json:"role"`             // granted on joining; member by default
+	MaxUses        int    `json:"max_uses"`         // 0 = unlimited
+	ExpiresInHours int    `json:"expires_in_hours"` // 0 = a week
+}
+
+type inviteLink struct {
+	ID        string                 `json:"id"`
+	GroupID   string                 `json:"group_id"`
+	Role      string                 `json:"role"`
+	MaxUses   *int                   `json:"max_uses"`
+	Uses      int                    `json:"uses"`
+	ExpiresAt string                 `json:"expires_at"`
+	Revoked   bool                   `json:"revoked"`
+	Active    bool                   `json:"active"`
+	CreatedAt string                 `json:"created_at"`
+	CreatedBy *websocket.UserSummary `json:"created_by,omitempty"`
+	Token     string                 `json:"token,omitempty"` // only in the create response
+}
+
+// CreateInviteLink makes a link anyone can use to join the group. The token
+// is only returned here. A link can't grant the creator's own role or above.
+func (h *GroupsHandler) CreateInviteLink(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	role, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permInviteLinks)
+	if !ok {
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	var body createInviteLinkReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.MaxUses < 0 || body.ExpiresInHours < 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if body.Role == "" {
+		body.Role = roleMember
+	}
+	if body.Role == roleOwner || roleRank[body.Role] == 0 {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+	if body.Role != roleMember && roleRank[body.Role] >= roleRank[role] {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ttl := defaultInviteLinkTTL
+	if body.ExpiresInHours > 0 {
+		ttl = time.Duration(body.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxInviteLinkTTL {
+		http.Error(w, "expiry too far in the future", http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	link := inviteLink{
+		ID:        uuid.NewString(),
+		GroupID:   gid,
+		Role:      body.Role,
+		ExpiresAt: time.Now().Add(ttl).UTC().Format("2006-01-02 15:04:05"),
+		Active:    true,
+		Token:     token,
+	}
+	var maxUses sql.NullInt64
+	if body.MaxUses > 0 {
+		link.MaxUses = &body.MaxUses
+		maxUses = sql.NullInt64{Int64: int64(body.MaxUses), Valid: true}
+	}
+	_, err := h.DB.Exec(`INSERT INTO group_invite_links(id, group_id, token_hash, created_by, role, max_uses, expires_at)
+		VALUES(?,?,?,?,?,?,?)`, link.ID, gid, hashInviteToken(token), sess.UserID, link.Role, maxUses, link.ExpiresAt)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = h.DB.QueryRow("SELECT created_at FROM group_invite_links WHERE id = ?", link.ID).Scan(&link.CreatedAt)
+	link.CreatedBy = loadUserSummary(h.DB, sess.UserID, avatarThumb)
+	auditGroup(h.DB, gid, sess.UserID, "invite_link_created", "", link.ID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(link)
+}
+
+// ListInviteLinks lists the group's links, newest first, without tokens.
+func (h *GroupsHandler) ListInviteLinks(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permInviteLinks); !ok {
+		return
+	}
+	rows, err := h.DB.Query(`SELECT id, role, max_uses, uses, COALESCE(expires_at, ''), revoked_at IS NOT NULL,
+		`+activeInviteLink+`, created_at, COALESCE(created_by, '')
+		FROM group_invite_links WHERE group_id = ? ORDER BY created_at DESC`, gid)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []inviteLink{}
+	var creators, creatorIDs []string
+	for rows.Next() {
+		l := inviteLink{GroupID: gid}
+		var maxUses sql.NullInt64
+		var createdBy string
+		if err := rows.Scan(&l.ID, &l.Role, &maxUses, &l.Uses, &l.ExpiresAt, &l.Revoked, &l.Active, &l.CreatedAt, &createdBy); err != nil {
+			continue
+		}
+		if maxUses.Valid {
+			n := int(maxUses.Int64)
+			l.MaxUses = &n
+		}
+		out = append(out, l)
+		creators = append(creators, createdBy)
+		if createdBy != "" {
+			creatorIDs = append(creatorIDs, createdBy)
+		}
+	}
+	rows.Close()
+	users := loadUserSummaries(h.DB, creatorIDs, avatarThumb)
+	for i := range out {
+		out[i].Active = out[i].Active && inviteLinkGranted(h.DB, gid, creators[i], out[i].Role)
+		if u, ok := users[creators[i]]; ok {
+			out[i].CreatedBy = &u
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// RevokeInviteLink stops a link from being redeemed.
+func (h *GroupsHandler) RevokeInviteLink(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	linkID := chi.URLParam(r, "linkID")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permInviteLinks); !ok {
+		return
+	}
+	res, err := h.DB.Exec("UPDATE group_invite_links SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND group_id = ? AND revoked_at IS NULL",
+		linkID, gid)
+	n, err := rowsAffected(res, err)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	auditGroup(h.DB, gid, sess.UserID, "invite_link_revoked", "", linkID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewInviteLink shows the group a link leads to, so the holder can
+// decide whether to join. Holding a valid link reveals even a secret group.
+func (h *GroupsHandler) PreviewInviteLink(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var gid, role, createdBy, title, desc, avatar string
+	var memberCount int
+	err := h.DB.QueryRow(`SELECT g.id, l.role, COALESCE(l.created_by, ''), g.title, COALESCE(g.description, ''), COALESCE(g.avatar_path, ''),
+		(SELECT COUNT(1) FROM group_members gm WHERE gm.group_id = g.id)
+		FROM group_invite_links l JOIN groups g ON g.id = l.group_id
+		WHERE l.token_hash = ? AND g.archived_at IS NULL AND `+activeInviteLink,
+		hashInviteToken(chi.URLParam(r, "token"))).Scan(&gid, &role, &createdBy, &title, &desc, &avatar, &memberCount)
+	if err != nil || !inviteLinkGranted(h.DB, gid, createdBy, role) {
+		http.Error(w, "invite link not found", http.StatusNotFound)
+		return
+	}
+	viewerRole, _ := groupRole(h.DB, gid, sess.UserID)
+	avatarURL, _ := groupImageURLs(gid, avatar, "")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"group_id":     gid,
+		"title":        title,
+		"description":  desc,
+		"avatar_url":   avatarURL,
+		"member_count": memberCount,
+		"role":         role,
+		"is_member":    viewerRole != "",
+	})
+}
+
+// RedeemInviteLink joins the caller to the link's group with the link's
+// role, using up one of its uses.
+func (h *GroupsHandler) RedeemInviteLink(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var linkID, gid, role, createdBy string
+	err := h.DB.QueryRow("SELECT id, group_id, role, COALESCE(created_by, '') FROM group_invite_links WHERE token_hash = ? AND "+activeInviteLink,
+		hashInviteToken(chi.URLParam(r, "token"))).Scan(&linkID, &gid, &role, &createdBy)
+	if err != nil || !inviteLinkGranted(h.DB, gid, createdBy, role) {
+		http.Error(w, "invite link not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	if isBannedFromGroup(h.DB, gid, sess.UserID) {
+		http.Error(w, "banned from this group", http.StatusForbidden)
+		return
+	}
+	if current, _ := groupRole(h.DB, gid, sess.UserID); current != "" {
+		http.Error(w, "already a member", http.StatusConflict)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	// the use is only counted if the link is still good at this moment
+	res, err := tx.Exec("UPDATE group_invite_links SET uses = uses + 1 WHERE id = ? AND "+activeInviteLink, linkID)
+	if n, err := rowsAffected(res, err); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	} else if n == 0 {
+		http.Error(w, "invite link not found", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO group_members(group_id, user_id, role) VALUES(?,?,?)", gid, sess.UserID, role); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// joining answers any pending invitation or request
+	_, _ = tx.Exec("UPDATE group_invitations SET status = 'accepted' WHERE group_id = ? AND to_user_id = ? AND status = 'pending'", gid, sess.UserID)
+	_, _ = tx.Exec("UPDATE group_requests SET status = 'accepted' WHERE group_id = ? AND user_id = ? AND status = 'pending'", gid, sess.UserID)
+	auditGroup(tx, gid, sess.UserID, "invite_link_redeemed", sess.UserID, linkID)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "joined", "group_id": gid, "role": role})
+}
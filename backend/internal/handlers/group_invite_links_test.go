@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestInviteLinkDiesWithCreatorRank(t *testing.T) {
+	f := newGroupFixture(t)
+	h := &GroupsHandler{DB: f.db}
+	f.router.Get("/api/groups/{id}/invite-links", h.ListInviteLinks)
+	f.router.Post("/api/groups/{id}/invite-links", h.CreateInviteLink)
+	f.router.Get("/api/groups/invite-links/{token}", h.PreviewInviteLink)
+	f.router.Post("/api/groups/invite-links/{token}/redeem", h.RedeemInviteLink)
+	f.addMember("ann", roleAdmin)
+	f.addUser("carl")
+	f.addUser("dora")
+
+	var mod, member inviteLink
+	if code := f.do("ann", http.MethodPost, "/api/groups/g1/invite-links", map[string]any{"role": roleModerator}, &mod); code != http.StatusCreated {
+		t.Fatalf("create moderator link: status %d", code)
+	}
+	if code := f.do("ann", http.MethodPost, "/api/groups/g1/invite-links", map[string]any{"role": roleMember}, &member); code != http.StatusCreated {
+		t.Fatalf("create member link: status %d", code)
+	}
+
+	// demoted to moderator: ann may still make member links, not moderator ones
+	f.exec("UPDATE group_members SET role = ? WHERE group_id = 'g1' AND user_id = 'ann'", roleModerator)
+	if code := f.do("carl", http.MethodGet, "/api/groups/invite-links/"+mod.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("preview moderator link: status %d, want 404", code)
+	}
+	if code := f.do("carl", http.MethodPost, "/api/groups/invite-links/"+mod.Token+"/redeem", nil, nil); code != http.StatusNotFound {
+		t.Errorf("redeem moderator link: status %d, want 404", code)
+	}
+	var links []inviteLink
+	f.do("owner", http.MethodGet, "/api/groups/g1/invite-links", nil, &links)
+	for _, l := range links {
+		if want := l.ID == member.ID; l.Active != want {
+			t.Errorf("%s link active = %v, want %v", l.Role, l.Active, want)
+		}
+	}
+	if code := f.do("carl", http.MethodPost, "/api/groups/invite-links/"+member.Token+"/redeem", nil, nil); code != http.StatusOK {
+		t.Errorf("redeem member link: status %d, want 200", code)
+	}
+
+	// gone from the group: none of ann's links work
+	f.exec("DELETE FROM group_members WHERE group_id = 'g1' AND user_id = 'ann'")
+	if code := f.do("dora", http.MethodPost, "/api/groups/invite-links/"+member.Token+"/redeem", nil, nil); code != http.StatusNotFound {
+		t.Errorf("redeem member link of a former member: status %d, want 404", code)
+	}
+	var role string
+	_ = f.db.QueryRow("SELECT role FROM group_members WHERE group_id = 'g1' AND user_id = 'carl'").Scan(&role)
+	if role != roleMember {
+		t.Errorf("carl joined as %q", role)
+	}
+}
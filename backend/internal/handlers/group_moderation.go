@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Group roles, from least to most privileged.
+const (
+	roleMember    = "member"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+	roleOwner     = "owner"
+)
+
+var roleRank = map[string]int{roleMember: 1, roleModerator: 2, roleAdmin: 3, roleOwner: 4}
+
+type groupPermission string
+
+const (
+	permManageRequests groupPermission = "manage_requests" // accept or decline join requests
+	permKick           groupPermission = "kick"
+	permBan            groupPermission = "ban"
+	permAssignRoles    groupPermission = "assign_roles"
+	permViewAudit      groupPermission = "view_audit"
+	permTransfer       groupPermission = "transfer_ownership"
+	permEditGroup      groupPermission = "edit_group" // title, description, avatar and cover
+	permArchive        groupPermission = "archive"
+	permDelete         groupPermission = "delete"
+	permInviteLinks    groupPermission = "invite_links"  // create, list and revoke invite links
+	permManageEvents   groupPermission = "manage_events" // edit and cancel anyone's events
+	permReports        groupPermission = "reports"       // work the group's report queue
+)
+
+// groupPermissions is the least role each permission needs. Acting on
+// another member also requires outranking them.
+var groupPermissions = map[groupPermission]string{
+	permManageRequests: roleModerator,
+	permKick:           roleModerator,
+	permBan:            roleAdmin,
+	permAssignRoles:    roleAdmin,
+	permViewAudit:      roleAdmin,
+	permTransfer:       roleOwner,
+	permEditGroup:      roleAdmin,
+	permArchive:        roleOwner,
+	permDelete:         roleOwner,
+	permInviteLinks:    roleModerator,
+	permManageEvents:   roleModerator,
+	permReports:        roleAdmin,
+}
+
+func roleCan(role string, p groupPermission) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[groupPermissions[p]]
+}
+
+// rolePermissions lists what role may do, for clients deciding which
+// controls to show.
+func rolePermissions(role string) []groupPermission {
+	out := []groupPermission{}
+	for _, p := range []groupPermission{permManageRequests, permKick, permBan, permAssignRoles, permViewAudit, permTransfer, permEditGroup, permArchive, permDelete, permInviteLinks, permManageEvents, permReports} {
+		if roleCan(role, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// groupRole returns userID's role in the group, or "" for non-members. The
+// error is sql.ErrNoRows when the group doesn't exist.
+func groupRole(db *sql.DB, gid, userID string) (string, error) {
+	var role sql.NullString
+	err := db.QueryRow(`SELECT CASE WHEN g.owner_user_id = ?1 THEN 'owner' ELSE gm.role END
+		FROM groups g LEFT JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = ?1
+		WHERE g.id = ?2`, userID, gid).Scan(&role)
+	return role.String, err
+}
+
+// requireGroupPermission writes 404 or 403 and returns ok=false unless userID
+// holds p in the group. Secret groups are 404 to non-members.
+func requireGroupPermission(w http.ResponseWriter, db *sql.DB, gid, userID string, p groupPermission) (role string, ok bool) {
+	role, err := groupRole(db, gid, userID)
+	if err != nil {
+		http.Error(w, "group not found", http.StatusNotFound)
+		return "", false
+	}
+	if !roleCan(role, p) {
+		if role == "" {
+			denyGroupMember(w, db, gid, userID)
+		} else {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+		return "", false
+	}
+	return role, true
+}
+
+func isBannedFromGroup(db *sql.DB, gid, userID string) bool {
+	var banned bool
+	_ = db.QueryRow("SELECT EXISTS(SELECT 1 FROM group_bans WHERE group_id = ? AND user_id = ?)", gid, userID).Scan(&banned)
+	return banned
+}
+
+// auditGroup records a membership or moderation action.
+func auditGroup(db services.Execer, gid, actorID, action, targetID, details string) {
+	_, _ = db.Exec("INSERT INTO group_audit_log(id, group_id, actor_user_id, action, target_user_id, details) VALUES(?,?,?,?,?,?)",
+		uuid.NewString(), gid, actorID, action, sql.NullString{String: targetID, Valid: targetID != ""}, details)
+}
+
+func notifyGroupMember(db services.Execer, userID, typ, actorID, gid string) {
+	_, _ = db.Exec("INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id) VALUES(?,?,?,?,?)", uuid.NewString(), userID, typ, actorID, gid)
+}
+
+// Leave removes the caller from the group. The owner has to transfer
+// ownership first.
+func (h *GroupsHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	role, err := groupRole(h.DB, gid, sess.UserID)
+	if err != nil || role == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if role == roleOwner {
+		http.Error(w, "transfer ownership before leaving", http.StatusConflict)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	auditGroup(h.DB, gid, sess.UserID, "leave", sess.UserID, "")
+	h.Hub.LeaveGroup(gid, sess.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Kick removes a lower-ranked member. They may ask to join again.
+func (h *GroupsHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	target := chi.URLParam(r, "userID")
+	role, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permKick)
+	if !ok {
+		return
+	}
+	targetRole, _ := groupRole(h.DB, gid, target)
+	if targetRole == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if roleRank[targetRole] >= roleRank[role] {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", gid, target); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	auditGroup(h.DB, gid, sess.UserID, "kick", target, "")
+	notifyGroupMember(h.DB, target, "group_removed", sess.UserID, gid)
+	h.Hub.LeaveGroup(gid, target)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type banReq struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// Ban removes a user (member or not) and keeps them from requesting to
+// join, being invited or accepting an invitation until unbanned.
+func (h *GroupsHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	role, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permBan)
+	if !ok {
+		return
+	}
+	var body banReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" || body.UserID == sess.UserID {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", body.UserID).Scan(&exists); err != nil || !exists {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if targetRole, _ := groupRole(h.DB, gid, body.UserID); targetRole != "" && roleRank[targetRole] >= roleRank[role] {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := banFromGroup(tx, gid, sess.UserID, body.UserID, body.Reason); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.LeaveGroup(gid, body.UserID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "banned"})
+}
+
+// banFromGroup bans userID from the group, ending their membership and
+// declining their pending requests and invitations.
+func banFromGroup(tx *sql.Tx, gid, actorID, userID, reason string) error {
+	if _, err := tx.Exec("INSERT OR REPLACE INTO group_bans(group_id, user_id, banned_by, reason) VALUES(?,?,?,?)",
+		gid, userID, actorID, reason); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", gid, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE group_requests SET status = 'declined' WHERE group_id = ? AND user_id = ? AND status = 'pending'", gid, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE group_invitations SET status = 'declined' WHERE group_id = ? AND to_user_id = ? AND status = 'pending'", gid, userID); err != nil {
+		return err
+	}
+	auditGroup(tx, gid, actorID, "ban", userID, reason)
+	notifyGroupMember(tx, userID, "group_banned", actorID, gid)
+	return nil
+}
+
+func (h *GroupsHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	target := chi.URLParam(r, "userID")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permBan); !ok {
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM group_bans WHERE group_id = ? AND user_id = ?", gid, target)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	auditGroup(h.DB, gid, sess.UserID, "unban", target, "")
+	notifyGroupMember(h.DB, target, "group_unbanned", sess.UserID, gid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GroupsHandler) ListBans(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permBan); !ok {
+		return
+	}
+	rows, err := h.DB.Query(`SELECT user_id, COALESCE(banned_by, ''), COALESCE(reason, ''), created_at
+		FROM group_bans WHERE group_id = ? ORDER BY created_at DESC`, gid)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type ban struct {
+		UserID    string                 `json:"user_id"`
+		BannedBy  string                 `json:"banned_by"`
+		Reason    string                 `json:"reason"`
+		CreatedAt string                 `json:"created_at"`
+		User      websocket.UserSummary  `json:"user"`
+		Moderator *websocket.UserSummary `json:"moderator,omitempty"`
+	}
+	out := []ban{}
+	var ids []string
+	for rows.Next() {
+		var b ban
+		_ = rows.Scan(&b.UserID, &b.BannedBy, &b.Reason, &b.CreatedAt)
+		out = append(out, b)
+		ids = append(ids, b.UserID, b.BannedBy)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].User = users[out[i].UserID]
+		if m, ok := users[out[i].BannedBy]; ok {
+			out[i].Moderator = &m
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+type roleReq struct {
+	Role string `json:"role"`
+}
+
+// SetRole promotes or demotes a member. Both the member's current and new
+// role must rank below the caller's; ownership moves only via Transfer.
+func (h *GroupsHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	target := chi.URLParam(r, "userID")
+	role, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permAssignRoles)
+	if !ok {
+		return
+	}
+	var body roleReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || roleRank[body.Role] == 0 || body.Role == roleOwner {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	targetRole, _ := groupRole(h.DB, gid, target)
+	if targetRole == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if roleRank[targetRole] >= roleRank[role] || roleRank[body.Role] >= roleRank[role] {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if body.Role != targetRole {
+		if _, err := h.DB.Exec("UPDATE group_members SET role = ? WHERE group_id = ? AND user_id = ?", body.Role, gid, target); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		auditGroup(h.DB, gid, sess.UserID, "role_change", target, targetRole+" -> "+body.Role)
+		notifyGroupMember(h.DB, target, "group_role_changed", sess.UserID, gid)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"user_id": target, "role": body.Role})
+}
+
+type transferReq struct {
+	UserID string `json:"user_id"`
+}
+
+// TransferOwnership hands the group to another member; the previous owner
+// stays on as an admin.
+func (h *GroupsHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permTransfer); !ok {
+		return
+	}
+	var body transferReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" || body.UserID == sess.UserID {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if targetRole, _ := groupRole(h.DB, gid, body.UserID); targetRole == "" {
+		http.Error(w, "new owner must be a member", http.StatusBadRequest)
+		return
+	}
+
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE groups SET owner_user_id = ? WHERE id = ?", body.UserID, gid); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE group_members SET role = 'owner' WHERE group_id = ? AND user_id = ?", gid, body.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE group_members SET role = 'admin' WHERE group_id = ? AND user_id = ?", gid, sess.UserID); err != nil {
+			return err
+		}
+		auditGroup(tx, gid, sess.UserID, "transfer_ownership", body.UserID, "")
+		notifyGroupMember(tx, body.UserID, "group_ownership_transferred", sess.UserID, gid)
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"owner_user_id": body.UserID})
+}
+
+// AuditLog lists the group's most recent membership and moderation actions.
+func (h *GroupsHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permViewAudit); !ok {
+		return
+	}
+	rows, err := h.DB.Query(`SELECT id, COALESCE(actor_user_id, ''), action, COALESCE(target_user_id, ''), COALESCE(details, ''), created_at
+		FROM group_audit_log WHERE group_id = ? ORDER BY created_at DESC LIMIT 100`, gid)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type entry struct {
+		ID        string                 `json:"id"`
+		Action    string                 `json:"action"`
+		Details   string                 `json:"details,omitempty"`
+		CreatedAt string                 `json:"created_at"`
+		ActorID   string                 `json:"actor_user_id"`
+		TargetID  string                 `json:"target_user_id,omitempty"`
+		Actor     *websocket.UserSummary `json:"actor,omitempty"`
+		Target    *websocket.UserSummary `json:"target,omitempty"`
+	}
+	out := []entry{}
+	var ids []string
+	for rows.Next() {
+		var e entry
+		_ = rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetID, &e.Details, &e.CreatedAt)
+		out = append(out, e)
+		ids = append(ids, e.ActorID, e.TargetID)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		if u, ok := users[out[i].ActorID]; ok {
+			out[i].Actor = &u
+		}
+		if u, ok := users[out[i].TargetID]; ok {
+			out[i].Target = &u
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/imaging"
+	"social-network/backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// groupImage describes one of a group's images: the columns holding it and
+// how uploads are cut.
+type groupImage struct {
+	name, pathColumn, storageColumn string
+	spec                            imaging.Spec
+}
+
+var (
+	groupAvatar = groupImage{"avatar", "avatar_path", "avatar_storage", imaging.AvatarSpec}
+	groupCover  = groupImage{"cover", "cover_path", "cover_storage", imaging.CoverSpec}
+)
+
+const maxGroupTitle = 100
+
+// groupArchived reports whether the group is archived and so read-only.
+func groupArchived(db *sql.DB, gid string) bool {
+	var archived bool
+	_ = db.QueryRow("SELECT archived_at IS NOT NULL FROM groups WHERE id = ?", gid).Scan(&archived)
+	return archived
+}
+
+// rejectArchived writes 403 and returns true when the group is archived.
+func rejectArchived(w http.ResponseWriter, db *sql.DB, gid string) bool {
+	if groupArchived(db, gid) {
+		http.Error(w, "group is archived", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// groupImageURLs returns the avatar URL, which falls back to the title's
+// initials, and the cover URL, which is empty without a cover.
+func groupImageURLs(gid, avatarKey, coverKey string) (avatar, cover string) {
+	base := "/api/groups/" + url.PathEscape(gid)
+	avatar = base + "/avatar"
+	if avatarKey != "" {
+		avatar += "?v=" + avatarVersion(avatarKey)
+	}
+	if coverKey != "" {
+		cover = base + "/cover?v=" + avatarVersion(coverKey)
+	}
+	return avatar, cover
+}
+
+type updateGroupReq struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Visibility  *string `json:"visibility"`
+	JoinPolicy  *string `json:"join_policy"`
+}
+
+// UpdateGroup changes the title, description, visibility or join policy
+// (admins and the owner).
+func (h *GroupsHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permEditGroup); !ok {
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	var body updateGroupReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+		(body.Title == nil && body.Description == nil && body.Visibility == nil && body.JoinPolicy == nil) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var changed []string
+	if body.Title != nil {
+		title := strings.TrimSpace(*body.Title)
+		if title == "" || len(title) > maxGroupTitle {
+			http.Error(w, "invalid title", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.DB.Exec("UPDATE groups SET title = ? WHERE id = ?", title, gid); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		changed = append(changed, "title")
+	}
+	if body.Description != nil {
+		if _, err := h.DB.Exec("UPDATE groups SET description = ? WHERE id = ?", *body.Description, gid); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		changed = append(changed, "description")
+	}
+	if body.Visibility != nil || body.JoinPolicy != nil {
+		var visibility, joinPolicy string
+		if err := h.DB.QueryRow("SELECT visibility, join_policy FROM groups WHERE id = ?", gid).Scan(&visibility, &joinPolicy); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		if body.Visibility != nil {
+			visibility = *body.Visibility
+		}
+		if body.JoinPolicy != nil {
+			joinPolicy = *body.JoinPolicy
+		}
+		visibility, joinPolicy, ok := groupSettings(visibility, joinPolicy)
+		if !ok {
+			http.Error(w, "invalid visibility or join policy", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.DB.Exec("UPDATE groups SET visibility = ?, join_policy = ? WHERE id = ?", visibility, joinPolicy, gid); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		changed = append(changed, "visibility="+visibility, "join_policy="+joinPolicy)
+	}
+	auditGroup(h.DB, gid, sess.UserID, "group_updated", "", strings.Join(changed, ","))
+	h.GetGroup(w, r)
+}
+
+// Archive makes the group read-only and hides it from the group list.
+func (h *GroupsHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// Unarchive reopens an archived group.
+func (h *GroupsHandler) Unarchive(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+func (h *GroupsHandler) setArchived(w http.ResponseWriter, r *http.Request, archive bool) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permArchive); !ok {
+		return
+	}
+	query, action := "UPDATE groups SET archived_at = CURRENT_TIMESTAMP WHERE id = ? AND archived_at IS NULL", "group_archived"
+	if !archive {
+		query, action = "UPDATE groups SET archived_at = NULL WHERE id = ? AND archived_at IS NOT NULL", "group_unarchived"
+	}
+	res, err := h.DB.Exec(query, gid)
+	n, err := rowsAffected(res, err)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n > 0 {
+		auditGroup(h.DB, gid, sess.UserID, action, "", "")
+	}
+	_ = json.NewEncoder(w).Encode(map[string]bool{"archived": archive})
+}
+
+// DeleteGroup removes the group with everything in it (owner only). Members,
+// posts, messages, events and attachments go with the row; stored images are
+// deleted once the row is gone.
+func (h *GroupsHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permDelete); !ok {
+		return
+	}
+
+	type storedKey struct{ storage, key string }
+	var media []storedKey
+	rows, err := h.DB.Query(`
+		SELECT avatar_storage, avatar_path FROM groups WHERE id = ?1 AND avatar_path IS NOT NULL
+		UNION ALL SELECT cover_storage, cover_path FROM groups WHERE id = ?1 AND cover_path IS NOT NULL
+		UNION ALL SELECT a.storage, a.path FROM attachments a JOIN group_posts p ON p.id = a.subject_id
+			WHERE a.subject_type = 'group_post' AND p.group_id = ?1
+		UNION ALL SELECT a.storage, a.path FROM attachments a JOIN group_messages m ON m.id = a.subject_id
+			WHERE a.subject_type = 'group_message' AND m.group_id = ?1`, gid)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var k storedKey
+		if rows.Scan(&k.storage, &k.key) == nil {
+			media = append(media, k)
+		}
+	}
+	rows.Close()
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	// notifications point at the group and its events without a foreign key
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE (subject_id = ?1 AND type LIKE 'group_%')
+		OR subject_id IN (SELECT id FROM group_events WHERE group_id = ?1)`, gid); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM groups WHERE id = ?", gid); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.CloseGroup(gid)
+
+	for _, m := range media {
+		store := h.Stores[m.storage]
+		if store == nil {
+			continue
+		}
+		if err := services.DeleteImage(r.Context(), h.DB, store, m.key); err != nil {
+			log.Printf("delete group media %s: %v", m.key, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadAvatar replaces the group's avatar (admins and the owner).
+func (h *GroupsHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	h.uploadImage(w, r, groupAvatar)
+}
+
+// UploadCover replaces the group's cover image (admins and the owner).
+func (h *GroupsHandler) UploadCover(w http.ResponseWriter, r *http.Request) {
+	h.uploadImage(w, r, groupCover)
+}
+
+func (h *GroupsHandler) uploadImage(w http.ResponseWriter, r *http.Request, gi groupImage) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permEditGroup); !ok {
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	processed, ok := readImage(w, r, h.MaxUploadBytes, h.Limits, gi.spec)
+	if !ok {
+		return
+	}
+
+	img, err := services.PutImage(r.Context(), h.Media, processed, services.PutOptions{
+		Kind:    services.MediaGroupImage,
+		OwnerID: gid,
+	})
+	if err == nil {
+		err = services.RecordVariants(h.DB, h.Media.Name(), img)
+	}
+	if err != nil {
+		services.DiscardImage(r.Context(), h.DB, h.Media, img)
+		log.Printf("%s upload error: %v", h.Media.Name(), err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	var oldKey, oldStorage sql.NullString
+	_ = h.DB.QueryRow("SELECT "+gi.pathColumn+", "+gi.storageColumn+" FROM groups WHERE id = ?", gid).Scan(&oldKey, &oldStorage)
+	_, err = h.DB.Exec("UPDATE groups SET "+gi.pathColumn+" = ?, "+gi.storageColumn+" = ? WHERE id = ?",
+		img.Main.Key, h.Media.Name(), gid)
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if oldKey.Valid && oldKey.String != img.Main.Key {
+		if store := h.Stores[oldStorage.String]; store != nil {
+			if err := services.DeleteImage(r.Context(), h.DB, store, oldKey.String); err != nil {
+				log.Printf("delete group media %s: %v", oldKey.String, err)
+			}
+		}
+	}
+	auditGroup(h.DB, gid, sess.UserID, "group_"+gi.name+"_changed", "", "")
+
+	out := map[string]any{
+		"width":  img.Main.Width,
+		"height": img.Main.Height,
+		"format": img.Main.Format,
+	}
+	if gi.name == groupAvatar.name {
+		out["avatar_url"], _ = groupImageURLs(gid, img.Main.Key, "")
+	} else {
+		_, out["cover_url"] = groupImageURLs(gid, "", img.Main.Key)
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// Avatar sends the group's avatar (?size=full|thumb), or the initials of
+// its title when it has none.
+func (h *GroupsHandler) Avatar(w http.ResponseWriter, r *http.Request) {
+	h.serveImage(w, r, groupAvatar)
+}
+
+// Cover sends the group's cover image (?size=full|thumb).
+func (h *GroupsHandler) Cover(w http.ResponseWriter, r *http.Request) {
+	h.serveImage(w, r, groupCover)
+}
+
+func (h *GroupsHandler) serveImage(w http.ResponseWriter, r *http.Request, gi groupImage) {
+	gid := chi.URLParam(r, "id")
+	viewerID := ""
+	if sess, ok := auth.SessionFromContext(r); ok {
+		viewerID = sess.UserID
+	}
+	access, err := loadGroupAccess(h.DB, gid, viewerID)
+	if err != nil || !access.visible() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	// shared caches may keep the images of groups anyone can see
+	scope := "public"
+	if access.visibility == visibilitySecret {
+		scope = "private"
+	}
+	var title string
+	var key, storage sql.NullString
+	err = h.DB.QueryRow("SELECT title, "+gi.pathColumn+", "+gi.storageColumn+" FROM groups WHERE id = ?", gid).
+		Scan(&title, &key, &storage)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	size := r.URL.Query().Get("size")
+	store := h.Stores[storage.String]
+	if !key.Valid || store == nil {
+		if gi.name != groupAvatar.name {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", scope+", max-age=300")
+		words := strings.Fields(title)
+		words = append(words, "", "")
+		writeInitialsAvatar(w, gid, initials(words[0], words[1], ""), size)
+		return
+	}
+	cache := scope + ", max-age=300"
+	if r.URL.Query().Get("v") == avatarVersion(key.String) {
+		cache = scope + ", max-age=31536000, immutable"
+	}
+	w.Header().Set("Cache-Control", cache)
+	variant := ""
+	if size == avatarThumb {
+		variant = "thumb"
+	}
+	serveStoredImage(w, r, h.DB, store, storage.String, key.String, variant)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// Group visibility: who can find the group and read what is posted in it.
+const (
+	visibilityPublic  = "public"  // listed; any signed-in user reads posts, comments and events
+	visibilityPrivate = "private" // listed; content is for members
+	visibilitySecret  = "secret"  // unlisted; doesn't exist for anyone but members and invitees
+)
+
+// Join policies: how a non-member becomes a member.
+const (
+	joinOpen    = "open"    // joining needs no approval
+	joinRequest = "request" // a moderator answers a join request
+	joinInvite  = "invite"  // invitations only
+)
+
+var (
+	validVisibility = map[string]bool{visibilityPublic: true, visibilityPrivate: true, visibilitySecret: true}
+	validJoinPolicy = map[string]bool{joinOpen: true, joinRequest: true, joinInvite: true}
+)
+
+// groupAccess is what a viewer may do with a group, from its settings and
+// their role in it.
+type groupAccess struct {
+	visibility string
+	joinPolicy string
+	role       string // "" for non-members
+	invited    bool   // holds a pending invitation
+}
+
+// loadGroupAccess reads the group's settings and userID's standing in it
+// (userID may be empty for anonymous viewers). The error is sql.ErrNoRows
+// when the group doesn't exist.
+func loadGroupAccess(db *sql.DB, gid, userID string) (*groupAccess, error) {
+	a := &groupAccess{}
+	var role sql.NullString
+	err := db.QueryRow(`SELECT g.visibility, g.join_policy,
+		CASE WHEN g.owner_user_id = ?1 THEN 'owner' ELSE gm.role END,
+		EXISTS(SELECT 1 FROM group_invitations gi WHERE gi.group_id = g.id AND gi.to_user_id = ?1 AND gi.status = 'pending')
+		FROM groups g LEFT JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = ?1
+		WHERE g.id = ?2`, userID, gid).Scan(&a.visibility, &a.joinPolicy, &role, &a.invited)
+	if err != nil {
+		return nil, err
+	}
+	a.role = role.String
+	return a, nil
+}
+
+// visible reports whether the viewer may know the group exists.
+func (a *groupAccess) visible() bool {
+	return a.visibility != visibilitySecret || a.role != "" || a.invited
+}
+
+// canRead reports whether the viewer may read the group's posts, comments
+// and events.
+func (a *groupAccess) canRead() bool {
+	return a.role != "" || a.visibility == visibilityPublic
+}
+
+// groupHidden reports whether the group doesn't exist as far as userID can
+// tell: it is missing, or secret and they are neither member nor invitee.
+func groupHidden(db *sql.DB, gid, userID string) bool {
+	a, err := loadGroupAccess(db, gid, userID)
+	return err != nil || !a.visible()
+}
+
+// requireGroupRead writes 404 for groups hidden from userID and 403 when
+// they can see the group but not its content.
+func requireGroupRead(w http.ResponseWriter, db *sql.DB, gid, userID string) bool {
+	a, err := loadGroupAccess(db, gid, userID)
+	if err != nil || !a.visible() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	}
+	if !a.canRead() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// denyGroupMember answers a non-member's request for members-only data:
+// 404 when the group is hidden from them, 403 otherwise.
+func denyGroupMember(w http.ResponseWriter, db *sql.DB, gid, userID string) {
+	if groupHidden(db, gid, userID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
+
+// groupSettings validates a visibility and join policy. Nobody outside a
+// secret group can find it to ask, so secret groups are always invite-only.
+func groupSettings(visibility, joinPolicy string) (string, string, bool) {
+	if !validVisibility[visibility] || !validJoinPolicy[joinPolicy] {
+		return "", "", false
+	}
+	if visibility == visibilitySecret {
+		joinPolicy = joinInvite
+	}
+	return visibility, joinPolicy, true
+}
@@ -6,14 +6,28 @@ import (
 	"net/http"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/imaging"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
-type GroupsHandler struct{ DB *sql.DB }
+type GroupsHandler struct {
+	DB             *sql.DB
+	Media          services.MediaStore            // where new group images go
+	Stores         map[string]services.MediaStore // by Name(), for images kept in any backend
+	MaxUploadBytes int64
+	Limits         imaging.Limits
+	Hub            *websocket.Hub // to close the group chat of removed members
+}
 
-type createGroupReq struct{ Title, Description string }
+type createGroupReq struct {
+	Title, Description string
+	Visibility         string `json:"visibility"`
+	JoinPolicy         string `json:"join_policy"`
+}
 
 func (h *GroupsHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
@@ -26,8 +40,20 @@ func (h *GroupsHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	if body.Visibility == "" {
+		body.Visibility = visibilityPrivate
+	}
+	if body.JoinPolicy == "" {
+		body.JoinPolicy = joinRequest
+	}
+	visibility, joinPolicy, ok := groupSettings(body.Visibility, body.JoinPolicy)
+	if !ok {
+		http.Error(w, "invalid visibility or join policy", http.StatusBadRequest)
+		return
+	}
 	gid := uuid.NewString()
-	if _, err := h.DB.Exec("INSERT INTO groups(id, owner_user_id, title, description) VALUES(?,?,?,?)", gid, sess.UserID, body.Title, body.Description); err != nil {
+	if _, err := h.DB.Exec("INSERT INTO groups(id, owner_user_id, title, description, visibility, join_policy) VALUES(?,?,?,?,?,?)",
+		gid, sess.UserID, body.Title, body.Description, visibility, joinPolicy); err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
@@ -45,6 +71,8 @@ func (h *GroupsHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		"Title":       body.Title,
 		"Description": body.Description,
 		"CreatedAt":   createdAt,
+		"visibility":  visibility,
+		"join_policy": joinPolicy,
 	}
 
 	_ = json.NewEncoder(w).Encode(groupData)
@@ -57,16 +85,22 @@ func (h *GroupsHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// archived groups are only listed on request
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
 	rows, err := h.DB.Query(`
 		SELECT g.id, g.owner_user_id, g.title, g.description, g.created_at,
 		       COUNT(gm.user_id) as member_count,
 		       CASE WHEN g.owner_user_id = ? THEN 'owner' ELSE gm.role END as user_role,
-		       CASE WHEN g.owner_user_id = ? OR gm.user_id IS NOT NULL THEN 1 ELSE 0 END as is_member
+		       CASE WHEN g.owner_user_id = ? OR gm.user_id IS NOT NULL THEN 1 ELSE 0 END as is_member,
+		       g.archived_at IS NOT NULL, COALESCE(g.avatar_path, ''), COALESCE(g.cover_path, ''),
+		       g.visibility, g.join_policy
 		FROM groups g
 		LEFT JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = ?
+		WHERE (g.archived_at IS NULL OR ?)
+		  AND (g.visibility != 'secret' OR is_member = 1)
 		GROUP BY g.id, g.owner_user_id, g.title, g.description, g.created_at, user_role, is_member
 		ORDER BY g.created_at DESC LIMIT 100
-	`, sess.UserID, sess.UserID, sess.UserID)
+	`, sess.UserID, sess.UserID, sess.UserID, includeArchived)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -77,11 +111,19 @@ func (h *GroupsHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
 		MemberCount                                int    `json:"member_count"`
 		UserRole                                   string `json:"user_role"`
 		IsMember                                   int    `json:"is_member"`
+		Archived                                   bool   `json:"archived"`
+		AvatarURL                                  string `json:"avatar_url"`
+		CoverURL                                   string `json:"cover_url,omitempty"`
+		Visibility                                 string `json:"visibility"`
+		JoinPolicy                                 string `json:"join_policy"`
 	}
 	var out []g
 	for rows.Next() {
 		var x g
-		_ = rows.Scan(&x.ID, &x.OwnerID, &x.Title, &x.Description, &x.CreatedAt, &x.MemberCount, &x.UserRole, &x.IsMember)
+		var avatar, cover string
+		_ = rows.Scan(&x.ID, &x.OwnerID, &x.Title, &x.Description, &x.CreatedAt, &x.MemberCount, &x.UserRole, &x.IsMember,
+			&x.Archived, &avatar, &cover, &x.Visibility, &x.JoinPolicy)
+		x.AvatarURL, x.CoverURL = groupImageURLs(x.ID, avatar, cover)
 		out = append(out, x)
 	}
 	_ = json.NewEncoder(w).Encode(out)
@@ -89,12 +131,38 @@ func (h *GroupsHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
 
 func (h *GroupsHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	var owner, title, desc, created string
-	if err := h.DB.QueryRow("SELECT owner_user_id, title, description, created_at FROM groups WHERE id = ?", id).Scan(&owner, &title, &desc, &created); err != nil {
+	viewerID := ""
+	if sess, ok := auth.SessionFromContext(r); ok {
+		viewerID = sess.UserID
+	}
+	if groupHidden(h.DB, id, viewerID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var owner, title, desc, created, avatar, cover, visibility, joinPolicy string
+	var archivedAt sql.NullString
+	if err := h.DB.QueryRow(`SELECT owner_user_id, title, description, created_at, archived_at,
+		COALESCE(avatar_path, ''), COALESCE(cover_path, ''), visibility, join_policy FROM groups WHERE id = ?`, id).
+		Scan(&owner, &title, &desc, &created, &archivedAt, &avatar, &cover, &visibility, &joinPolicy); err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	_ = json.NewEncoder(w).Encode(map[string]string{"id": id, "owner_user_id": owner, "title": title, "description": desc, "created_at": created})
+	out := map[string]any{"id": id, "owner_user_id": owner, "title": title, "description": desc, "created_at": created,
+		"archived": archivedAt.Valid, "visibility": visibility, "join_policy": joinPolicy}
+	if archivedAt.Valid {
+		out["archived_at"] = archivedAt.String
+	}
+	avatarURL, coverURL := groupImageURLs(id, avatar, cover)
+	out["avatar_url"] = avatarURL
+	if coverURL != "" {
+		out["cover_url"] = coverURL
+	}
+	if sess, ok := auth.SessionFromContext(r); ok {
+		role, _ := groupRole(h.DB, id, sess.UserID)
+		out["viewer_role"] = role
+		out["permissions"] = rolePermissions(role)
+	}
+	_ = json.NewEncoder(w).Encode(out)
 }
 
 type inviteReq struct {
@@ -112,7 +180,10 @@ func (h *GroupsHandler) Invite(w http.ResponseWriter, r *http.Request) {
 	var count int
 	_ = h.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID).Scan(&count)
 	if count == 0 {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		denyGroupMember(w, h.DB, gid, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
 		return
 	}
 	var body inviteReq
@@ -120,8 +191,25 @@ func (h *GroupsHandler) Invite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	if isBannedFromGroup(h.DB, gid, body.UserID) {
+		http.Error(w, "user is banned from this group", http.StatusForbidden)
+		return
+	}
+	if isBlocked(h.DB, sess.UserID, body.UserID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if role, _ := groupRole(h.DB, gid, body.UserID); role != "" {
+		http.Error(w, "conflict", http.StatusConflict)
+		return
+	}
+	// an answered invitation (say, to someone who has since left) is reissued
 	iid := uuid.NewString()
-	if _, err := h.DB.Exec("INSERT INTO group_invitations(id, group_id, from_user_id, to_user_id, status) VALUES(?,?,?,?, 'pending')", iid, gid, sess.UserID, body.UserID); err != nil {
+	res, err := h.DB.Exec(`INSERT INTO group_invitations(id, group_id, from_user_id, to_user_id, status) VALUES(?,?,?,?, 'pending')
+		ON CONFLICT(group_id, to_user_id) DO UPDATE SET id = excluded.id, from_user_id = excluded.from_user_id,
+			status = 'pending', created_at = CURRENT_TIMESTAMP
+		WHERE group_invitations.status != 'pending'`, iid, gid, sess.UserID, body.UserID)
+	if n, _ := rowsAffected(res, err); n == 0 {
 		http.Error(w, "conflict", http.StatusConflict)
 		return
 	}
@@ -143,6 +231,13 @@ func (h *GroupsHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	if isBannedFromGroup(h.DB, gid, sess.UserID) {
+		http.Error(w, "banned from this group", http.StatusForbidden)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
 	_, _ = h.DB.Exec("INSERT OR IGNORE INTO group_members(group_id, user_id, role) VALUES(?,?,'member')", gid, sess.UserID)
 	_, _ = h.DB.Exec("UPDATE group_invitations SET status='accepted' WHERE id = ?", iid)
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
@@ -171,16 +266,61 @@ func (h *GroupsHandler) RequestJoin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	gid := chi.URLParam(r, "id")
+	access, err := loadGroupAccess(h.DB, gid, sess.UserID)
+	if err != nil || !access.visible() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if isBannedFromGroup(h.DB, gid, sess.UserID) {
+		http.Error(w, "banned from this group", http.StatusForbidden)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	if access.role != "" {
+		http.Error(w, "conflict", http.StatusConflict)
+		return
+	}
+	switch access.joinPolicy {
+	case joinInvite:
+		http.Error(w, "group is invite only", http.StatusForbidden)
+		return
+	case joinOpen:
+		if _, err := h.DB.Exec("INSERT OR IGNORE INTO group_members(group_id, user_id, role) VALUES(?,?,'member')", gid, sess.UserID); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		// a pending request or invitation is answered by joining
+		_, _ = h.DB.Exec("UPDATE group_requests SET status = 'accepted' WHERE group_id = ? AND user_id = ? AND status = 'pending'", gid, sess.UserID)
+		_, _ = h.DB.Exec("UPDATE group_invitations SET status = 'accepted' WHERE group_id = ? AND to_user_id = ? AND status = 'pending'", gid, sess.UserID)
+		auditGroup(h.DB, gid, sess.UserID, "join", sess.UserID, "")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "joined"})
+		return
+	}
+	// members who left or were removed may ask again
 	rid := uuid.NewString()
-	if _, err := h.DB.Exec("INSERT INTO group_requests(id, group_id, user_id, status) VALUES(?,?,?, 'pending')", rid, gid, sess.UserID); err != nil {
+	res, err := h.DB.Exec(`INSERT INTO group_requests(id, group_id, user_id, status) VALUES(?,?,?, 'pending')
+		ON CONFLICT(group_id, user_id) DO UPDATE SET id = excluded.id, status = 'pending', created_at = CURRENT_TIMESTAMP
+		WHERE group_requests.status != 'pending'`, rid, gid, sess.UserID)
+	if n, _ := rowsAffected(res, err); n == 0 {
 		http.Error(w, "conflict", http.StatusConflict)
 		return
 	}
-	// notify group owner
-	var owner string
-	_ = h.DB.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", gid).Scan(&owner)
-	if owner != "" {
-		_, _ = h.DB.Exec("INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id) VALUES(?,?,?,?,?)", uuid.NewString(), owner, "group_join_request", sess.UserID, gid)
+	// notify everyone who can answer the request
+	rows, err := h.DB.Query("SELECT user_id, role FROM group_members WHERE group_id = ?", gid)
+	if err == nil {
+		var managers []string
+		for rows.Next() {
+			var uid, role string
+			if rows.Scan(&uid, &role) == nil && roleCan(role, permManageRequests) {
+				managers = append(managers, uid)
+			}
+		}
+		rows.Close()
+		for _, uid := range managers {
+			notifyGroupMember(h.DB, uid, "group_join_request", sess.UserID, gid)
+		}
 	}
 	_ = json.NewEncoder(w).Encode(map[string]string{"id": rid, "status": "pending"})
 }
@@ -193,10 +333,10 @@ func (h *GroupsHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	gid := chi.URLParam(r, "id")
 	rid := chi.URLParam(r, "reqID")
-	// only owner can accept
-	var owner string
-	if err := h.DB.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", gid).Scan(&owner); err != nil || owner != sess.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permManageRequests); !ok {
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
 		return
 	}
 	var userID string
@@ -204,8 +344,13 @@ func (h *GroupsHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	if isBannedFromGroup(h.DB, gid, userID) {
+		http.Error(w, "user is banned from this group", http.StatusConflict)
+		return
+	}
 	_, _ = h.DB.Exec("INSERT OR IGNORE INTO group_members(group_id, user_id, role) VALUES(?,?,'member')", gid, userID)
 	_, _ = h.DB.Exec("UPDATE group_requests SET status='accepted' WHERE id = ?", rid)
+	auditGroup(h.DB, gid, sess.UserID, "join_request_accepted", userID, "")
 	// notify requester
 	_, _ = h.DB.Exec("INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id) VALUES(?,?,?,?,?)", uuid.NewString(), userID, "group_join_accepted", sess.UserID, rid)
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
@@ -219,30 +364,36 @@ func (h *GroupsHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	gid := chi.URLParam(r, "id")
 	rid := chi.URLParam(r, "reqID")
-	var owner string
-	if err := h.DB.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", gid).Scan(&owner); err != nil || owner != sess.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permManageRequests); !ok {
 		return
 	}
+	var userID string
+	_ = h.DB.QueryRow("SELECT user_id FROM group_requests WHERE id = ? AND group_id = ? AND status='pending'", rid, gid).Scan(&userID)
 	_, err := h.DB.Exec("UPDATE group_requests SET status='declined' WHERE id = ? AND group_id = ? AND status='pending'", rid, gid)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	if userID != "" {
+		auditGroup(h.DB, gid, sess.UserID, "join_request_declined", userID, "")
+	}
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "declined"})
 }
 
 // List group members
 func (h *GroupsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
-	_, ok := auth.SessionFromContext(r)
+	sess, ok := auth.SessionFromContext(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	gid := chi.URLParam(r, "id")
 
-	// Allow anyone to see group members (public information)
-	// No need to check if user is member
+	// members of listed groups are public information
+	if groupHidden(h.DB, gid, sess.UserID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	rows, err := h.DB.Query(`
 		SELECT gm.user_id, gm.role, gm.joined_at, u.first_name, u.last_name
@@ -258,17 +409,24 @@ func (h *GroupsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type member struct {
-		UserID    string `json:"user_id"`
-		FirstName string `json:"first_name"`
-		LastName  string `json:"last_name"`
-		Role      string `json:"role"`
-		JoinedAt  string `json:"joined_at"`
+		UserID    string                `json:"user_id"`
+		FirstName string                `json:"first_name"`
+		LastName  string                `json:"last_name"`
+		Role      string                `json:"role"`
+		JoinedAt  string                `json:"joined_at"`
+		User      websocket.UserSummary `json:"user"`
 	}
 	var out []member
+	var ids []string
 	for rows.Next() {
 		var m member
 		_ = rows.Scan(&m.UserID, &m.Role, &m.JoinedAt, &m.FirstName, &m.LastName)
 		out = append(out, m)
+		ids = append(ids, m.UserID)
+	}
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].User = users[out[i].UserID]
 	}
 	_ = json.NewEncoder(w).Encode(out)
 }
@@ -383,10 +541,10 @@ func (h *GroupsHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.DB.Query(`
 		SELECT id, first_name, last_name, email
 		FROM users 
-		WHERE id != ? AND (first_name LIKE ? OR last_name LIKE ? OR email LIKE ?)
+		WHERE id != ? AND (first_name LIKE ? OR last_name LIKE ? OR email LIKE ?) AND `+notBlocked("id")+`
 		ORDER BY first_name, last_name
 		LIMIT 20
-	`, sess.UserID, "%"+query+"%", "%"+query+"%", "%"+query+"%")
+	`, sess.UserID, "%"+query+"%", "%"+query+"%", "%"+query+"%", sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -408,7 +566,7 @@ func (h *GroupsHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(out)
 }
 
-// List pending join requests for a group (group owners only)
+// List pending join requests for a group (owners, admins and moderators)
 func (h *GroupsHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -417,17 +575,7 @@ func (h *GroupsHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request)
 	}
 
 	gid := chi.URLParam(r, "id")
-
-	// Check if user is group owner
-	var ownerID string
-	err := h.DB.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", gid).Scan(&ownerID)
-	if err != nil {
-		http.Error(w, "group not found", http.StatusNotFound)
-		return
-	}
-
-	if ownerID != sess.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permManageRequests); !ok {
 		return
 	}
 
@@ -464,7 +612,7 @@ func (h *GroupsHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request)
 	_ = json.NewEncoder(w).Encode(out)
 }
 
-// Accept or decline a join request (group owners only)
+// Accept or decline a join request (owners, admins and moderators)
 func (h *GroupsHandler) HandleJoinRequest(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -481,23 +629,14 @@ func (h *GroupsHandler) HandleJoinRequest(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Check if user is group owner
-	var ownerID string
-	err := h.DB.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", gid).Scan(&ownerID)
-	if err != nil {
-		http.Error(w, "group not found", http.StatusNotFound)
-		return
-	}
-
-	if ownerID != sess.UserID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permManageRequests); !ok {
 		return
 	}
 
 	// Get the join request
 	var userID string
 	var status string
-	err = h.DB.QueryRow("SELECT user_id, status FROM group_requests WHERE id = ? AND group_id = ?", requestID, gid).Scan(&userID, &status)
+	err := h.DB.QueryRow("SELECT user_id, status FROM group_requests WHERE id = ? AND group_id = ?", requestID, gid).Scan(&userID, &status)
 	if err != nil {
 		http.Error(w, "join request not found", http.StatusNotFound)
 		return
@@ -507,6 +646,13 @@ func (h *GroupsHandler) HandleJoinRequest(w http.ResponseWriter, r *http.Request
 		http.Error(w, "join request already processed", http.StatusConflict)
 		return
 	}
+	if action == "accept" && rejectArchived(w, h.DB, gid) {
+		return
+	}
+	if action == "accept" && isBannedFromGroup(h.DB, gid, userID) {
+		http.Error(w, "user is banned from this group", http.StatusConflict)
+		return
+	}
 
 	// Update the join request status
 	newStatus := "accepted"
@@ -519,6 +665,7 @@ func (h *GroupsHandler) HandleJoinRequest(w http.ResponseWriter, r *http.Request
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	auditGroup(h.DB, gid, sess.UserID, "join_request_"+newStatus, userID, "")
 
 	// If accepted, add user to group
 	if action == "accept" {
@@ -539,3 +686,10 @@ func (h *GroupsHandler) HandleJoinRequest(w http.ResponseWriter, r *http.Request
 
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": newStatus})
 }
+
+func rowsAffected(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/websocket"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -14,7 +16,8 @@ import (
 type GroupPostsHandler struct{ DB *sql.DB }
 
 type createGroupPostReq struct {
-	Text string `json:"text"`
+	Text          string   `json:"text"`
+	AttachmentIDs []string `json:"attachment_ids"`
 }
 
 func (h *GroupPostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -28,16 +31,35 @@ func (h *GroupPostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	var cnt int
 	_ = h.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID).Scan(&cnt)
 	if cnt == 0 {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		denyGroupMember(w, h.DB, gid, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
 		return
 	}
 	var body createGroupPostReq
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Text == "" {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Text == "" && len(body.AttachmentIDs) == 0) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 	id := uuid.NewString()
-	_, err := h.DB.Exec("INSERT INTO group_posts(id, group_id, user_id, text) VALUES(?,?,?,?)", id, gid, sess.UserID, body.Text)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO group_posts(id, group_id, user_id, text) VALUES(?,?,?,?)", id, gid, sess.UserID, body.Text)
+	if err == nil {
+		err = claimAttachments(tx, body.AttachmentIDs, sess.UserID, subjectGroupPost, id)
+	}
+	if errors.Is(err, errInvalidAttachments) {
+		http.Error(w, "invalid attachments", http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -52,24 +74,38 @@ func (h *GroupPostsHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	gid := chi.URLParam(r, "id")
-	var cnt int
-	_ = h.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID).Scan(&cnt)
-	if cnt == 0 {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if !requireGroupRead(w, h.DB, gid, sess.UserID) {
 		return
 	}
-	rows, err := h.DB.Query("SELECT id, user_id, text, created_at FROM group_posts WHERE group_id = ? ORDER BY created_at DESC", gid)
+	rows, err := h.DB.Query("SELECT id, user_id, text, created_at FROM group_posts WHERE group_id = ? AND hidden_at IS NULL AND "+notBlocked("user_id")+" ORDER BY created_at DESC",
+		gid, sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
-	type gp struct{ ID, UserID, Text, CreatedAt string }
+	type gp struct {
+		ID, UserID, Text, CreatedAt string
+		Attachments                 []websocket.Attachment `json:"attachments"`
+		Author                      websocket.UserSummary  `json:"author"`
+	}
 	var out []gp
+	var ids []string
 	for rows.Next() {
 		var x gp
 		_ = rows.Scan(&x.ID, &x.UserID, &x.Text, &x.CreatedAt)
 		out = append(out, x)
+		ids = append(ids, x.ID)
+	}
+	attachments := loadAttachments(h.DB, subjectGroupPost, ids)
+	var authorIDs []string
+	for i := range out {
+		authorIDs = append(authorIDs, out[i].UserID)
+	}
+	authors := loadUserSummaries(h.DB, authorIDs, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].Attachments = attachments[out[i].ID]
+		out[i].Author = authors[out[i].UserID]
 	}
 	_ = json.NewEncoder(w).Encode(out)
 }
@@ -90,7 +126,16 @@ func (h *GroupPostsHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	var cnt int
 	_ = h.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID).Scan(&cnt)
 	if cnt == 0 {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		denyGroupMember(w, h.DB, gid, sess.UserID)
+		return
+	}
+	if rejectArchived(w, h.DB, gid) {
+		return
+	}
+	var inGroup bool
+	_ = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM group_posts WHERE id = ? AND group_id = ? AND hidden_at IS NULL)", postID, gid).Scan(&inGroup)
+	if !inGroup {
+		http.Error(w, "post not found", http.StatusNotFound)
 		return
 	}
 	var body createGroupCommentReq
@@ -116,30 +161,36 @@ func (h *GroupPostsHandler) ListComments(w http.ResponseWriter, r *http.Request)
 	}
 	gid := chi.URLParam(r, "id")
 	postID := chi.URLParam(r, "postID")
-	// membership check
-	var cnt int
-	_ = h.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", gid, sess.UserID).Scan(&cnt)
-	if cnt == 0 {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if !requireGroupRead(w, h.DB, gid, sess.UserID) {
 		return
 	}
-	rows, err := h.DB.Query("SELECT id, user_id, text, created_at FROM group_comments WHERE group_post_id = ? ORDER BY created_at ASC", postID)
+	rows, err := h.DB.Query(`SELECT c.id, c.user_id, c.text, c.created_at FROM group_comments c
+		JOIN group_posts p ON p.id = c.group_post_id
+		WHERE c.group_post_id = ? AND p.group_id = ? AND c.hidden_at IS NULL AND p.hidden_at IS NULL AND `+notBlocked("c.user_id")+` ORDER BY c.created_at ASC`,
+		postID, gid, sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 	type gc struct {
-		ID        string `json:"id"`
-		UserID    string `json:"user_id"`
-		Text      string `json:"text"`
-		CreatedAt string `json:"created_at"`
+		ID        string                `json:"id"`
+		UserID    string                `json:"user_id"`
+		Text      string                `json:"text"`
+		CreatedAt string                `json:"created_at"`
+		Author    websocket.UserSummary `json:"author"`
 	}
 	var out []gc
+	var authorIDs []string
 	for rows.Next() {
 		var c gc
 		_ = rows.Scan(&c.ID, &c.UserID, &c.Text, &c.CreatedAt)
 		out = append(out, c)
+		authorIDs = append(authorIDs, c.UserID)
+	}
+	authors := loadUserSummaries(h.DB, authorIDs, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].Author = authors[out[i].UserID]
 	}
 	_ = json.NewEncoder(w).Encode(out)
 }
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-network/backend/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// groupFixture is a group "g1" owned by "owner", with a router that loads
+// cookie sessions. Tests mount the handlers they need on it.
+type groupFixture struct {
+	t        *testing.T
+	db       *sql.DB
+	router   chi.Router
+	sessions map[string]string
+}
+
+func newGroupFixture(t *testing.T) *groupFixture {
+	t.Helper()
+	f := &groupFixture{t: t, db: newTestDB(t), router: chi.NewRouter(), sessions: map[string]string{}}
+	f.router.Use(auth.LoadSession(f.db))
+	f.addUser("owner")
+	f.exec("INSERT INTO groups(id, owner_user_id, title, description) VALUES('g1', 'owner', 'Group', '')")
+	f.exec("INSERT INTO group_members(group_id, user_id, role) VALUES('g1', 'owner', 'owner')")
+	return f
+}
+
+func (f *groupFixture) exec(q string, args ...any) {
+	f.t.Helper()
+	if _, err := f.db.Exec(q, args...); err != nil {
+		f.t.Fatalf("%s: %v", q, err)
+	}
+}
+
+func (f *groupFixture) addUser(id string) {
+	f.t.Helper()
+	f.exec(`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES(?, ?, 'h', ?, 'Test', '2000-01-01')`,
+		id, id+"@example.com", id)
+	f.exec("INSERT INTO profiles(user_id, public) VALUES(?, 1)", id)
+}
+
+// addMember adds a new user to g1 with role.
+func (f *groupFixture) addMember(id, role string) {
+	f.t.Helper()
+	f.addUser(id)
+	f.exec("INSERT INTO group_members(group_id, user_id, role) VALUES('g1', ?, ?)", id, role)
+}
+
+// do sends a request as user ("" for nobody) and decodes a JSON answer
+// into out when it is not nil.
+func (f *groupFixture) do(user, method, path string, body any, out any) int {
+	f.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if user != "" {
+		if f.sessions[user] == "" {
+			sess, err := auth.CreateSession(f.db, user, time.Hour, "test", "127.0.0.1")
+			if err != nil {
+				f.t.Fatal(err)
+			}
+			f.sessions[user] = sess.ID
+		}
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: f.sessions[user]})
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			f.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
@@ -3,24 +3,99 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/imaging"
 	"social-network/backend/internal/services"
 
 	"github.com/google/uuid"
 )
 
 type ImagesHandler struct {
-	DB            *sql.DB
-	CloudinarySvc *services.CloudinaryService
+	DB             *sql.DB
+	Media          services.MediaStore
+	MaxUploadBytes int64
+	Limits         imaging.Limits
 }
 
-var allowedImageTypes = map[string]bool{
-	"image/jpeg": true,
-	"image/png":  true,
-	"image/gif":  true,
+// cloudinaryColumns returns the values for the legacy cloudinary_* columns,
+// which are only filled for images held by Cloudinary.
+func cloudinaryColumns(store services.MediaStore, m *services.StoredMedia) (publicID, url, secureURL sql.NullString) {
+	if store.Name() != "cloudinary" {
+		return
+	}
+	return sql.NullString{String: m.Key, Valid: true},
+		sql.NullString{String: m.URL, Valid: true},
+		sql.NullString{String: m.SecureURL, Valid: true}
+}
+
+// readImage reads the "image" form field and runs it through the imaging
+// pipeline. The format is sniffed from the bytes; the part's Content-Type is
+// ignored. It writes the error response itself when ok is false.
+func readImage(w http.ResponseWriter, r *http.Request, maxBytes int64, limits imaging.Limits, spec imaging.Spec) (res *imaging.Result, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, false
+	}
+	defer file.Close()
+
+	res, err = imaging.Process(file, spec, limits)
+	if err != nil {
+		writeImageError(w, err)
+		return nil, false
+	}
+	return res, true
+}
+
+// writeImageError reports why the imaging pipeline rejected an upload.
+func writeImageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+	case errors.Is(err, imaging.ErrTooLarge):
+		http.Error(w, "image dimensions too large", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "invalid image", http.StatusBadRequest)
+	}
+}
+
+// insertPostImage records a stored image, and its variants, as belonging to
+// postID and returns the new post_images id.
+func insertPostImage(db services.Execer, store services.MediaStore, postID string, processed *imaging.Result, img *services.StoredImage) (string, error) {
+	imageID := uuid.NewString()
+	publicID, url, secureURL := cloudinaryColumns(store, img.Main)
+	_, err := db.Exec(`
+		INSERT INTO post_images(
+			id, post_id, path, mime, storage,
+			cloudinary_public_id, cloudinary_url, cloudinary_secure_url,
+			width, height, format, blurhash
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		imageID, postID, img.Main.Key, processed.Main.ContentType, store.Name(),
+		publicID, url, secureURL,
+		processed.Main.Width, processed.Main.Height, img.Main.Format, img.Blurhash)
+	if err != nil {
+		return "", err
+	}
+	return imageID, services.RecordVariants(db, store.Name(), img)
+}
+
+// variantURLs maps each derived size to its public URL.
+func variantURLs(img *services.StoredImage) map[string]string {
+	out := make(map[string]string, len(img.Variants))
+	for name, v := range img.Variants {
+		out[name] = v.SecureURL
+	}
+	return out
 }
 
 func (h *ImagesHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
@@ -30,36 +105,36 @@ func (h *ImagesHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.ParseMultipartForm(10 << 20) // 10MB max
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	processed, ok := readImage(w, r, h.MaxUploadBytes, h.Limits, imaging.AvatarSpec)
+	if !ok {
 		return
 	}
-	defer file.Close()
 
-	if !allowedImageTypes[handler.Header.Get("Content-Type")] {
-		http.Error(w, "unsupported file type", http.StatusBadRequest)
-		return
+	img, err := services.PutImage(r.Context(), h.Media, processed, services.PutOptions{
+		Kind:    services.MediaAvatar,
+		OwnerID: sess.UserID,
+	})
+	if err == nil {
+		err = services.RecordVariants(h.DB, h.Media.Name(), img)
 	}
-
-	// Upload to Cloudinary
-	result, err := h.CloudinarySvc.UploadAvatar(r.Context(), file, sess.UserID)
 	if err != nil {
-		log.Printf("Cloudinary upload error: %v", err)
+		services.DiscardImage(r.Context(), h.DB, h.Media, img)
+		log.Printf("%s upload error: %v", h.Media.Name(), err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Update database with Cloudinary data
+	result := img.Main
+	publicID, url, secureURL := cloudinaryColumns(h.Media, result)
 	_, err = h.DB.Exec(`
 		UPDATE profiles 
 		SET cloudinary_avatar_public_id = ?, 
 		    cloudinary_avatar_url = ?, 
 		    cloudinary_avatar_secure_url = ?,
-		    avatar_path = ?
+		    avatar_path = ?,
+		    avatar_storage = ?
 		WHERE user_id = ?`,
-		result.PublicID, result.URL, result.SecureURL, result.PublicID, sess.UserID)
+		publicID, url, secureURL, result.Key, h.Media.Name(), sess.UserID)
 
 	if err != nil {
 		log.Printf("DB error: %v", err)
@@ -67,14 +142,14 @@ func (h *ImagesHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return Cloudinary data
 	response := map[string]interface{}{
-		"public_id":  result.PublicID,
+		"public_id":  result.Key,
 		"url":        result.URL,
 		"secure_url": result.SecureURL,
 		"width":      result.Width,
 		"height":     result.Height,
 		"format":     result.Format,
+		"variants":   variantURLs(img),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -82,76 +157,62 @@ func (h *ImagesHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ImagesHandler) UploadPostImage(w http.ResponseWriter, r *http.Request) {
-	_, ok := auth.SessionFromContext(r)
+	sess, ok := auth.SessionFromContext(r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	r.ParseMultipartForm(10 << 20) // 10MB max
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadBytes)
+	postID := r.FormValue("post_id")
+	if postID == "" {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-
-	if !allowedImageTypes[handler.Header.Get("Content-Type")] {
-		http.Error(w, "unsupported file type", http.StatusBadRequest)
+	var ownerID string
+	if err := h.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&ownerID); err != nil {
+		http.Error(w, "post not found", http.StatusNotFound)
 		return
 	}
-
-	postID := r.FormValue("post_id")
-	if postID == "" {
-		http.Error(w, "post_id is required", http.StatusBadRequest)
+	if ownerID != sess.UserID {
+		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	// Check if Cloudinary service is available
-	if h.CloudinarySvc == nil {
-		log.Printf("Cloudinary service is nil - falling back to local storage")
-		http.Error(w, "Cloudinary not configured", http.StatusInternalServerError)
+	processed, ok := readImage(w, r, h.MaxUploadBytes, h.Limits, imaging.PostImageSpec)
+	if !ok {
 		return
 	}
 
-	// Upload to Cloudinary
-	log.Printf("Attempting to upload image to Cloudinary for post: %s", postID)
-	result, err := h.CloudinarySvc.UploadPostImage(r.Context(), file, postID)
+	img, err := services.PutImage(r.Context(), h.Media, processed, services.PutOptions{
+		Kind:    services.MediaPostImage,
+		OwnerID: postID,
+	})
 	if err != nil {
-		log.Printf("Cloudinary upload error: %v", err)
+		services.DiscardImage(r.Context(), h.DB, h.Media, img)
+		log.Printf("%s upload error: %v", h.Media.Name(), err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Cloudinary upload successful: %+v", result)
-
-	// Update database with Cloudinary data
-	imageID := uuid.NewString()
-	_, err = h.DB.Exec(`
-		INSERT INTO post_images(
-			id, post_id, path, mime, 
-			cloudinary_public_id, cloudinary_url, cloudinary_secure_url,
-			width, height, format
-		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		imageID, postID, result.PublicID, result.Format,
-		result.PublicID, result.URL, result.SecureURL,
-		result.Width, result.Height, result.Format)
-
+	imageID, err := insertPostImage(h.DB, h.Media, postID, processed, img)
 	if err != nil {
 		log.Printf("DB error: %v", err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Return Cloudinary data
+	result := img.Main
 	response := map[string]interface{}{
 		"id":         imageID,
-		"public_id":  result.PublicID,
+		"public_id":  result.Key,
 		"url":        result.URL,
 		"secure_url": result.SecureURL,
 		"width":      result.Width,
 		"height":     result.Height,
 		"format":     result.Format,
+		"blurhash":   img.Blurhash,
+		"variants":   variantURLs(img),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"social-network/backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// MediaHandler serves locally stored images. The URL names the stored
+// original; ?size= picks one of its derived sizes and the Accept header picks
+// among the formats that size exists in.
+type MediaHandler struct {
+	DB    *sql.DB
+	Store *services.LocalStore
+}
+
+// explicitFormats are only served to clients that list them in Accept;
+// browsers send image/* or */* without being able to decode them.
+var explicitFormats = map[string]bool{"image/webp": true}
+
+func (h *MediaHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+	if strings.HasPrefix(key, services.PrivateMediaPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	best, err := negotiateMedia(h.DB, h.Store.Name(), key, r.URL.Query().Get("size"), r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Vary", "Accept")
+	h.Store.ServeKey(w, r, best)
+}
+
+// negotiateMedia picks the stored key to send for the original key, the
+// requested size (empty for the main image) and the client's Accept header.
+func negotiateMedia(db *sql.DB, storage, key, size, accept string) (string, error) {
+	type candidate struct{ key, contentType string }
+	var candidates []candidate
+	if size == "" {
+		candidates = append(candidates, candidate{key, contentTypeOf(key)})
+	}
+	rows, err := db.Query(`SELECT key, format FROM media_variants
+		WHERE storage = ? AND source_key = ? AND variant = ? ORDER BY created_at`, storage, key, size)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var c candidate
+		var format string
+		if err := rows.Scan(&c.key, &format); err == nil {
+			c.contentType = "image/" + format
+			candidates = append(candidates, c)
+		}
+	}
+	rows.Close()
+	if len(candidates) == 0 {
+		// sizes the original already fits are never generated
+		return key, nil
+	}
+
+	best, bestQ := candidates[0], -1.0
+	for _, c := range candidates {
+		if q := acceptQuality(accept, c.contentType); q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best.key, nil
+}
+
+func contentTypeOf(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+// acceptQuality returns the q-value the Accept header gives contentType.
+// An exact match wins over image/*, which wins over */*.
+func acceptQuality(accept, contentType string) float64 {
+	if accept == "" {
+		if explicitFormats[contentType] {
+			return 0
+		}
+		return 1
+	}
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(fields[0]))
+		s := -1
+		switch {
+		case mt == contentType:
+			s = 2
+		case explicitFormats[contentType]:
+		case mt == "image/*":
+			s = 1
+		case mt == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for _, f := range fields[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(f), "="); ok && k == "q" {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					q = n
+				}
+			}
+		}
+	}
+	return q
+}
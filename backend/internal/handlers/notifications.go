@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/websocket"
 )
 
 type NotificationsHandler struct{ DB *sql.DB }
@@ -19,26 +20,29 @@ func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	// Enhanced query to get notification details with actor and subject information
 	rows, err := h.DB.Query(`
-		SELECT n.id, n.type, n.actor_user_id, n.subject_id, n.created_at, n.read_at,
-		       u.first_name, u.last_name,
-		       CASE 
+		SELECT n.id, n.type, COALESCE(n.actor_user_id, ''), n.subject_id, n.created_at, n.read_at,
+		       COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(ge.group_id, ''),
+		       COALESCE(CASE 
 		         WHEN n.type = 'group_invite' THEN g.title
 		         WHEN n.type = 'group_join_request' THEN g.title
 		         WHEN n.type = 'group_join_accepted' THEN g.title
 		         WHEN n.type = 'group_join_declined' THEN g.title
+		         WHEN n.type IN ('group_removed', 'group_banned', 'group_unbanned', 'group_role_changed', 'group_ownership_transferred') THEN g.title
+		         WHEN n.type IN ('group_event_created', 'group_event_updated', 'group_event_cancelled', 'group_event_reminder', 'event_response', 'event_waitlist_promoted') THEN ge.title
 		         WHEN n.type = 'comment' THEN p.text
 		         WHEN n.type = 'follow_request' THEN 'Follow Request'
 		         WHEN n.type = 'follow_accepted' THEN 'Follow Accepted'
 		         ELSE NULL
-		       END as subject_title
+		       END, '') as subject_title
 		FROM notifications n
 		LEFT JOIN users u ON u.id = n.actor_user_id
 		LEFT JOIN groups g ON g.id = n.subject_id
+		LEFT JOIN group_events ge ON ge.id = n.subject_id
 		LEFT JOIN posts p ON p.id = n.subject_id AND n.type = 'comment'
-		WHERE n.user_id = ? 
+		WHERE n.user_id = ? AND (n.actor_user_id IS NULL OR `+notMuted("n.actor_user_id")+`)
 		ORDER BY n.created_at DESC 
 		LIMIT 100
-	`, sess.UserID)
+	`, sess.UserID, sess.UserID, sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -58,17 +62,18 @@ func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 		ReadAt       string `json:"read_at"`
 		Message      string `json:"message"`
 		ActionURL    string `json:"action_url"`
+
+		Actor *websocket.UserSummary `json:"actor,omitempty"`
 	}
 
 	var out []notification
 	for rows.Next() {
 		var n notification
-		var firstName, lastName, subjectTitle string
+		var firstName, lastName, eventGroupID, subjectTitle string
 		var readAt sql.NullString
 
-		// Scan all 9 columns
 		err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.SubjectID, &n.CreatedAt, &readAt,
-			&firstName, &lastName, &subjectTitle)
+			&firstName, &lastName, &eventGroupID, &subjectTitle)
 		if err != nil {
 			// Handle scan error silently in production
 			continue
@@ -107,6 +112,39 @@ func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 		case "group_join_declined":
 			n.Message = "Your request to join " + n.SubjectTitle + " was declined"
 			n.ActionURL = "/groups"
+		case "group_removed":
+			n.Message = "You were removed from " + n.SubjectTitle
+			n.ActionURL = "/groups"
+		case "group_banned":
+			n.Message = "You were banned from " + n.SubjectTitle
+			n.ActionURL = "/groups"
+		case "group_unbanned":
+			n.Message = "Your ban from " + n.SubjectTitle + " was lifted"
+			n.ActionURL = "/groups/" + n.SubjectID
+		case "group_role_changed":
+			n.Message = n.ActorName + " changed your role in " + n.SubjectTitle
+			n.ActionURL = "/groups/" + n.SubjectID
+		case "group_ownership_transferred":
+			n.Message = n.ActorName + " made you the owner of " + n.SubjectTitle
+			n.ActionURL = "/groups/" + n.SubjectID
+		case "group_event_created":
+			n.Message = n.ActorName + " created the event " + n.SubjectTitle
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
+		case "group_event_updated":
+			n.Message = n.ActorName + " changed the event " + n.SubjectTitle
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
+		case "group_event_cancelled":
+			n.Message = n.ActorName + " cancelled the event " + n.SubjectTitle
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
+		case "group_event_reminder":
+			n.Message = n.SubjectTitle + " is coming up"
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
+		case "event_response":
+			n.Message = n.ActorName + " responded to " + n.SubjectTitle
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
+		case "event_waitlist_promoted":
+			n.Message = "A spot opened up: you're going to " + n.SubjectTitle
+			n.ActionURL = "/groups/" + eventGroupID + "?tab=events"
 		case "follow_request":
 			n.Message = n.ActorName + " wants to follow you"
 			n.ActionURL = "/profile?tab=followers"
@@ -123,6 +161,16 @@ func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 
 		out = append(out, n)
 	}
+	var actorIDs []string
+	for _, n := range out {
+		actorIDs = append(actorIDs, n.ActorID)
+	}
+	actors := loadUserSummaries(h.DB, actorIDs, avatarSize(r, avatarThumb))
+	for i := range out {
+		if a, ok := actors[out[i].ActorID]; ok {
+			out[i].Actor = &a
+		}
+	}
 	_ = json.NewEncoder(w).Encode(out)
 }
 
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/oidc"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// OIDCHandler signs users in through external OpenID Connect providers and
+// links those identities to local accounts.
+type OIDCHandler struct {
+	DB                *sql.DB
+	Providers         map[string]*oidc.Provider
+	PostLoginRedirect string
+	SessionTTL        time.Duration
+}
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	// Stored as password_hash for accounts created through an external
+	// provider; bcrypt never matches it, so password login stays disabled.
+	externalOnlyPasswordHash = "!"
+)
+
+var (
+	errIdentityTaken = errors.New("identity is linked to another account")
+	// errAccountExists is a sign-in whose email belongs to a local account
+	// the provider is not trusted to vouch for.
+	errAccountExists = errors.New("an account with this email already exists")
+)
+
+func (h *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	p, ok := h.Providers[chi.URLParam(r, "provider")]
+	if !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return nil, false
+	}
+	return p, true
+}
+
+// startFlow records a new authorization request and returns the provider URL
+// to send the browser to. The state is also bound to the browser by cookie.
+func (h *OIDCHandler) startFlow(w http.ResponseWriter, r *http.Request, p *oidc.Provider, linkUserID string) (string, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	var link sql.NullString
+	if linkUserID != "" {
+		link = sql.NullString{String: linkUserID, Valid: true}
+	}
+	expires := time.Now().Add(oidcStateTTL)
+	_, _ = h.DB.Exec("DELETE FROM oidc_login_states WHERE expires_at < ?", time.Now())
+	if _, err := h.DB.Exec("INSERT INTO oidc_login_states(state, provider, nonce, code_verifier, link_user_id, expires_at) VALUES(?,?,?,?,?,?)",
+		state, p.Name(), nonce, verifier, link, expires); err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		HttpOnly: true,
+		Secure:   auth.IsSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expires,
+	})
+	return p.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// Login redirects the browser to the provider's authorization endpoint.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	target, err := h.startFlow(w, r, p, "")
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// Link starts a flow that attaches a provider identity to the signed-in
+// user. It returns the authorization URL for the frontend to navigate to.
+func (h *OIDCHandler) Link(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.IsToken() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	target, err := h.startFlow(w, r, p, sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"url": target})
+}
+
+// Callback completes the authorization code flow, resolves (or creates) the
+// local user and starts a session.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/api/auth/oidc", Expires: time.Unix(0, 0), HttpOnly: true})
+
+	var provider, nonce, verifier string
+	var linkUserID sql.NullString
+	var expires time.Time
+	err = h.DB.QueryRow("SELECT provider, nonce, code_verifier, link_user_id, expires_at FROM oidc_login_states WHERE state = ?", state).
+		Scan(&provider, &nonce, &verifier, &linkUserID, &expires)
+	// states are single use
+	_, _ = h.DB.Exec("DELETE FROM oidc_login_states WHERE state = ?", state)
+	if err != nil || provider != p.Name() || expires.Before(time.Now()) {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := p.Exchange(r.Context(), q.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name(), err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	userID, status, err := h.resolveUser(p, claims, linkUserID.String)
+	if errors.Is(err, errAccountExists) {
+		http.Error(w, "an account with this email already exists; sign in and link this provider from your account", status)
+		return
+	}
+	if err != nil {
+		log.Printf("oidc %s: resolve user: %v", p.Name(), err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if !linkUserID.Valid {
+		sess, err := auth.CreateSession(h.DB, userID, h.SessionTTL, r.UserAgent(), r.RemoteAddr)
+		if errors.Is(err, auth.ErrSuspended) {
+			http.Error(w, "account suspended", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		auth.SetSessionCookie(w, r, sess)
+	}
+	http.Redirect(w, r, h.PostLoginRedirect, http.StatusFound)
+}
+
+// resolveUser maps verified claims to a local user id. In order: an already
+// linked identity, the user who started a link flow, an existing account
+// with the same verified email when the provider is trusted for it, or a
+// newly created account. An untrusted provider never reaches an existing
+// account by email; its owner has to sign in and link it.
+func (h *OIDCHandler) resolveUser(p *oidc.Provider, c *oidc.Claims, linkUserID string) (string, int, error) {
+	provider := p.Name()
+	var userID string
+	err := h.DB.QueryRow("SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?", provider, c.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		if linkUserID != "" && linkUserID != userID {
+			return "", http.StatusConflict, errIdentityTaken
+		}
+		return userID, http.StatusOK, nil
+	case err != sql.ErrNoRows:
+		return "", http.StatusInternalServerError, err
+	}
+
+	if linkUserID != "" {
+		userID = linkUserID
+	} else if c.Email != "" && c.EmailVerified {
+		_ = h.DB.QueryRow("SELECT id FROM users WHERE email = ? COLLATE NOCASE", c.Email).Scan(&userID)
+		if userID != "" && !p.TrustsEmail() {
+			return "", http.StatusConflict, errAccountExists
+		}
+	}
+	if userID == "" {
+		userID, err = h.createExternalUser(c)
+		if err != nil {
+			return "", http.StatusConflict, err
+		}
+	}
+	if _, err := h.DB.Exec("INSERT INTO user_identities(id, user_id, provider, subject, email) VALUES(?,?,?,?,?)",
+		uuid.NewString(), userID, provider, c.Subject, c.Email); err != nil {
+		// UNIQUE(user_id, provider): the account already has another identity here
+		return "", http.StatusConflict, err
+	}
+	return userID, http.StatusOK, nil
+}
+
+func (h *OIDCHandler) createExternalUser(c *oidc.Claims) (string, error) {
+	first, last := c.GivenName, c.FamilyName
+	if first == "" && last == "" {
+		first, last, _ = strings.Cut(c.Name, " ")
+	}
+	if first == "" {
+		first = "User"
+	}
+	email := c.Email
+	if email == "" || !c.EmailVerified {
+		// keep the unique column populated without trusting an unverified address
+		email = c.Subject + "@external.invalid"
+	}
+	id := uuid.NewString()
+	// date_of_birth is unknown for external sign-ups; the user can fill it in later
+	if _, err := h.DB.Exec(`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES(?,?,?,?,?,?)`,
+		id, email, externalOnlyPasswordHash, first, last, ""); err != nil {
+		return "", err
+	}
+	_, _ = h.DB.Exec(`INSERT INTO profiles(user_id, public) VALUES(?,?)`, id, 1)
+	return id, nil
+}
+
+// ListIdentities returns the external identities linked to the caller.
+func (h *OIDCHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rows, err := h.DB.Query("SELECT id, provider, email, created_at FROM user_identities WHERE user_id = ? ORDER BY created_at ASC", sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type identity struct {
+		ID        string `json:"id"`
+		Provider  string `json:"provider"`
+		Email     string `json:"email"`
+		CreatedAt string `json:"created_at"`
+	}
+	out := []identity{}
+	for rows.Next() {
+		var i identity
+		var email sql.NullString
+		_ = rows.Scan(&i.ID, &i.Provider, &email, &i.CreatedAt)
+		i.Email = email.String
+		out = append(out, i)
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// Unlink removes an external identity, unless it is the account's only way
+// to sign in.
+func (h *OIDCHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var hash string
+	var identities int
+	_ = h.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", sess.UserID).Scan(&hash)
+	_ = h.DB.QueryRow("SELECT COUNT(1) FROM user_identities WHERE user_id = ?", sess.UserID).Scan(&identities)
+	if hash == externalOnlyPasswordHash && identities <= 1 {
+		http.Error(w, "cannot remove the only sign-in method", http.StatusConflict)
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM user_identities WHERE id = ? AND user_id = ?", id, sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/db"
+	"social-network/backend/internal/oidc"
+	"social-network/backend/internal/oidc/oidctest"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestDB opens a migrated database in a temporary directory.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.OpenSQLite(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.ApplyMigrations(conn, "../db/migrations/sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+type oidcFixture struct {
+	t      *testing.T
+	db     *sql.DB
+	idp    *oidctest.Server
+	router http.Handler
+}
+
+func newOIDCFixture(t *testing.T, trustEmail bool) *oidcFixture {
+	t.Helper()
+	conn := newTestDB(t)
+	idp := oidctest.NewServer()
+	t.Cleanup(idp.Close)
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:        "mock",
+		Issuer:      idp.Issuer(),
+		ClientID:    "client-1",
+		RedirectURL: "http://app.test/api/auth/oidc/mock/callback",
+		TrustEmail:  trustEmail,
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &OIDCHandler{DB: conn, Providers: map[string]*oidc.Provider{"mock": p}, PostLoginRedirect: "/feed", SessionTTL: time.Hour}
+	r := chi.NewRouter()
+	r.Get("/api/auth/oidc/{provider}/login", h.Login)
+	r.Get("/api/auth/oidc/{provider}/callback", h.Callback)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, conn) }).Post("/api/auth/oidc/{provider}/link", h.Link)
+	return &oidcFixture{t: t, db: conn, idp: idp, router: r}
+}
+
+func (f *oidcFixture) do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func cookieNamed(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// providerRedirect follows the provider's authorization endpoint and
+// returns the callback path and query it sends the browser back to.
+func (f *oidcFixture) providerRedirect(authURL string) string {
+	f.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return back.RequestURI()
+}
+
+// start begins a sign-in and returns the state cookie and the callback the
+// provider answers with.
+func (f *oidcFixture) start() (*http.Cookie, string) {
+	f.t.Helper()
+	rec := f.do(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/mock/login", nil))
+	if rec.Code != http.StatusFound {
+		f.t.Fatalf("login: status %d", rec.Code)
+	}
+	state := cookieNamed(rec, oidcStateCookie)
+	if state == nil {
+		f.t.Fatal("login set no state cookie")
+	}
+	return state, f.providerRedirect(rec.Header().Get("Location"))
+}
+
+func (f *oidcFixture) callback(callback string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	return f.do(req)
+}
+
+func (f *oidcFixture) createUser(email string) string {
+	f.t.Helper()
+	id := "user-" + email
+	if _, err := f.db.Exec(`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES(?,?,?,?,?,?)`,
+		id, email, "hash", "Local", "User", "2000-01-01"); err != nil {
+		f.t.Fatal(err)
+	}
+	if _, err := f.db.Exec(`INSERT INTO profiles(user_id, public) VALUES(?, 1)`, id); err != nil {
+		f.t.Fatal(err)
+	}
+	return id
+}
+
+func (f *oidcFixture) linkedUser(subject string) string {
+	var userID string
+	_ = f.db.QueryRow("SELECT user_id FROM user_identities WHERE provider = 'mock' AND subject = ?", subject).Scan(&userID)
+	return userID
+}
+
+func TestOIDCLoginCreatesAccount(t *testing.T) {
+	f := newOIDCFixture(t, false)
+	f.idp.SetUser(oidctest.User{Subject: "sub-1", Email: "new@example.com", EmailVerified: true, GivenName: "Ada"})
+
+	state, cb := f.start()
+	rec := f.callback(cb, state)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/feed" {
+		t.Fatalf("callback: status %d, location %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	if cookieNamed(rec, auth.SessionCookieName) == nil {
+		t.Error("no session cookie after sign-in")
+	}
+	userID := f.linkedUser("sub-1")
+	var email, first string
+	if err := f.db.QueryRow("SELECT email, first_name FROM users WHERE id = ?", userID).Scan(&email, &first); err != nil {
+		t.Fatal(err)
+	}
+	if email != "new@example.com" || first != "Ada" {
+		t.Errorf("user = %q %q", email, first)
+	}
+
+	// the same identity signs in to the same account
+	state, cb = f.start()
+	if rec := f.callback(cb, state); rec.Code != http.StatusFound {
+		t.Fatalf("second sign-in: status %d", rec.Code)
+	}
+	var n int
+	_ = f.db.QueryRow("SELECT COUNT(1) FROM users").Scan(&n)
+	if n != 1 {
+		t.Errorf("%d users after two sign-ins, want 1", n)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	f := newOIDCFixture(t, false)
+	f.idp.SetUser(oidctest.User{Subject: "sub-1"})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		_, cb := f.start()
+		if rec := f.callback(cb); rec.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", rec.Code)
+		}
+	})
+	t.Run("cookie from another flow", func(t *testing.T) {
+		other, _ := f.start()
+		_, cb := f.start()
+		if rec := f.callback(cb, other); rec.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", rec.Code)
+		}
+	})
+	t.Run("replayed", func(t *testing.T) {
+		state, cb := f.start()
+		if rec := f.callback(cb, state); rec.Code != http.StatusFound {
+			t.Fatalf("first callback: status %d", rec.Code)
+		}
+		if rec := f.callback(cb, state); rec.Code != http.StatusBadRequest {
+			t.Errorf("replay: status %d, want 400", rec.Code)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		state, cb := f.start()
+		_, _ = f.db.Exec("UPDATE oidc_login_states SET expires_at = ? WHERE state = ?", time.Now().Add(-time.Minute), state.Value)
+		if rec := f.callback(cb, state); rec.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestOIDCCallbackRejectsBadToken(t *testing.T) {
+	f := newOIDCFixture(t, false)
+	f.idp.SetUser(oidctest.User{Subject: "sub-1"})
+	for name, edit := range map[string]func(map[string]any){
+		"nonce":    func(c map[string]any) { c["nonce"] = "other" },
+		"audience": func(c map[string]any) { c["aud"] = "other-client" },
+		"issuer":   func(c map[string]any) { c["iss"] = "https://evil.example" },
+		"expired":  func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			f.idp.Claims = edit
+			defer func() { f.idp.Claims = nil }()
+			state, cb := f.start()
+			if rec := f.callback(cb, state); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status %d, want 401", rec.Code)
+			}
+		})
+	}
+	if id := f.linkedUser("sub-1"); id != "" {
+		t.Errorf("rejected tokens linked the identity to %s", id)
+	}
+}
+
+func TestOIDCExistingEmailUntrusted(t *testing.T) {
+	f := newOIDCFixture(t, false)
+	f.createUser("taken@example.com")
+	f.idp.SetUser(oidctest.User{Subject: "sub-1", Email: "Taken@example.com", EmailVerified: true})
+
+	state, cb := f.start()
+	rec := f.callback(cb, state)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", rec.Code)
+	}
+	if cookieNamed(rec, auth.SessionCookieName) != nil {
+		t.Error("session cookie set for a refused sign-in")
+	}
+	if id := f.linkedUser("sub-1"); id != "" {
+		t.Errorf("identity linked to %s", id)
+	}
+}
+
+func TestOIDCExistingEmailTrusted(t *testing.T) {
+	f := newOIDCFixture(t, true)
+	userID := f.createUser("taken@example.com")
+	f.idp.SetUser(oidctest.User{Subject: "sub-1", Email: "taken@example.com", EmailVerified: true})
+
+	state, cb := f.start()
+	if rec := f.callback(cb, state); rec.Code != http.StatusFound {
+		t.Fatalf("status %d, want 302", rec.Code)
+	}
+	if id := f.linkedUser("sub-1"); id != userID {
+		t.Errorf("identity linked to %q, want %q", id, userID)
+	}
+}
+
+func TestOIDCUnverifiedEmailNeverLinks(t *testing.T) {
+	f := newOIDCFixture(t, true)
+	userID := f.createUser("taken@example.com")
+	f.idp.SetUser(oidctest.User{Subject: "sub-1", Email: "taken@example.com"})
+
+	state, cb := f.start()
+	if rec := f.callback(cb, state); rec.Code != http.StatusFound {
+		t.Fatalf("status %d, want 302", rec.Code)
+	}
+	if id := f.linkedUser("sub-1"); id == "" || id == userID {
+		t.Errorf("identity linked to %q, want a new account", id)
+	}
+}
+
+func TestOIDCExplicitLink(t *testing.T) {
+	f := newOIDCFixture(t, false)
+	userID := f.createUser("taken@example.com")
+	sess, err := auth.CreateSession(f.db, userID, time.Hour, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.idp.SetUser(oidctest.User{Subject: "sub-1", Email: "taken@example.com", EmailVerified: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/link", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: sess.ID})
+	rec := f.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("link: status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct{ URL string }
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	state := cookieNamed(rec, oidcStateCookie)
+	if rec := f.callback(f.providerRedirect(body.URL), state); rec.Code != http.StatusFound {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	if id := f.linkedUser("sub-1"); id != userID {
+		t.Errorf("identity linked to %q, want %q", id, userID)
+	}
+}
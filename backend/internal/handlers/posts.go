@@ -3,15 +3,28 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
 	"net/http"
 	"time"
 
 	"social-network/backend/internal/auth"
+	"social-network/backend/internal/imaging"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
 
 	"github.com/google/uuid"
 )
 
-type PostsHandler struct{ DB *sql.DB }
+type PostsHandler struct {
+	DB             *sql.DB
+	Media          services.MediaStore
+	MaxUploadBytes int64 // per image
+	MaxImages      int
+	Limits         imaging.Limits
+}
 
 type createPostRequest struct {
 	Text    string   `json:"text"`
@@ -19,6 +32,10 @@ type createPostRequest struct {
 	Allowed []string `json:"allowed_follower_ids"`
 }
 
+// CreatePost accepts either JSON or a multipart form with the same fields
+// plus up to MaxImages "images" files. Images are validated before anything
+// is written, and the post and its images are committed together: if any
+// step fails, the post is not created and stored files are removed.
 func (h *PostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -26,26 +43,121 @@ func (h *PostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var body createPostRequest
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	var images []*imaging.Result
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		if body, images, ok = h.readMultipartPost(w, r); !ok {
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	if body.Text == "" || (body.Privacy != "public" && body.Privacy != "followers" && body.Privacy != "selected") {
+	if (body.Text == "" && len(images) == 0) || (body.Privacy != "public" && body.Privacy != "followers" && body.Privacy != "selected") {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 	id := uuid.NewString()
-	_, err := h.DB.Exec("INSERT INTO posts(id, user_id, text, privacy, created_at) VALUES(?,?,?,?,?)", id, sess.UserID, body.Text, body.Privacy, time.Now())
+
+	// files go to the media store first so the transaction stays short
+	var stored []*services.StoredImage
+	discard := func() {
+		for _, img := range stored {
+			services.DiscardImage(r.Context(), h.DB, h.Media, img)
+		}
+	}
+	for _, res := range images {
+		img, err := services.PutImage(r.Context(), h.Media, res, services.PutOptions{Kind: services.MediaPostImage, OwnerID: id})
+		stored = append(stored, img)
+		if err != nil {
+			discard()
+			log.Printf("%s upload error: %v", h.Media.Name(), err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	type image struct {
+		ID       string `json:"id"`
+		URL      string `json:"url"`
+		Format   string `json:"format"`
+		Width    int    `json:"width"`
+		Height   int    `json:"height"`
+		Blurhash string `json:"blurhash"`
+	}
+	out := []image{}
+	err := func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("INSERT INTO posts(id, user_id, text, privacy, created_at) VALUES(?,?,?,?,?)", id, sess.UserID, body.Text, body.Privacy, time.Now()); err != nil {
+			return err
+		}
+		if body.Privacy == "selected" {
+			for _, uid := range body.Allowed {
+				_, _ = tx.Exec("INSERT OR IGNORE INTO post_allowed_followers(post_id, follower_user_id) VALUES(?,?)", id, uid)
+			}
+		}
+		for i, img := range stored {
+			imageID, err := insertPostImage(tx, h.Media, id, images[i], img)
+			if err != nil {
+				return fmt.Errorf("image %d: %w", i, err)
+			}
+			out = append(out, image{imageID, img.Main.SecureURL, img.Main.Format, images[i].Main.Width, images[i].Main.Height, img.Blurhash})
+		}
+		return tx.Commit()
+	}()
 	if err != nil {
+		discard()
+		log.Printf("create post: %v", err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
-	if body.Privacy == "selected" {
-		for _, uid := range body.Allowed {
-			_, _ = h.DB.Exec("INSERT OR IGNORE INTO post_allowed_followers(post_id, follower_user_id) VALUES(?,?)", id, uid)
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "images": out})
+}
+
+// readMultipartPost parses a multipart post and runs every image through the
+// imaging pipeline. It writes the error response itself when ok is false.
+func (h *PostsHandler) readMultipartPost(w http.ResponseWriter, r *http.Request) (body createPostRequest, images []*imaging.Result, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadBytes*int64(max(h.MaxImages, 1))+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "bad request", http.StatusBadRequest)
 		}
+		return body, nil, false
 	}
-	_ = json.NewEncoder(w).Encode(map[string]string{"id": id})
+	body.Text = r.FormValue("text")
+	body.Privacy = r.FormValue("privacy")
+	body.Allowed = r.MultipartForm.Value["allowed_follower_ids"]
+
+	files := r.MultipartForm.File["images"]
+	if len(files) > h.MaxImages {
+		http.Error(w, fmt.Sprintf("at most %d images per post", h.MaxImages), http.StatusBadRequest)
+		return body, nil, false
+	}
+	for _, fh := range files {
+		if fh.Size > h.MaxUploadBytes {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return body, nil, false
+		}
+		f, err := fh.Open()
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return body, nil, false
+		}
+		res, err := imaging.Process(f, imaging.PostImageSpec, h.Limits)
+		f.Close()
+		if err != nil {
+			writeImageError(w, err)
+			return body, nil, false
+		}
+		images = append(images, res)
+	}
+	return body, images, true
 }
 
 // Simple feed: posts visible to current user by privacy rules
@@ -60,26 +172,31 @@ func (h *PostsHandler) Feed(w http.ResponseWriter, r *http.Request) {
 	SELECT p.id, p.user_id, p.text, p.privacy, p.created_at, u.first_name, u.last_name,
 	       pi.id as image_id, 
 	       COALESCE(pi.cloudinary_secure_url, pi.cloudinary_url, '/images/' || pi.path) as image_url,
-	       pi.format as image_format
+	       pi.format as image_format, pi.width, pi.height, pi.blurhash
 	FROM posts p
 	JOIN users u ON u.id = p.user_id
 	LEFT JOIN follows f ON f.followed_user_id = p.user_id AND f.follower_user_id = ?
 	LEFT JOIN post_allowed_followers paf ON paf.post_id = p.id AND paf.follower_user_id = ?
 	LEFT JOIN post_images pi ON pi.post_id = p.id
-	WHERE p.privacy = 'public'
+	WHERE (p.privacy = 'public'
 	   OR (p.privacy = 'followers' AND f.follower_user_id IS NOT NULL)
-	   OR (p.privacy = 'selected' AND paf.follower_user_id IS NOT NULL)
+	   OR (p.privacy = 'selected' AND paf.follower_user_id IS NOT NULL))
+	  AND p.hidden_at IS NULL
+	  AND ` + notMuted("p.user_id") + `
 	ORDER BY p.created_at DESC LIMIT 100`
-	rows, err := h.DB.Query(q, sess.UserID, sess.UserID)
+	rows, err := h.DB.Query(q, sess.UserID, sess.UserID, sess.UserID, sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 	type image struct {
-		ID     string `json:"id"`
-		URL    string `json:"url"`
-		Format string `json:"format"`
+		ID       string `json:"id"`
+		URL      string `json:"url"`
+		Format   string `json:"format"`
+		Width    int    `json:"width,omitempty"`
+		Height   int    `json:"height,omitempty"`
+		Blurhash string `json:"blurhash,omitempty"`
 	}
 	type post struct {
 		ID        string  `json:"ID"`
@@ -90,6 +207,8 @@ func (h *PostsHandler) Feed(w http.ResponseWriter, r *http.Request) {
 		FirstName string  `json:"FirstName"`
 		LastName  string  `json:"LastName"`
 		Images    []image `json:"images"`
+
+		Author websocket.UserSummary `json:"author"`
 	}
 
 	// Group posts and their images while preserving order
@@ -98,27 +217,28 @@ func (h *PostsHandler) Feed(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var p post
-		var imageID, imageURL, imageFormat sql.NullString
-		_ = rows.Scan(&p.ID, &p.UserID, &p.Text, &p.Privacy, &p.CreatedAt, &p.FirstName, &p.LastName, &imageID, &imageURL, &imageFormat)
+		var imageID, imageURL, imageFormat, blurhash sql.NullString
+		var width, height sql.NullInt64
+		_ = rows.Scan(&p.ID, &p.UserID, &p.Text, &p.Privacy, &p.CreatedAt, &p.FirstName, &p.LastName, &imageID, &imageURL, &imageFormat, &width, &height, &blurhash)
+		img := image{
+			ID:       imageID.String,
+			URL:      imageURL.String,
+			Format:   imageFormat.String,
+			Width:    int(width.Int64),
+			Height:   int(height.Int64),
+			Blurhash: blurhash.String,
+		}
 
 		if existingPost, exists := postMap[p.ID]; exists {
 			// Add image to existing post
 			if imageID.Valid {
-				existingPost.Images = append(existingPost.Images, image{
-					ID:     imageID.String,
-					URL:    imageURL.String,
-					Format: imageFormat.String,
-				})
+				existingPost.Images = append(existingPost.Images, img)
 			}
 		} else {
 			// Create new post
 			p.Images = []image{}
 			if imageID.Valid {
-				p.Images = append(p.Images, image{
-					ID:     imageID.String,
-					URL:    imageURL.String,
-					Format: imageFormat.String,
-				})
+				p.Images = append(p.Images, img)
 			}
 			postMap[p.ID] = &p
 			postOrder = append(postOrder, p.ID) // Track order
@@ -127,11 +247,17 @@ func (h *PostsHandler) Feed(w http.ResponseWriter, r *http.Request) {
 
 	// Convert map to slice in the correct order
 	var out []post
+	var authorIDs []string
 	for _, postID := range postOrder {
 		if p, exists := postMap[postID]; exists {
 			out = append(out, *p)
+			authorIDs = append(authorIDs, p.UserID)
 		}
 	}
+	authors := loadUserSummaries(h.DB, authorIDs, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].Author = authors[out[i].UserID]
+	}
 	_ = json.NewEncoder(w).Encode(out)
 }
 
@@ -153,15 +279,16 @@ func (h *PostsHandler) GetPostImages(w http.ResponseWriter, r *http.Request) {
 	FROM posts p
 	LEFT JOIN follows f ON f.followed_user_id = p.user_id AND f.follower_user_id = ?
 	LEFT JOIN post_allowed_followers paf ON paf.post_id = p.id AND paf.follower_user_id = ?
-	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))`
+	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))
+	AND p.hidden_at IS NULL AND ` + notBlocked("p.user_id")
 	var cnt int
-	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID).Scan(&cnt)
+	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID, sess.UserID, sess.UserID).Scan(&cnt)
 	if cnt == 0 {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	rows, err := h.DB.Query("SELECT id, path, mime FROM post_images WHERE post_id = ? ORDER BY created_at ASC", postID)
+	rows, err := h.DB.Query("SELECT id, path, mime, COALESCE(width, 0), COALESCE(height, 0), COALESCE(blurhash, '') FROM post_images WHERE post_id = ? ORDER BY created_at ASC", postID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -169,14 +296,17 @@ func (h *PostsHandler) GetPostImages(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type image struct {
-		ID   string `json:"id"`
-		Path string `json:"path"`
-		Mime string `json:"mime"`
+		ID       string `json:"id"`
+		Path     string `json:"path"`
+		Mime     string `json:"mime"`
+		Width    int    `json:"width"`
+		Height   int    `json:"height"`
+		Blurhash string `json:"blurhash"`
 	}
 	var out []image
 	for rows.Next() {
 		var img image
-		_ = rows.Scan(&img.ID, &img.Path, &img.Mime)
+		_ = rows.Scan(&img.ID, &img.Path, &img.Mime, &img.Width, &img.Height, &img.Blurhash)
 		out = append(out, img)
 	}
 	_ = json.NewEncoder(w).Encode(out)
@@ -202,9 +332,10 @@ func (h *PostsHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	FROM posts p
 	LEFT JOIN follows f ON f.followed_user_id = p.user_id AND f.follower_user_id = ?
 	LEFT JOIN post_allowed_followers paf ON paf.post_id = p.id AND paf.follower_user_id = ?
-	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))`
+	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))
+	AND p.hidden_at IS NULL AND ` + notBlocked("p.user_id")
 	var cnt int
-	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID).Scan(&cnt)
+	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID, sess.UserID, sess.UserID).Scan(&cnt)
 	if cnt == 0 {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
@@ -247,30 +378,39 @@ func (h *PostsHandler) ListComments(w http.ResponseWriter, r *http.Request) {
 	FROM posts p
 	LEFT JOIN follows f ON f.followed_user_id = p.user_id AND f.follower_user_id = ?
 	LEFT JOIN post_allowed_followers paf ON paf.post_id = p.id AND paf.follower_user_id = ?
-	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))`
+	WHERE p.id = ? AND (p.privacy='public' OR (p.privacy='followers' AND f.follower_user_id IS NOT NULL) OR (p.privacy='selected' AND paf.follower_user_id IS NOT NULL))
+	AND p.hidden_at IS NULL AND ` + notBlocked("p.user_id")
 	var cnt int
-	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID).Scan(&cnt)
+	_ = h.DB.QueryRow(visibleQ, sess.UserID, sess.UserID, postID, sess.UserID, sess.UserID).Scan(&cnt)
 	if cnt == 0 {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
-	rows, err := h.DB.Query("SELECT id, user_id, text, created_at FROM comments WHERE post_id = ? ORDER BY created_at ASC", postID)
+	rows, err := h.DB.Query("SELECT id, user_id, text, created_at FROM comments WHERE post_id = ? AND hidden_at IS NULL AND "+notBlocked("user_id")+" ORDER BY created_at ASC",
+		postID, sess.UserID, sess.UserID)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 	type comment struct {
-		ID        string `json:"id"`
-		UserID    string `json:"user_id"`
-		Text      string `json:"text"`
-		CreatedAt string `json:"created_at"`
+		ID        string                `json:"id"`
+		UserID    string                `json:"user_id"`
+		Text      string                `json:"text"`
+		CreatedAt string                `json:"created_at"`
+		Author    websocket.UserSummary `json:"author"`
 	}
 	var out []comment
+	var authorIDs []string
 	for rows.Next() {
 		var c comment
 		_ = rows.Scan(&c.ID, &c.UserID, &c.Text, &c.CreatedAt)
 		out = append(out, c)
+		authorIDs = append(authorIDs, c.UserID)
+	}
+	authors := loadUserSummaries(h.DB, authorIDs, avatarSize(r, avatarThumb))
+	for i := range out {
+		out[i].Author = authors[out[i].UserID]
 	}
 	_ = json.NewEncoder(w).Encode(out)
 }
@@ -293,6 +433,9 @@ func (h *PostsHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	var canView bool
 	if userID == sess.UserID {
 		canView = true
+	} else if isBlocked(h.DB, sess.UserID, userID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
 	} else {
 		// Check if the target user is public or if the requester follows them
 		var isPublic int
@@ -311,7 +454,7 @@ func (h *PostsHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	q := `
 	SELECT p.id, p.user_id, p.text, p.privacy, p.created_at
 	FROM posts p
-	WHERE p.user_id = ?
+	WHERE p.user_id = ? AND p.hidden_at IS NULL
 	AND (p.privacy = 'public' 
 		OR (p.privacy = 'followers' AND ? = 1)
 		OR p.user_id = ?)
@@ -327,10 +470,12 @@ func (h *PostsHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	type post struct {
 		ID, UserID, Text, Privacy string
 		CreatedAt                 string
+		Author                    websocket.UserSummary `json:"author"`
 	}
 	var out []post
+	author := loadUserSummary(h.DB, userID, avatarSize(r, avatarThumb))
 	for rows.Next() {
-		var p post
+		p := post{Author: *author}
 		_ = rows.Scan(&p.ID, &p.UserID, &p.Text, &p.Privacy, &p.CreatedAt)
 		out = append(out, p)
 	}
@@ -24,6 +24,9 @@ func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		viewerID = s.UserID
 	}
 	userID := chi.URLParam(r, "id")
+	if !requireProfileRead(w, h.DB, viewerID, userID) {
+		return
+	}
 	var public int
 	var nickname, about, avatar sql.NullString
 	var first, last, email sql.NullString
@@ -33,19 +36,17 @@ func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	// if profile is private and viewer is not owner, ensure viewer follows the user
 	isFollowing := 0
-	if public == 0 && viewerID != userID {
-		_ = h.DB.QueryRow("SELECT COUNT(1) FROM follows WHERE follower_user_id = ? AND followed_user_id = ?", viewerID, userID).Scan(&isFollowing)
-		if isFollowing == 0 {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
-		}
-	} else if viewerID != "" {
+	if viewerID != "" {
 		// set isFollowing for viewer
 		_ = h.DB.QueryRow("SELECT COUNT(1) FROM follows WHERE follower_user_id = ? AND followed_user_id = ?", viewerID, userID).Scan(&isFollowing)
 	}
 
+	var isMuted bool
+	if viewerID != "" && viewerID != userID {
+		_ = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM user_mutes WHERE muter_user_id = ? AND muted_user_id = ?)", viewerID, userID).Scan(&isMuted)
+	}
+
 	// follower / following counts
 	var followersCount, followingCount int
 	_ = h.DB.QueryRow("SELECT COUNT(1) FROM follows WHERE followed_user_id = ?", userID).Scan(&followersCount)
@@ -57,11 +58,13 @@ func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		"nickname":        nickname.String,
 		"about":           about.String,
 		"avatar_path":     avatar.String,
+		"user":            userSummary(userID, first.String, last.String, nickname.String, avatar.String, avatarSize(r, avatarFull)),
 		"first_name":      first.String,
 		"last_name":       last.String,
 		"followers_count": followersCount,
 		"following_count": followingCount,
 		"is_following":    isFollowing == 1,
+		"is_muted":        isMuted,
 	}
 	// only include sensitive fields for the profile owner
 	if viewerID == userID {
@@ -72,6 +75,32 @@ func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(out)
 }
 
+// requireProfileRead applies the profile privacy rules for viewerID (empty
+// when signed out). It writes 404 when the profile is missing or either
+// user blocked the other, and 403 when it is private and the viewer
+// neither owns nor follows it.
+func requireProfileRead(w http.ResponseWriter, db *sql.DB, viewerID, userID string) bool {
+	if viewerID == userID {
+		return true
+	}
+	if viewerID != "" && isBlocked(db, viewerID, userID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	}
+	var public, following bool
+	err := db.QueryRow(`SELECT p.public, EXISTS(SELECT 1 FROM follows WHERE follower_user_id = ? AND followed_user_id = p.user_id)
+		FROM profiles p WHERE p.user_id = ?`, viewerID, userID).Scan(&public, &following)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	}
+	if !public && !following {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 func (h *ProfileHandler) TogglePrivacy(w http.ResponseWriter, r *http.Request) {
 	sess, ok := auth.SessionFromContext(r)
 	if !ok {
@@ -87,12 +116,29 @@ func (h *ProfileHandler) TogglePrivacy(w http.ResponseWriter, r *http.Request) {
 	if body.Public {
 		val = 1
 	}
-	_, err := h.DB.Exec("UPDATE profiles SET public = ? WHERE user_id = ?", val, sess.UserID)
+	tx, err := h.DB.Begin()
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
-	_ = json.NewEncoder(w).Encode(map[string]any{"public": body.Public})
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE profiles SET public = ? WHERE user_id = ?", val, sess.UserID); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// a public profile needs no approval, so whoever is waiting gets in
+	accepted := 0
+	if body.Public {
+		if accepted, err = acceptPendingRequests(tx, sess.UserID); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"public": body.Public, "accepted_requests": accepted})
 }
 
 type profileUpdate struct {
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ReportsHandler takes reports of abusive content, users and groups and runs
+// the moderation queues: reports about something posted in a group go to
+// that group's admins, all others to the site moderators. Every action
+// taken on a report is written to moderation_actions, which can't be
+// changed afterwards.
+type ReportsHandler struct {
+	DB  *sql.DB
+	Hub *websocket.Hub
+}
+
+var reportReasons = map[string]bool{
+	"spam": true, "harassment": true, "hate": true, "violence": true,
+	"sexual": true, "self_harm": true, "misinformation": true, "other": true,
+}
+
+const maxReportDetails = 1000
+
+// reportExcerpt is how much of reported content the queue shows.
+const reportExcerpt = 200
+
+// contentTables maps the reportable kinds of content to their tables.
+var contentTables = map[string]string{
+	"post":           "posts",
+	"comment":        "comments",
+	"group_post":     "group_posts",
+	"group_comment":  "group_comments",
+	"direct_message": "direct_messages",
+	"group_message":  "group_messages",
+}
+
+// Moderation actions on a report.
+const (
+	modDismiss = "dismiss"
+	modHide    = "hide"
+	modDelete  = "delete"
+	modSuspend = "suspend" // the account, or for group staff a ban from the group
+)
+
+// reportSubject finds what userID is reporting and returns who it belongs
+// to and, for content posted in a group, the group. The error is
+// sql.ErrNoRows when the subject doesn't exist or userID can't see it.
+func reportSubject(db *sql.DB, typ, id, userID string) (owner, gid string, err error) {
+	switch typ {
+	case "post":
+		err = db.QueryRow("SELECT user_id FROM posts WHERE id = ? AND hidden_at IS NULL", id).Scan(&owner)
+		if err == nil && !postVisible(db, id, userID) {
+			err = sql.ErrNoRows
+		}
+	case "comment":
+		var postID string
+		err = db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ? AND hidden_at IS NULL", id).Scan(&owner, &postID)
+		if err == nil && !postVisible(db, postID, userID) {
+			err = sql.ErrNoRows
+		}
+	case "group_post", "group_comment":
+		q := "SELECT user_id, group_id FROM group_posts WHERE id = ? AND hidden_at IS NULL"
+		if typ == "group_comment" {
+			q = `SELECT c.user_id, p.group_id FROM group_comments c JOIN group_posts p ON p.id = c.group_post_id
+				WHERE c.id = ? AND c.hidden_at IS NULL AND p.hidden_at IS NULL`
+		}
+		if err = db.QueryRow(q, id).Scan(&owner, &gid); err == nil {
+			if a, aerr := loadGroupAccess(db, gid, userID); aerr != nil || !a.visible() || !a.canRead() {
+				err = sql.ErrNoRows
+			}
+		}
+	case "group_message":
+		if err = db.QueryRow("SELECT from_user_id, group_id FROM group_messages WHERE id = ? AND hidden_at IS NULL", id).Scan(&owner, &gid); err == nil {
+			if role, _ := groupRole(db, gid, userID); role == "" {
+				err = sql.ErrNoRows
+			}
+		}
+	case "direct_message":
+		// only messages the reporter received
+		err = db.QueryRow("SELECT from_user_id FROM direct_messages WHERE id = ? AND to_user_id = ? AND hidden_at IS NULL", id, userID).Scan(&owner)
+	case "user":
+		err = db.QueryRow("SELECT id FROM users WHERE id = ?", id).Scan(&owner)
+	case "group":
+		// the group itself is for the site moderators, not its own admins
+		err = db.QueryRow("SELECT owner_user_id FROM groups WHERE id = ?", id).Scan(&owner)
+		if err == nil && groupHidden(db, id, userID) {
+			err = sql.ErrNoRows
+		}
+	default:
+		err = sql.ErrNoRows
+	}
+	return owner, gid, err
+}
+
+// postVisible reports whether userID may see the post, by the feed's rules.
+func postVisible(db *sql.DB, postID, userID string) bool {
+	var visible bool
+	_ = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM posts p
+		LEFT JOIN follows f ON f.followed_user_id = p.user_id AND f.follower_user_id = ?1
+		LEFT JOIN post_allowed_followers paf ON paf.post_id = p.id AND paf.follower_user_id = ?1
+		WHERE p.id = ?2 AND p.hidden_at IS NULL
+		AND (p.user_id = ?1 OR p.privacy = 'public' OR (p.privacy = 'followers' AND f.follower_user_id IS NOT NULL)
+			OR (p.privacy = 'selected' AND paf.follower_user_id IS NOT NULL))
+		AND `+notBlocked("p.user_id")+`)`, userID, postID, userID, userID).Scan(&visible)
+	return visible
+}
+
+// logModeration appends an action to the moderation log. reportID and gid
+// may be empty.
+func logModeration(db services.Execer, reportID, actorID, action, typ, subjectID, subjectUserID, gid, note string) error {
+	_, err := db.Exec(`INSERT INTO moderation_actions(id, report_id, actor_user_id, action, subject_type, subject_id, subject_user_id, group_id, note)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`, uuid.NewString(), sql.NullString{String: reportID, Valid: reportID != ""}, actorID, action, typ, subjectID,
+		sql.NullString{String: subjectUserID, Valid: subjectUserID != ""}, sql.NullString{String: gid, Valid: gid != ""}, note)
+	return err
+}
+
+// suspendAccount suspends a user and ends their sessions.
+func suspendAccount(db services.Execer, userID string) error {
+	if _, err := db.Exec("UPDATE users SET suspended_at = CURRENT_TIMESTAMP WHERE id = ? AND suspended_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+type reportReq struct {
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Reason      string `json:"reason"`
+	Details     string `json:"details"`
+}
+
+// Create reports a post, comment, group post or comment, message, user or
+// group. A user has at most one open report per subject.
+func (h *ReportsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body reportReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SubjectID == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body.Details = strings.TrimSpace(body.Details)
+	if !reportReasons[body.Reason] {
+		http.Error(w, "unknown reason", http.StatusBadRequest)
+		return
+	}
+	if len(body.Details) > maxReportDetails {
+		http.Error(w, "details too long", http.StatusBadRequest)
+		return
+	}
+	owner, gid, err := reportSubject(h.DB, body.SubjectType, body.SubjectID, sess.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if owner == sess.UserID {
+		http.Error(w, "cannot report yourself", http.StatusBadRequest)
+		return
+	}
+	var open bool
+	_ = h.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM reports WHERE reporter_user_id = ? AND subject_type = ? AND subject_id = ? AND status = 'open')`,
+		sess.UserID, body.SubjectType, body.SubjectID).Scan(&open)
+	if open {
+		http.Error(w, "already reported", http.StatusConflict)
+		return
+	}
+	id := uuid.NewString()
+	_, err = h.DB.Exec(`INSERT INTO reports(id, reporter_user_id, subject_type, subject_id, subject_user_id, group_id, reason, details)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`, id, sess.UserID, body.SubjectType, body.SubjectID,
+		sql.NullString{String: owner, Valid: owner != ""}, sql.NullString{String: gid, Valid: gid != ""}, body.Reason, body.Details)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "open"})
+}
+
+type report struct {
+	ID          string                 `json:"id"`
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	GroupID     string                 `json:"group_id,omitempty"`
+	Reason      string                 `json:"reason"`
+	Details     string                 `json:"details,omitempty"`
+	Status      string                 `json:"status"`
+	Excerpt     string                 `json:"excerpt,omitempty"`
+	OpenReports int                    `json:"open_reports"` // on the same subject
+	CreatedAt   time.Time              `json:"created_at"`
+	ResolvedAt  *time.Time             `json:"resolved_at,omitempty"`
+	Reporter    *websocket.UserSummary `json:"reporter,omitempty"`
+	SubjectUser *websocket.UserSummary `json:"subject_user,omitempty"`
+	ResolvedBy  *websocket.UserSummary `json:"resolved_by,omitempty"`
+
+	reporterID, subjectUserID, resolvedByID string
+}
+
+// queue lists the reports with the status asked for (open by default) in
+// the group's queue, or the site queue when gid is "". Open reports come
+// oldest first, resolved ones newest first.
+func (h *ReportsHandler) queue(w http.ResponseWriter, r *http.Request, gid string) {
+	status := r.URL.Query().Get("status")
+	order := "DESC"
+	switch status {
+	case "":
+		status = "open"
+		fallthrough
+	case "open":
+		order = "ASC"
+	case "actioned", "dismissed":
+	default:
+		http.Error(w, "unknown status", http.StatusBadRequest)
+		return
+	}
+	rows, err := h.DB.Query(`SELECT r.id, r.subject_type, r.subject_id, COALESCE(r.group_id, ''), r.reason, r.details, r.status,
+		r.created_at, r.resolved_at, COALESCE(r.reporter_user_id, ''), COALESCE(r.subject_user_id, ''), COALESCE(r.resolved_by, ''),
+		(SELECT COUNT(*) FROM reports o WHERE o.subject_type = r.subject_type AND o.subject_id = r.subject_id AND o.status = 'open')
+		FROM reports r WHERE COALESCE(r.group_id, '') = ? AND r.status = ?
+		ORDER BY r.created_at `+order+` LIMIT 100`, gid, status)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	out := []*report{}
+	var ids []string
+	for rows.Next() {
+		rp := &report{}
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&rp.ID, &rp.SubjectType, &rp.SubjectID, &rp.GroupID, &rp.Reason, &rp.Details, &rp.Status,
+			&rp.CreatedAt, &resolvedAt, &rp.reporterID, &rp.subjectUserID, &rp.resolvedByID, &rp.OpenReports); err != nil {
+			continue
+		}
+		if resolvedAt.Valid {
+			rp.ResolvedAt = &resolvedAt.Time
+		}
+		out = append(out, rp)
+		ids = append(ids, rp.reporterID, rp.subjectUserID, rp.resolvedByID)
+	}
+	rows.Close()
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for _, rp := range out {
+		if table, ok := contentTables[rp.SubjectType]; ok {
+			var text string
+			if h.DB.QueryRow("SELECT text FROM "+table+" WHERE id = ?", rp.SubjectID).Scan(&text) == nil {
+				if runes := []rune(text); len(runes) > reportExcerpt {
+					text = string(runes[:reportExcerpt]) + "…"
+				}
+				rp.Excerpt = text
+			}
+		}
+		if u, ok := users[rp.reporterID]; ok {
+			rp.Reporter = &u
+		}
+		if u, ok := users[rp.subjectUserID]; ok {
+			rp.SubjectUser = &u
+		}
+		if u, ok := users[rp.resolvedByID]; ok {
+			rp.ResolvedBy = &u
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// List is the site moderators' queue: reports about users, groups and
+// anything not posted in a group.
+func (h *ReportsHandler) List(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !sess.HasRole(auth.RoleModerator) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.queue(w, r, "")
+}
+
+// GroupQueue is a group's queue of reports about what was posted in it.
+func (h *ReportsHandler) GroupQueue(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	gid := chi.URLParam(r, "id")
+	if _, ok := requireGroupPermission(w, h.DB, gid, sess.UserID, permReports); !ok {
+		return
+	}
+	h.queue(w, r, gid)
+}
+
+type resolveReq struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+// Resolve closes a report, and every other open report on the same subject,
+// with a moderation action: dismiss, hide or delete the reported content,
+// or suspend its author. Group admins working their group's queue can't
+// suspend accounts, so for them suspend bans the author from the group;
+// they can only act on content by members they outrank. Site moderators and
+// admins may resolve any report, acting on users below their own site role.
+func (h *ReportsHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var typ, subjectID, owner, gid, status string
+	err := h.DB.QueryRow(`SELECT subject_type, subject_id, COALESCE(subject_user_id, ''), COALESCE(group_id, ''), status
+		FROM reports WHERE id = ?`, chi.URLParam(r, "id")).Scan(&typ, &subjectID, &owner, &gid, &status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	site := sess.HasRole(auth.RoleModerator)
+	var role string
+	if !site {
+		if gid == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if role, ok = requireGroupPermission(w, h.DB, gid, sess.UserID, permReports); !ok {
+			return
+		}
+	}
+	var body resolveReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body.Note = strings.TrimSpace(body.Note)
+	table, isContent := contentTables[typ]
+	switch body.Action {
+	case modDismiss:
+	case modHide, modDelete:
+		if !isContent {
+			http.Error(w, "only content can be hidden or deleted", http.StatusBadRequest)
+			return
+		}
+	case modSuspend:
+		if owner == "" {
+			http.Error(w, "nobody to suspend", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if body.Action != modDismiss {
+		if owner == sess.UserID {
+			http.Error(w, "cannot moderate yourself", http.StatusBadRequest)
+			return
+		}
+		if site {
+			if ownerRole, err := siteRole(h.DB, owner); err == nil && !auth.RoleOutranks(sess.Role, ownerRole) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		} else if ownerRole, _ := groupRole(h.DB, gid, owner); ownerRole != "" && roleRank[ownerRole] >= roleRank[role] {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if status != "open" {
+		http.Error(w, "report already resolved", http.StatusConflict)
+		return
+	}
+
+	var resolved int64
+	err = func() error {
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		switch {
+		case body.Action == modHide:
+			_, err = tx.Exec("UPDATE "+table+" SET hidden_at = CURRENT_TIMESTAMP WHERE id = ? AND hidden_at IS NULL", subjectID)
+		case body.Action == modDelete:
+			_, err = tx.Exec("DELETE FROM "+table+" WHERE id = ?", subjectID)
+		case body.Action == modSuspend && site:
+			err = suspendAccount(tx, owner)
+		case body.Action == modSuspend:
+			err = banFromGroup(tx, gid, sess.UserID, owner, body.Note)
+		}
+		if err != nil {
+			return err
+		}
+		newStatus := "actioned"
+		if body.Action == modDismiss {
+			newStatus = "dismissed"
+		}
+		res, err := tx.Exec(`UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			WHERE subject_type = ? AND subject_id = ? AND status = 'open'`, newStatus, sess.UserID, typ, subjectID)
+		if resolved, err = rowsAffected(res, err); err != nil {
+			return err
+		}
+		if err := logModeration(tx, chi.URLParam(r, "id"), sess.UserID, body.Action, typ, subjectID, owner, gid, body.Note); err != nil {
+			return err
+		}
+		if gid != "" && body.Action != modSuspend {
+			// a group ban is audited by banFromGroup
+			auditGroup(tx, gid, sess.UserID, "report_"+body.Action, owner, typ+": "+body.Note)
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case body.Action == modSuspend && site:
+		h.Hub.DisconnectUser(owner)
+	case body.Action == modSuspend:
+		h.Hub.LeaveGroup(gid, owner)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "resolved", "action": body.Action, "reports_resolved": resolved})
+}
+
+// Actions lists the most recent moderation actions, for the site
+// moderators.
+func (h *ReportsHandler) Actions(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !sess.HasRole(auth.RoleModerator) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	rows, err := h.DB.Query(`SELECT id, COALESCE(report_id, ''), actor_user_id, action, subject_type, subject_id,
+		COALESCE(subject_user_id, ''), COALESCE(group_id, ''), note, created_at
+		FROM moderation_actions ORDER BY created_at DESC LIMIT 100`)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	type entry struct {
+		ID            string                 `json:"id"`
+		ReportID      string                 `json:"report_id,omitempty"`
+		ActorID       string                 `json:"actor_user_id"`
+		Action        string                 `json:"action"`
+		SubjectType   string                 `json:"subject_type"`
+		SubjectID     string                 `json:"subject_id"`
+		SubjectUserID string                 `json:"subject_user_id,omitempty"`
+		GroupID       string                 `json:"group_id,omitempty"`
+		Note          string                 `json:"note,omitempty"`
+		CreatedAt     time.Time              `json:"created_at"`
+		Actor         *websocket.UserSummary `json:"actor,omitempty"`
+		SubjectUser   *websocket.UserSummary `json:"subject_user,omitempty"`
+	}
+	out := []entry{}
+	var ids []string
+	for rows.Next() {
+		var e entry
+		if rows.Scan(&e.ID, &e.ReportID, &e.ActorID, &e.Action, &e.SubjectType, &e.SubjectID,
+			&e.SubjectUserID, &e.GroupID, &e.Note, &e.CreatedAt) == nil {
+			out = append(out, e)
+			ids = append(ids, e.ActorID, e.SubjectUserID)
+		}
+	}
+	rows.Close()
+	users := loadUserSummaries(h.DB, ids, avatarSize(r, avatarThumb))
+	for i := range out {
+		if u, ok := users[out[i].ActorID]; ok {
+			out[i].Actor = &u
+		}
+		if u, ok := users[out[i].SubjectUserID]; ok {
+			out[i].SubjectUser = &u
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
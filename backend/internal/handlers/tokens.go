@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"social-network/backend/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TokensHandler struct{ DB *sql.DB }
+
+type createTokenReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 = never expires
+}
+
+// tokenSession returns the caller's session, refusing personal access tokens:
+// tokens can't be used to mint or revoke other tokens.
+func tokenSession(w http.ResponseWriter, r *http.Request) (*auth.Session, bool) {
+	sess, ok := auth.SessionFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if sess.IsToken() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return sess, true
+}
+
+func (h *TokensHandler) List(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := auth.ListAccessTokens(h.DB, sess.UserID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *TokensHandler) Create(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	var body createTokenReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.ExpiresInDays < 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	ttl := time.Duration(body.ExpiresInDays) * 24 * time.Hour
+	t, plain, err := auth.CreateAccessToken(h.DB, sess.UserID, body.Name, body.Scopes, ttl)
+	if err == auth.ErrInvalidScope {
+		http.Error(w, "invalid scopes", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	// the plaintext token is only ever shown here
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"token": plain, "access_token": t})
+}
+
+func (h *TokensHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	sess, ok := tokenSession(w, r)
+	if !ok {
+		return
+	}
+	found, err := auth.DeleteAccessToken(h.DB, sess.UserID, chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
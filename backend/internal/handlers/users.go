@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+	"social-network/backend/internal/websocket"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Avatar sizes: the 512px avatar and its 96px thumb (imaging.AvatarSpec).
+const (
+	avatarFull  = "full"
+	avatarThumb = "thumb"
+)
+
+// UsersHandler serves avatars by user id, so payloads can link to a user's
+// avatar without knowing where, or whether, it is stored.
+type UsersHandler struct {
+	DB     *sql.DB
+	Stores map[string]services.MediaStore // by Name(), for avatars kept in any backend
+}
+
+// Avatar sends the user's avatar (?size=full|thumb). Local files are served
+// directly, other backends by redirect; users without an avatar get an SVG of
+// their initials. URLs carrying the current ?v= may be cached for good.
+// Blocked viewers get 404, and viewers who may not read a private profile
+// get the initials instead of the uploaded picture.
+func (h *UsersHandler) Avatar(w http.ResponseWriter, r *http.Request) {
+	viewerID := ""
+	if s, ok := auth.SessionFromContext(r); ok {
+		viewerID = s.UserID
+	}
+	id := chi.URLParam(r, "id")
+	if viewerID != "" && viewerID != id && isBlocked(h.DB, viewerID, id) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	size := r.URL.Query().Get("size")
+	var first, last, nickname, key, storage string
+	var visible bool
+	err := h.DB.QueryRow(`SELECT u.first_name, u.last_name, COALESCE(p.nickname, ''),
+		COALESCE(p.avatar_path, ''), COALESCE(p.avatar_storage, ''),
+		u.id = ?1 OR COALESCE(p.public, 0) = 1
+			OR EXISTS(SELECT 1 FROM follows WHERE follower_user_id = ?1 AND followed_user_id = u.id)
+		FROM users u LEFT JOIN profiles p ON p.user_id = u.id WHERE u.id = ?2`, viewerID, id).
+		Scan(&first, &last, &nickname, &key, &storage, &visible)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		key = ""
+	}
+
+	cache := "private, max-age=300"
+	if key != "" && r.URL.Query().Get("v") == avatarVersion(key) {
+		cache = "private, max-age=31536000, immutable"
+	}
+	w.Header().Set("Cache-Control", cache)
+	store := h.Stores[storage]
+	if key == "" || store == nil {
+		writeInitialsAvatar(w, id, initials(first, last, nickname), size)
+		return
+	}
+
+	variant := ""
+	if size == avatarThumb {
+		variant = "thumb"
+	}
+	serveStoredImage(w, r, h.DB, store, storage, key, variant)
+}
+
+// serveStoredImage sends the best format of key's variant: local files
+// directly, other backends by redirect.
+func serveStoredImage(w http.ResponseWriter, r *http.Request, db *sql.DB, store services.MediaStore, storage, key, variant string) {
+	best, err := negotiateMedia(db, storage, key, variant, r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Vary", "Accept")
+	if local, ok := store.(*services.LocalStore); ok {
+		local.ServeKey(w, r, best)
+		return
+	}
+	http.Redirect(w, r, store.URL(best), http.StatusFound)
+}
+
+// avatarSize reads ?avatar_size= (full or thumb), defaulting to def.
+func avatarSize(r *http.Request, def string) string {
+	switch s := r.URL.Query().Get("avatar_size"); s {
+	case avatarFull, avatarThumb:
+		return s
+	}
+	return def
+}
+
+// pageParams reads ?limit= (def when missing, at most max) and ?offset=.
+func pageParams(r *http.Request, def, max int) (limit, offset int) {
+	limit = def
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > max {
+		limit = max
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && n > 0 {
+		offset = n
+	}
+	return limit, offset
+}
+
+// loadUserSummaries projects the given users for display, keyed by id.
+// Ids without a user (deleted accounts) get a placeholder summary.
+func loadUserSummaries(db *sql.DB, ids []string, size string) map[string]websocket.UserSummary {
+	out := map[string]websocket.UserSummary{}
+	var args []any
+	for _, id := range ids {
+		if _, ok := out[id]; ok || id == "" {
+			continue
+		}
+		out[id] = userSummary(id, "", "", "", "", size)
+		args = append(args, id)
+	}
+	if len(args) == 0 {
+		return out
+	}
+	rows, err := db.Query(`SELECT u.id, u.first_name, u.last_name, COALESCE(p.nickname, ''), COALESCE(p.avatar_path, '')
+		FROM users u LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id IN (?`+strings.Repeat(",?", len(args)-1)+`)`, args...)
+	if err != nil {
+		log.Printf("load users: %v", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, first, last, nickname, avatar string
+		if err := rows.Scan(&id, &first, &last, &nickname, &avatar); err == nil {
+			out[id] = userSummary(id, first, last, nickname, avatar, size)
+		}
+	}
+	return out
+}
+
+// loadUserSummary is loadUserSummaries for a single user.
+func loadUserSummary(db *sql.DB, id, size string) *websocket.UserSummary {
+	u := loadUserSummaries(db, []string{id}, size)[id]
+	return &u
+}
+
+func userSummary(id, first, last, nickname, avatarKey, size string) websocket.UserSummary {
+	name := strings.TrimSpace(first + " " + last)
+	if name == "" {
+		name = nickname
+	}
+	if name == "" {
+		name = "Unknown User"
+	}
+	u := "/api/users/" + url.PathEscape(id) + "/avatar?size=" + size
+	if avatarKey != "" {
+		u += "&v=" + avatarVersion(avatarKey)
+	}
+	return websocket.UserSummary{
+		ID:          id,
+		DisplayName: name,
+		Nickname:    nickname,
+		AvatarURL:   u,
+		Initials:    initials(first, last, nickname),
+		HasAvatar:   avatarKey != "",
+	}
+}
+
+// avatarVersion changes whenever the avatar does, so avatar URLs can be
+// cached indefinitely.
+func avatarVersion(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+func initials(first, last, nickname string) string {
+	var out []rune
+	for _, s := range []string{first, last} {
+		if r, _ := utf8.DecodeRuneInString(strings.TrimSpace(s)); r != utf8.RuneError {
+			out = append(out, unicode.ToUpper(r))
+		}
+	}
+	if len(out) == 0 {
+		if r, _ := utf8.DecodeRuneInString(strings.TrimSpace(nickname)); r != utf8.RuneError {
+			out = append(out, unicode.ToUpper(r))
+		}
+	}
+	if len(out) == 0 {
+		return "?"
+	}
+	return string(out)
+}
+
+// writeInitialsAvatar draws the initials on a background colour derived
+// from the user id, so a user keeps the same colour everywhere.
+func writeInitialsAvatar(w http.ResponseWriter, userID, initials, size string) {
+	px := 512
+	if size == avatarThumb {
+		px = 96
+	}
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	hue := h.Sum32() % 360
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`+
+		`<rect width="100" height="100" fill="hsl(%d, 45%%, 45%%)"/>`+
+		`<text x="50" y="50" dy="0.35em" text-anchor="middle" font-family="sans-serif" font-size="40" fill="#fff">%s</text></svg>`,
+		px, px, hue, html.EscapeString(initials))
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/backend/internal/auth"
+	"social-network/backend/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// urlStore is a remote MediaStore whose objects are all at example.com.
+type urlStore struct{ services.MediaStore }
+
+func (urlStore) Name() string          { return "remote" }
+func (urlStore) URL(key string) string { return "https://media.example.com/" + key }
+func (urlStore) Open(context.Context, string) (io.ReadCloser, error) {
+	return nil, services.ErrMediaNotFound
+}
+
+func TestAvatarRespectsPrivacyAndBlocks(t *testing.T) {
+	conn := newTestDB(t)
+	for _, q := range []string{
+		`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES
+			('owner', 'owner@x', 'h', 'Olive', 'Owner', '2000-01-01'),
+			('fan', 'fan@x', 'h', 'Fay', 'Fan', '2000-01-01'),
+			('stranger', 'stranger@x', 'h', 'Sam', 'Stranger', '2000-01-01'),
+			('blocked', 'blocked@x', 'h', 'Bo', 'Blocked', '2000-01-01')`,
+		`INSERT INTO profiles(user_id, public, avatar_path, avatar_storage) VALUES('owner', 0, 'avatars/owner', 'remote')`,
+		`INSERT INTO profiles(user_id, public) VALUES('fan', 1), ('stranger', 1), ('blocked', 1)`,
+		`INSERT INTO follows(follower_user_id, followed_user_id) VALUES('fan', 'owner')`,
+		`INSERT INTO user_blocks(blocker_user_id, blocked_user_id) VALUES('owner', 'blocked')`,
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	h := &UsersHandler{DB: conn, Stores: map[string]services.MediaStore{"remote": urlStore{}}}
+	r := chi.NewRouter()
+	r.Use(auth.LoadSession(conn))
+	r.Get("/api/users/{id}/avatar", h.Avatar)
+
+	tests := []struct {
+		viewer string
+		want   int
+	}{
+		{"owner", http.StatusFound},
+		{"fan", http.StatusFound},
+		{"stranger", http.StatusOK},
+		{"", http.StatusOK},
+		{"blocked", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/owner/avatar", nil)
+		if tt.viewer != "" {
+			sess, err := auth.CreateSession(conn, tt.viewer, time.Hour, "test", "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: sess.ID})
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("viewer %q: status %d, want %d", tt.viewer, rec.Code, tt.want)
+		}
+		// everyone else gets the initials, never the picture
+		if rec.Code == http.StatusOK && !strings.Contains(rec.Body.String(), ">OO<") {
+			t.Errorf("viewer %q: body %q, want the initials", tt.viewer, rec.Body)
+		}
+	}
+}
@@ -20,8 +20,16 @@ func (h *WSHandler) Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get group ID from query parameter if present
+	// Get group ID from query parameter if present; only members may listen
 	groupID := r.URL.Query().Get("group")
+	if groupID != "" {
+		var isMember bool
+		err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)", groupID, sess.UserID).Scan(&isMember)
+		if err != nil || !isMember {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
 
 	// Use the new ServeWS function from the websocket package
 	ws.ServeWS(h.Hub, w, r, sess.UserID, groupID)
@@ -1,13 +1,17 @@
 package http
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
 	"social-network/backend/internal/auth"
 	"social-network/backend/internal/config"
 	"social-network/backend/internal/handlers"
+	"social-network/backend/internal/imaging"
+	"social-network/backend/internal/oidc"
 	"social-network/backend/internal/services"
 	ws "social-network/backend/internal/websocket"
 
@@ -17,16 +21,18 @@ import (
 )
 
 // NewRouter returns the base HTTP handler using chi.
-func NewRouter(db *sql.DB) http.Handler {
+func NewRouter(db *sql.DB, cfg *config.Config) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
+	securityCfg := &cfg.Security
+
 	// CORS middleware
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+		AllowedOrigins:   securityCfg.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
@@ -34,6 +40,9 @@ func NewRouter(db *sql.DB) http.Handler {
 		MaxAge:           300,
 	}))
 
+	// Reject state-changing requests without a matching double-submit token
+	r.Use(auth.CSRFProtect(securityCfg.OriginAllowed))
+
 	// Attach session to context when present (optional): useful for public endpoints
 	r.Use(auth.LoadSession(db))
 
@@ -42,44 +51,108 @@ func NewRouter(db *sql.DB) http.Handler {
 		_, _ = w.Write([]byte("ok"))
 	})
 
-	authHandler := &handlers.AuthHandler{DB: db}
+	authHandler := &handlers.AuthHandler{DB: db, SessionTTL: cfg.Session.TTL}
 	r.Route("/api/auth", func(r chi.Router) {
+		r.Get("/csrf", authHandler.CSRFToken)
 		r.Post("/register", authHandler.Register)
 		r.Post("/login", authHandler.Login)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/me", authHandler.Me)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/logout", authHandler.Logout)
 	})
 
-	// Initialize Cloudinary service
-	cloudinaryCfg := config.LoadCloudinaryConfig()
-	secretPreview := cloudinaryCfg.APISecret
-	if len(secretPreview) > 8 {
-		secretPreview = secretPreview[:8] + "..."
+	// External identity providers (OpenID Connect)
+	oidcCfg := &cfg.OIDC
+	oidcProviders := map[string]*oidc.Provider{}
+	for _, pc := range oidcCfg.Providers {
+		p, err := oidc.NewProvider(context.Background(), oidc.Config{
+			Name:         pc.Name,
+			Issuer:       pc.Issuer,
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			TrustEmail:   pc.TrustEmail,
+		}, nil)
+		if err != nil {
+			log.Printf("Warning: OIDC provider %s disabled: %v", pc.Name, err)
+			continue
+		}
+		oidcProviders[pc.Name] = p
+		log.Printf("OIDC provider %s enabled", pc.Name)
 	}
-	log.Printf("Cloudinary config loaded: CloudName=%s, APIKey=%s, APISecret=%s",
-		cloudinaryCfg.CloudName, cloudinaryCfg.APIKey, secretPreview)
+	oidcHandler := &handlers.OIDCHandler{DB: db, Providers: oidcProviders, PostLoginRedirect: oidcCfg.PostLoginRedirect, SessionTTL: cfg.Session.TTL}
+	r.Get("/api/auth/oidc/{provider}/login", oidcHandler.Login)
+	r.Get("/api/auth/oidc/{provider}/callback", oidcHandler.Callback)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/auth/oidc/{provider}/link", oidcHandler.Link)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/identities", oidcHandler.ListIdentities)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/me/identities/{id}", oidcHandler.Unlink)
 
-	cloudinarySvc, err := services.NewCloudinaryService(cloudinaryCfg)
+	// Initialize Cloudinary service
+	cloudinarySvc, err := services.NewCloudinaryService(&cfg.Cloudinary)
 	if err != nil {
 		log.Printf("Warning: Cloudinary not configured: %v", err)
-		// Continue without Cloudinary - will fall back to local storage
 	} else {
 		log.Printf("Cloudinary service initialized successfully")
 	}
+	localStore, err := services.NewLocalStore(cfg.Uploads.LocalDir, "/images/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	mediaStore, err := services.SelectMediaStore(cfg.Uploads.Backend, cloudinarySvc, localStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Media backend: %s", mediaStore.Name())
+	mediaStores := map[string]services.MediaStore{localStore.Name(): localStore}
+	if cloudinarySvc != nil {
+		mediaStores[cloudinarySvc.Name()] = cloudinarySvc
+	}
+	if cfg.Uploads.GCInterval > 0 {
+		mediaGC := &services.MediaGC{DB: db, Store: mediaStore, GracePeriod: cfg.Uploads.OrphanGracePeriod}
+		// a remote account may be shared with other instances
+		if _, local := mediaStore.(*services.LocalStore); !local && !cfg.Uploads.GCRemote {
+			mediaGC.DryRun = true
+			log.Printf("Media GC on %s is a dry run; set MEDIA_GC_REMOTE=true to delete orphans", mediaStore.Name())
+		}
+		go mediaGC.Run(context.Background(), cfg.Uploads.GCInterval)
+	}
+
+	// Account deletion (with grace period) and data export
+	accountSvc := &services.AccountService{DB: db, Stores: mediaStores, GracePeriod: cfg.Accounts.DeletionGracePeriod}
+	go accountSvc.RunPurger(context.Background(), time.Hour)
+	accountHandler := &handlers.AccountHandler{DB: db, Accounts: accountSvc, Media: mediaStore}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/me", accountHandler.RequestDeletion)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/deletion", accountHandler.DeletionStatus)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/me/deletion/cancel", accountHandler.CancelDeletion)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/export", accountHandler.Export)
 
-	imagesHandler := &handlers.ImagesHandler{DB: db, CloudinarySvc: cloudinarySvc}
+	imagesHandler := &handlers.ImagesHandler{
+		DB:             db,
+		Media:          mediaStore,
+		MaxUploadBytes: cfg.Uploads.MaxBytes,
+		Limits:         imaging.Limits{MaxDimension: imaging.DefaultLimits.MaxDimension, MaxPixels: cfg.Uploads.MaxPixels},
+	}
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/images/avatar", imagesHandler.UploadAvatar)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/images/post", imagesHandler.UploadPostImage)
-	postsHandler := &handlers.PostsHandler{DB: db}
-	// Static file serving for images
-	r.Get("/images/{filename}", func(w http.ResponseWriter, r *http.Request) {
-		filename := chi.URLParam(r, "filename")
-		// Set CORS headers for static files
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Expose-Headers", "Link")
-		http.ServeFile(w, r, "internal/images/"+filename)
-	})
+	attachmentsHandler := &handlers.AttachmentsHandler{
+		DB:             db,
+		Media:          mediaStore,
+		MaxUploadBytes: cfg.Uploads.MaxBytes,
+		Limits:         imagesHandler.Limits,
+	}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/attachments", attachmentsHandler.Upload)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/attachments/{id}", attachmentsHandler.Get)
+	postsHandler := &handlers.PostsHandler{
+		DB:             db,
+		Media:          mediaStore,
+		MaxUploadBytes: cfg.Uploads.MaxBytes,
+		MaxImages:      cfg.Uploads.MaxPostImages,
+		Limits:         imagesHandler.Limits,
+	}
+	// Locally stored images, negotiated by ?size= and Accept
+	// (CORS headers come from the global middleware)
+	mediaHandler := &handlers.MediaHandler{DB: db, Store: localStore}
+	r.Get("/images/*", mediaHandler.Serve)
+	r.Head("/images/*", mediaHandler.Serve)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/posts", postsHandler.CreatePost)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/feed", postsHandler.Feed)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/posts/user", postsHandler.GetUserPosts)
@@ -89,21 +162,52 @@ func NewRouter(db *sql.DB) http.Handler {
 
 	followHandler := &handlers.FollowHandler{DB: db}
 	r.Route("/api/follow", func(r chi.Router) {
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/requests/incoming", followHandler.IncomingRequests)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/requests/outgoing", followHandler.OutgoingRequests)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/requests/{toUserID}", followHandler.SendRequest)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/requests/{id}", followHandler.CancelRequest)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/requests/{id}/accept", followHandler.AcceptRequest)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/requests/{id}/decline", followHandler.DeclineRequest)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{userID}", followHandler.Unfollow)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/followers", followHandler.ListFollowers)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/followers/{userID}", followHandler.RemoveFollower)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/following", followHandler.ListFollowing)
 	})
 
 	profileHandler := &handlers.ProfileHandler{DB: db}
 	r.Get("/api/users/{id}/profile", profileHandler.GetProfile)
+	r.Get("/api/users/{id}/followers", followHandler.UserFollowers)
+	r.Get("/api/users/{id}/following", followHandler.UserFollowing)
+	usersHandler := &handlers.UsersHandler{DB: db, Stores: mediaStores}
+	r.Get("/api/users/{id}/avatar", usersHandler.Avatar)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Patch("/api/me/profile/privacy", profileHandler.TogglePrivacy)
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Patch("/api/me/profile", profileHandler.UpdateProfile)
 
+	// Blocks and mutes
+	blocksHandler := &handlers.BlocksHandler{DB: db}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/users/{id}/block", blocksHandler.Block)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/users/{id}/block", blocksHandler.Unblock)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/users/{id}/mute", blocksHandler.Mute)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/users/{id}/mute", blocksHandler.Unmute)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/blocks", blocksHandler.ListBlocks)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/mutes", blocksHandler.ListMutes)
+
+	// Personal access tokens
+	tokensHandler := &handlers.TokensHandler{DB: db}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/tokens", tokensHandler.List)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/me/tokens", tokensHandler.Create)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/me/tokens/{id}", tokensHandler.Revoke)
+
+	// Personal calendar feed; the feed itself is authenticated by its URL
+	calendarHandler := &handlers.CalendarHandler{DB: db}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/me/calendar", calendarHandler.FeedStatus)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/me/calendar", calendarHandler.CreateFeed)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/api/me/calendar", calendarHandler.DeleteFeed)
+	r.Get("/api/calendar/{token}.ics", calendarHandler.Feed)
+
 	// WebSocket
-	wsHub := ws.NewHub()
+	wsHub := ws.NewHub(securityCfg.OriginAllowed)
+	go wsHub.Run()
 	wsHandler := &handlers.WSHandler{DB: db, Hub: wsHub}
 	chatHandler := &handlers.ChatHandler{DB: db, Hub: wsHub}
 	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/ws", wsHandler.Serve)
@@ -118,12 +222,54 @@ func NewRouter(db *sql.DB) http.Handler {
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/conversations", chatHandler.GetConversations)
 	})
 
-	groupsHandler := &handlers.GroupsHandler{DB: db}
+	// Reports and the site moderation queue; group queues are under /api/groups
+	reportsHandler := &handlers.ReportsHandler{DB: db, Hub: wsHub}
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/reports", reportsHandler.Create)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/reports", reportsHandler.List)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/api/reports/actions", reportsHandler.Actions)
+	r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/api/reports/{id}/resolve", reportsHandler.Resolve)
+
+	// Site staff; moderators and up, with role changes and statistics for admins.
+	// Sessions only: a leaked token must not carry staff powers
+	adminHandler := &handlers.AdminHandler{DB: db, Hub: wsHub}
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) })
+		r.Use(auth.RejectTokens)
+		r.Use(auth.RequireRole(auth.RoleModerator))
+		r.Get("/users", adminHandler.ListUsers)
+		r.Post("/users/{id}/suspend", adminHandler.Suspend)
+		r.Delete("/users/{id}/suspend", adminHandler.Unsuspend)
+		r.Post("/users/{id}/logout", adminHandler.Logout)
+		r.With(auth.RequireRole(auth.RoleAdmin)).Put("/users/{id}/role", adminHandler.SetRole)
+		r.Delete("/content/{type}/{contentID}", adminHandler.DeleteContent)
+		r.With(auth.RequireRole(auth.RoleAdmin)).Get("/stats", adminHandler.Stats)
+	})
+
+	groupsHandler := &handlers.GroupsHandler{
+		DB:             db,
+		Media:          mediaStore,
+		Stores:         mediaStores,
+		MaxUploadBytes: cfg.Uploads.MaxBytes,
+		Limits:         imagesHandler.Limits,
+		Hub:            wsHub,
+	}
 	groupEventsHandler := &handlers.GroupEventsHandler{DB: db}
+	if cfg.Events.ReminderInterval > 0 && len(cfg.Events.ReminderOffsets) > 0 {
+		reminders := &services.EventReminders{DB: db, Offsets: cfg.Events.ReminderOffsets}
+		go reminders.Run(context.Background(), cfg.Events.ReminderInterval)
+	}
 	r.Route("/api/groups", func(r chi.Router) {
 		r.Get("/", groupsHandler.ListGroups)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/", groupsHandler.CreateGroup)
 		r.Get("/{id}", groupsHandler.GetGroup)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Patch("/{id}", groupsHandler.UpdateGroup)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{id}", groupsHandler.DeleteGroup)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/archive", groupsHandler.Archive)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{id}/archive", groupsHandler.Unarchive)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/avatar", groupsHandler.UploadAvatar)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/cover", groupsHandler.UploadCover)
+		r.Get("/{id}/avatar", groupsHandler.Avatar)
+		r.Get("/{id}/cover", groupsHandler.Cover)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/invite", groupsHandler.Invite)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/invitations/{invID}/accept", groupsHandler.AcceptInvitation)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/invitations/{invID}/decline", groupsHandler.DeclineInvitation)
@@ -132,9 +278,28 @@ func NewRouter(db *sql.DB) http.Handler {
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/requests/{reqID}/decline", groupsHandler.DeclineRequest)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/events", groupEventsHandler.CreateEvent)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/events", groupEventsHandler.ListEvents)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/events.ics", groupEventsHandler.ExportICS)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/events/{eventId}", groupEventsHandler.GetEvent)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Patch("/{id}/events/{eventId}", groupEventsHandler.UpdateEvent)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/events/{eventId}/cancel", groupEventsHandler.CancelEvent)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/events/{eventId}/respond", groupEventsHandler.RespondToEvent)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/events/{eventId}/responses", groupEventsHandler.GetEventResponses)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/members", groupsHandler.ListMembers)
+		// Membership and moderation
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/leave", groupsHandler.Leave)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{id}/members/{userID}", groupsHandler.Kick)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Put("/{id}/members/{userID}/role", groupsHandler.SetRole)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/transfer", groupsHandler.TransferOwnership)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/bans", groupsHandler.ListBans)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/bans", groupsHandler.Ban)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{id}/bans/{userID}", groupsHandler.Unban)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/audit", groupsHandler.AuditLog)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/reports", reportsHandler.GroupQueue)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/{id}/invite-links", groupsHandler.ListInviteLinks)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/{id}/invite-links", groupsHandler.CreateInviteLink)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Delete("/{id}/invite-links/{linkID}", groupsHandler.RevokeInviteLink)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/invite-links/{token}", groupsHandler.PreviewInviteLink)
+		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Post("/invite-links/{token}/redeem", groupsHandler.RedeemInviteLink)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/invitations/sent", groupsHandler.ListSentInvitations)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/invitations/received", groupsHandler.ListReceivedInvitations)
 		r.With(func(next http.Handler) http.Handler { return auth.RequireAuth(next, db) }).Get("/search/users", groupsHandler.SearchUsers)
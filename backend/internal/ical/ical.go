@@ -0,0 +1,266 @@
+// Package ical writes iCalendar (RFC 5545) feeds of events, with the
+// VTIMEZONE definitions their zoned times refer to.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is one VEVENT: a single event, a repeating series, or an edit to
+// one occurrence of a series (RecurrenceID set, same UID as the series).
+type Event struct {
+	UID          string
+	Sequence     int
+	Stamp        time.Time // when the event last changed
+	Created      time.Time
+	Start        time.Time
+	End          time.Time
+	Zone         *time.Location // zone of the times; nil or UTC writes UTC times
+	Summary      string
+	Description  string
+	Location     string
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID time.Time // original start of the occurrence this edits
+	Cancelled    bool
+}
+
+// Calendar is a published VCALENDAR.
+type Calendar struct {
+	Name   string // X-WR-CALNAME, shown by most clients
+	Events []Event
+}
+
+// zoneYearsAhead is how far past the last event VTIMEZONE transitions are
+// written, for series without an end.
+const zoneYearsAhead = 5
+
+// Write renders the calendar with CRLF line endings and lines folded at 75
+// octets.
+func (c *Calendar) Write(w io.Writer) error {
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:-//social-network//group events//EN")
+	lw.line("CALSCALE:GREGORIAN")
+	lw.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME:" + Escape(c.Name))
+	}
+	for _, z := range c.zones() {
+		writeZone(lw, z.loc, z.from, z.to)
+	}
+	for _, e := range c.Events {
+		writeEvent(lw, &e)
+	}
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return lw.w.Flush()
+}
+
+type zoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// zones returns the zones the events use, each with the span of time its
+// transitions must cover.
+func (c *Calendar) zones() []zoneRange {
+	byName := map[string]*zoneRange{}
+	for _, e := range c.Events {
+		if isUTC(e.Zone) {
+			continue
+		}
+		end := e.End
+		if e.RRule != "" {
+			if now := time.Now(); end.Before(now) {
+				end = now
+			}
+			end = end.AddDate(zoneYearsAhead, 0, 0)
+		}
+		z, ok := byName[e.Zone.String()]
+		if !ok {
+			byName[e.Zone.String()] = &zoneRange{loc: e.Zone, from: e.Start, to: end}
+			continue
+		}
+		if e.Start.Before(z.from) {
+			z.from = e.Start
+		}
+		if end.After(z.to) {
+			z.to = end
+		}
+	}
+	out := make([]zoneRange, 0, len(byName))
+	for _, z := range byName {
+		out = append(out, *z)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].loc.String() < out[j].loc.String() })
+	return out
+}
+
+func isUTC(loc *time.Location) bool {
+	return loc == nil || loc == time.UTC || loc.String() == "UTC"
+}
+
+// writeZone writes loc's offset at from and every transition up to to.
+func writeZone(lw *lineWriter, loc *time.Location, from, to time.Time) {
+	from = from.AddDate(0, 0, -1)
+	lw.line("BEGIN:VTIMEZONE")
+	lw.line("TZID:" + loc.String())
+	name, offset := from.In(loc).Zone()
+	writeTransition(lw, from.In(loc).IsDST(), from.Add(time.Duration(offset)*time.Second), offset, offset, name)
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, o := next.In(loc).Zone(); o != offset {
+			// narrow the change down to the second
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.In(loc).Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			newName, newOffset := hi.In(loc).Zone()
+			writeTransition(lw, hi.In(loc).IsDST(), hi.Add(time.Duration(offset)*time.Second), offset, newOffset, newName)
+			offset = newOffset
+			t = hi
+			continue
+		}
+		t = next
+	}
+	lw.line("END:VTIMEZONE")
+}
+
+// writeTransition writes a STANDARD or DAYLIGHT component; local is the
+// wall time the change happens at, in the old offset.
+func writeTransition(lw *lineWriter, dst bool, local time.Time, from, to int, name string) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	lw.line("BEGIN:" + kind)
+	lw.line("DTSTART:" + local.UTC().Format("20060102T150405"))
+	lw.line("TZOFFSETFROM:" + formatOffset(from))
+	lw.line("TZOFFSETTO:" + formatOffset(to))
+	if name != "" && !strings.ContainsAny(name, "+-") {
+		lw.line("TZNAME:" + Escape(name))
+	}
+	lw.line("END:" + kind)
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+func writeEvent(lw *lineWriter, e *Event) {
+	lw.line("BEGIN:VEVENT")
+	lw.line("UID:" + e.UID)
+	lw.line("DTSTAMP:" + utc(e.Stamp))
+	if !e.Created.IsZero() {
+		lw.line("CREATED:" + utc(e.Created))
+		lw.line("LAST-MODIFIED:" + utc(e.Stamp))
+	}
+	lw.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+	if !e.RecurrenceID.IsZero() {
+		lw.line("RECURRENCE-ID" + zoned(e.Zone, e.RecurrenceID))
+	}
+	lw.line("DTSTART" + zoned(e.Zone, e.Start))
+	lw.line("DTEND" + zoned(e.Zone, e.End))
+	if e.RRule != "" {
+		lw.line("RRULE:" + e.RRule)
+	}
+	if len(e.ExDates) > 0 {
+		s := make([]string, len(e.ExDates))
+		for i, t := range e.ExDates {
+			s[i] = value(e.Zone, t)
+		}
+		prefix := "EXDATE"
+		if !isUTC(e.Zone) {
+			prefix += ";TZID=" + e.Zone.String()
+		}
+		lw.line(prefix + ":" + strings.Join(s, ","))
+	}
+	lw.line("SUMMARY:" + Escape(e.Summary))
+	if e.Description != "" {
+		lw.line("DESCRIPTION:" + Escape(e.Description))
+	}
+	if e.Location != "" {
+		lw.line("LOCATION:" + Escape(e.Location))
+	}
+	if e.Cancelled {
+		lw.line("STATUS:CANCELLED")
+	} else {
+		lw.line("STATUS:CONFIRMED")
+	}
+	lw.line("END:VEVENT")
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// zoned renders the parameters and value of a date-time property.
+func zoned(loc *time.Location, t time.Time) string {
+	if isUTC(loc) {
+		return ":" + value(loc, t)
+	}
+	return ";TZID=" + loc.String() + ":" + value(loc, t)
+}
+
+// value is t as UTC, or as wall time in loc.
+func value(loc *time.Location, t time.Time) string {
+	if isUTC(loc) {
+		return utc(t)
+	}
+	return t.In(loc).Format("20060102T150405")
+}
+
+// Escape escapes a TEXT value.
+func Escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// lineWriter writes content lines, folding them at 75 octets without
+// splitting UTF-8 sequences.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, lw.err = lw.w.WriteString(s[:cut] + "\r\n "); lw.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = 74 // the leading space counts
+	}
+	_, lw.err = lw.w.WriteString(s + "\r\n")
+}
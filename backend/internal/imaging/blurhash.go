@@ -0,0 +1,87 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes img as a BlurHash (https://blurha.sh) with cx by cy
+// components. Pass a small image; the cost is proportional to its pixels.
+func Blurhash(img *image.RGBA, cx, cy int) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := norm * math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					p := img.Pix[y*img.Stride+x*4:]
+					f[0] += basis * srgbToLinear(p[0])
+					f[1] += basis * srgbToLinear(p[1])
+					f[2] += basis * srgbToLinear(p[2])
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encode83(&sb, (cx-1)+(cy-1)*9, 1)
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		var actual float64
+		for _, f := range ac {
+			actual = math.Max(actual, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		q := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maxValue = float64(q+1) / 166
+		encode83(&sb, q, 1)
+	} else {
+		encode83(&sb, 0, 1)
+	}
+	encode83(&sb, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		encode83(&sb, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+	return sb.String()
+}
+
+func encode83(sb *strings.Builder, v, length int) {
+	for i := 1; i <= length; i++ {
+		digit := v / int(math.Pow(83, float64(length-i))) % 83
+		sb.WriteByte(base83[digit])
+	}
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	c := math.Max(0, math.Min(1, v))
+	if c <= 0.0031308 {
+		return int(c*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
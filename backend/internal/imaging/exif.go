@@ -0,0 +1,98 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, returning 1
+// when there is none. Cameras store portrait shots rotated and rely on this
+// tag, so it has to be applied before the metadata is dropped.
+func jpegOrientation(data []byte) int {
+	p := data[2:] // past SOI
+	for len(p) >= 4 && p[0] == 0xFF {
+		marker := p[1]
+		size := int(binary.BigEndian.Uint16(p[2:4]))
+		if marker == 0xDA || size < 2 || len(p) < 2+size {
+			break // start of scan: no more metadata
+		}
+		seg := p[4 : 2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		p = p[2+size:]
+	}
+	return 1
+}
+
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(bo.Uint32(t[4:8]))
+	if ifd+2 > len(t) {
+		return 1
+	}
+	n := int(bo.Uint16(t[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(t) {
+			break
+		}
+		if bo.Uint16(t[e:]) == 0x0112 {
+			if o := int(bo.Uint16(t[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient returns src transformed so it displays upright for the given EXIF
+// orientation.
+func orient(src image.Image, o int) image.Image {
+	if o <= 1 {
+		return src
+	}
+	img := toRGBA(src)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	ow, oh := w, h
+	if o >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(out.Pix[dy*out.Stride+dx*4:dy*out.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:])
+		}
+	}
+	return out
+}
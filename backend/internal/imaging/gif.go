@@ -0,0 +1,139 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+)
+
+// checkGIF walks the GIF block structure without decoding any pixels and
+// applies the limits to the whole animation: every frame is composited at
+// the logical screen size, so width*height*frames must stay under
+// MaxPixels, and no frame may be larger than MaxDimension. It stops at the
+// first frame over the limit, so a file with countless frames costs no more
+// than reading it.
+func (l Limits) checkGIF(data []byte) error {
+	if len(data) < 13 {
+		return fmt.Errorf("%w: truncated gif", ErrUnsupportedFormat)
+	}
+	w := int(binary.LittleEndian.Uint16(data[6:8]))
+	h := int(binary.LittleEndian.Uint16(data[8:10]))
+	p := 13
+	if data[10]&0x80 != 0 {
+		p += 3 << (data[10]&0x07 + 1) // global colour table
+	}
+	frames := 0
+	for p < len(data) {
+		switch data[p] {
+		case 0x21: // extension: label, then data sub-blocks
+			p += 2
+		case 0x2C: // image descriptor
+			if p+10 > len(data) {
+				return fmt.Errorf("%w: truncated gif", ErrUnsupportedFormat)
+			}
+			fw := int(binary.LittleEndian.Uint16(data[p+5 : p+7]))
+			fh := int(binary.LittleEndian.Uint16(data[p+7 : p+9]))
+			frames++
+			// a 0x0 screen takes its size from the frames
+			if err := l.check(max(w, fw), max(h, fh), frames); err != nil {
+				return err
+			}
+			if data[p+9]&0x80 != 0 {
+				p += 3 << (data[p+9]&0x07 + 1) // local colour table
+			}
+			p += 11 // descriptor and LZW minimum code size
+		case 0x3B: // trailer
+			return nil
+		default:
+			return fmt.Errorf("%w: bad gif block 0x%02x", ErrUnsupportedFormat, data[p])
+		}
+		// skip data sub-blocks up to the zero-length terminator
+		for p < len(data) && data[p] != 0 {
+			p += int(data[p]) + 1
+		}
+		p++
+	}
+	// a missing trailer is for the decoder to judge; everything read so far
+	// is within the limits
+	return nil
+}
+
+// gifFrame renders the first frame of an animation onto its logical screen.
+func gifFrame(g *gif.GIF) image.Image {
+	canvas := image.NewRGBA(gifScreen(g))
+	draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	return canvas
+}
+
+func gifScreen(g *gif.GIF) image.Rectangle {
+	w, h := g.Config.Width, g.Config.Height
+	if w == 0 || h == 0 {
+		b := g.Image[0].Bounds()
+		w, h = b.Max.X, b.Max.Y
+	}
+	return image.Rect(0, 0, w, h)
+}
+
+// resizeGIF scales every frame of an animation for v. Frames are composited
+// onto the logical screen first (honouring each frame's disposal), so the
+// output frames are full size and can simply replace one another.
+func resizeGIF(g *gif.GIF, v Variant) (Encoded, error) {
+	canvas := image.NewRGBA(gifScreen(g))
+	out := &gif.GIF{LoopCount: g.LoopCount}
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var saved *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			saved = image.NewRGBA(canvas.Bounds())
+			copy(saved.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		scaled := derive(canvas, v)
+		out.Image = append(out.Image, quantize(scaled, frame.Palette))
+		out.Delay = append(out.Delay, g.Delay[i])
+		out.Disposal = append(out.Disposal, gif.DisposalNone)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	b := out.Image[0].Bounds()
+	out.Config = image.Config{Width: b.Dx(), Height: b.Dy()}
+	return encodeGIF(v.Name, out)
+}
+
+// quantize maps img onto p, memoising the nearest colour lookups since
+// frames repeat the same few colours.
+func quantize(img *image.RGBA, p color.Palette) *image.Paletted {
+	out := image.NewPaletted(img.Bounds(), p)
+	seen := map[color.RGBA]uint8{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		idx, ok := seen[c]
+		if !ok {
+			idx = uint8(p.Index(c))
+			seen[c] = idx
+		}
+		out.Pix[i/4] = idx
+	}
+	return out
+}
+
+func encodeGIF(name string, g *gif.GIF) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return Encoded{}, fmt.Errorf("encode %s: %w", name, err)
+	}
+	return Encoded{Name: name, Data: buf.Bytes(), ContentType: "image/gif", Format: "gif", Width: g.Config.Width, Height: g.Config.Height}, nil
+}
@@ -0,0 +1,91 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"runtime"
+	"testing"
+)
+
+// repeatFrames builds a GIF whose single, uniformly coloured frame covers a
+// w×h screen and is repeated n times. Uniform pixels compress so well that
+// the file stays tiny however large the decoded animation is.
+func repeatFrames(t *testing.T, w, h, n int) []byte {
+	t.Helper()
+	frame := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if data[len(data)-1] != 0x3B {
+		t.Fatal("encoded gif has no trailer")
+	}
+	start := bytes.IndexByte(data[13+3*2:], 0x2C) + 13 + 3*2 // after the 2-colour global table
+	block := data[start : len(data)-1]
+	out := append([]byte{}, data[:start]...)
+	for i := 0; i < n; i++ {
+		out = append(out, block...)
+	}
+	return append(out, 0x3B)
+}
+
+func TestProcessRejectsManyFrameGIFBeforeDecoding(t *testing.T) {
+	limits := Limits{MaxDimension: 2000, MaxPixels: 4_000_000}
+	// each frame alone is within the limits; forty of them are not
+	data := repeatFrames(t, 1000, 1000, 40)
+	if len(data) > 200_000 {
+		t.Fatalf("crafted gif is %d bytes", len(data))
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	_, err := Process(bytes.NewReader(data), PostImageSpec, limits)
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+	// decoding all frames would allocate at least 40 MB of pixels
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8<<20 {
+		t.Errorf("allocated %d bytes before rejecting", alloc)
+	}
+}
+
+func TestProcessRejectsOversizedGIFFrame(t *testing.T) {
+	limits := Limits{MaxDimension: 2000, MaxPixels: 4_000_000}
+	data := repeatFrames(t, 10, 10, 1)
+	// grow the frame descriptor past MaxDimension while the screen stays small
+	i := bytes.IndexByte(data[13+3*2:], 0x2C) + 13 + 3*2
+	data[i+5], data[i+6] = 0xFF, 0xFF
+	if _, err := Process(bytes.NewReader(data), PostImageSpec, limits); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestProcessKeepsAnimation(t *testing.T) {
+	data := repeatFrames(t, 64, 48, 3)
+	res, err := Process(bytes.NewReader(data), PostImageSpec, DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(res.Main.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 || res.Main.Width != 64 || res.Main.Height != 48 {
+		t.Errorf("main = %d frames at %dx%d", len(g.Image), res.Main.Width, res.Main.Height)
+	}
+}
+
+func TestCheckGIFRejectsGarbage(t *testing.T) {
+	data := repeatFrames(t, 10, 10, 1)
+	data = append(data[:len(data)-1], 0x99, 0x3B)
+	if err := DefaultLimits.checkGIF(data); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Package imaging validates uploaded images and derives the sizes the app
+// serves. Uploads are decoded and re-encoded, which drops EXIF (including
+// GPS) and any other metadata the client sent along; WebP originals, which
+// can't be re-encoded, have their metadata chunks removed instead.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions exceed the allowed limits")
+)
+
+// Limits guard against decompression bombs: they are checked against the
+// header before any pixel data is decoded.
+type Limits struct {
+	MaxDimension int // per side
+	MaxPixels    int // width*height, summed over frames for animations
+}
+
+var DefaultLimits = Limits{MaxDimension: 10000, MaxPixels: 40_000_000}
+
+// Variant describes one derived size. Images are only ever scaled down; with
+// Crop the image is first cut to the target aspect ratio around its centre.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+// Spec says how the stored image (Main) and its extra sizes are produced.
+type Spec struct {
+	Main     Variant
+	Variants []Variant
+}
+
+var (
+	AvatarSpec = Spec{
+		Main:     Variant{Name: "avatar", Width: 512, Height: 512, Crop: true},
+		Variants: []Variant{{Name: "thumb", Width: 96, Height: 96, Crop: true}},
+	}
+	// CoverSpec is the banner across the top of a group page.
+	CoverSpec = Spec{
+		Main:     Variant{Name: "cover", Width: 1500, Height: 500, Crop: true},
+		Variants: []Variant{{Name: "thumb", Width: 600, Height: 200, Crop: true}},
+	}
+	PostImageSpec = Spec{
+		Main: Variant{Name: "full", Width: 2048, Height: 2048},
+		Variants: []Variant{
+			{Name: "medium", Width: 1024, Height: 1024},
+			{Name: "thumb", Width: 320, Height: 320},
+		},
+	}
+)
+
+// Encoded is one re-encoded image ready to be stored.
+type Encoded struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Format      string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	Format string // detected source format
+	Main   Encoded
+	// Alternates hold the main image in other formats, for clients that
+	// can't display Main (a JPEG or PNG next to a WebP original).
+	Alternates []Encoded
+	Variants   []Encoded
+	// Blurhash is a compact placeholder clients can paint while the image loads.
+	Blurhash string
+}
+
+// Sniff identifies the image format from its leading bytes. The client's
+// Content-Type is never trusted.
+func Sniff(head []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg", nil
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "png", nil
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "gif", nil
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "webp", nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Process validates r and produces the images described by spec.
+func Process(r io.Reader, spec Spec, limits Limits) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if err := limits.check(cfg.Width, cfg.Height, 1); err != nil {
+		return nil, err
+	}
+
+	var src image.Image
+	var anim *gif.GIF
+	switch format {
+	case "gif":
+		// frames are counted and measured before DecodeAll allocates them
+		err = limits.checkGIF(data)
+		if err == nil {
+			anim, err = gif.DecodeAll(bytes.NewReader(data))
+		}
+		if err == nil {
+			src = gifFrame(anim)
+		}
+	default:
+		src, _, err = image.Decode(bytes.NewReader(data))
+		if err == nil && format == "jpeg" {
+			src = orient(src, jpegOrientation(data))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Format: format}
+	animated := anim != nil && len(anim.Image) > 1
+	keepMain := !spec.Main.Crop && fits(cfg.Width, cfg.Height, spec.Main)
+	switch {
+	case animated && keepMain:
+		// re-encoding drops comments and application extensions
+		res.Main, err = encodeGIF(spec.Main.Name, anim)
+	case animated:
+		res.Main, err = resizeGIF(anim, spec.Main)
+	case format == "webp" && keepMain:
+		// there is no WebP encoder to re-encode with, so the original is kept
+		// minus its metadata chunks, alongside a universally supported copy
+		var clean []byte
+		clean, err = stripWebPMetadata(data)
+		res.Main = Encoded{Name: spec.Main.Name, Data: clean, ContentType: "image/webp", Format: "webp", Width: cfg.Width, Height: cfg.Height}
+		if err == nil {
+			var alt Encoded
+			alt, err = encode(spec.Main.Name, toRGBA(src), format)
+			res.Alternates = append(res.Alternates, alt)
+		}
+	default:
+		res.Main, err = encode(spec.Main.Name, derive(src, spec.Main), format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range spec.Variants {
+		if !v.Crop && fits(src.Bounds().Dx(), src.Bounds().Dy(), v) {
+			continue // the main image already serves this size
+		}
+		var enc Encoded
+		if animated {
+			enc, err = resizeGIF(anim, v)
+		} else {
+			enc, err = encode(v.Name, derive(src, v), format)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Variants = append(res.Variants, enc)
+	}
+	res.Blurhash = Blurhash(resize(toRGBA(src), 32, 32), 4, 3)
+	return res, nil
+}
+
+func (l Limits) check(w, h, frames int) error {
+	if w <= 0 || h <= 0 || w > l.MaxDimension || h > l.MaxDimension || w*h > l.MaxPixels/max(frames, 1) {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+func fits(w, h int, v Variant) bool {
+	return w <= v.Width && h <= v.Height
+}
+
+// derive crops and scales src for v.
+func derive(src image.Image, v Variant) *image.RGBA {
+	img := toRGBA(src)
+	if v.Crop {
+		img = cropToAspect(img, v.Width, v.Height)
+	}
+	return resize(img, v.Width, v.Height)
+}
+
+func encode(name string, img *image.RGBA, format string) (Encoded, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "webp" {
+		// derived sizes of a WebP fall back to formats we can encode
+		format = "png"
+		if img.Opaque() {
+			format = "jpeg"
+		}
+	}
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "gif":
+		// a single frame from a GIF keeps the format so transparency survives
+		p := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(p, img.Bounds(), img, image.Point{})
+		err = gif.Encode(&buf, p, nil)
+	default:
+		format = "png"
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return Encoded{}, fmt.Errorf("encode %s: %w", name, err)
+	}
+	b := img.Bounds()
+	return Encoded{Name: name, Data: buf.Bytes(), ContentType: "image/" + format, Format: format, Width: b.Dx(), Height: b.Dy()}, nil
+}
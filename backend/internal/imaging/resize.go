@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+func toRGBA(src image.Image) *image.RGBA {
+	if img, ok := src.(*image.RGBA); ok && img.Bounds().Min == (image.Point{}) {
+		return img
+	}
+	b := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	return img
+}
+
+// cropToAspect cuts the largest centred rectangle with the w:h aspect ratio.
+func cropToAspect(img *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	cw, ch := sw, sw*h/w
+	if ch > sh {
+		cw, ch = sh*w/h, sh
+	}
+	if cw == sw && ch == sh {
+		return img
+	}
+	x, y := (sw-cw)/2, (sh-ch)/2
+	return toRGBA(img.SubImage(image.Rect(x, y, x+cw, y+ch)))
+}
+
+// resize scales img down to fit within maxW x maxH, keeping the aspect ratio.
+// Each output pixel is the area-weighted average of the source pixels it
+// covers, which avoids the aliasing of nearest-neighbour sampling.
+func resize(img *image.RGBA, maxW, maxH int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	if sw <= maxW && sh <= maxH {
+		return img
+	}
+	dw, dh := maxW, sh*maxW/sw
+	if dh > maxH {
+		dw, dh = sw*maxH/sh, maxH
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	// horizontal pass into a float buffer, then vertical pass into the result
+	tmp := make([]float64, dw*sh*4)
+	xw := weights(sw, dw)
+	for y := 0; y < sh; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x, ws := range xw {
+			var acc [4]float64
+			for _, c := range ws {
+				p := row[c.i*4:]
+				acc[0] += float64(p[0]) * c.w
+				acc[1] += float64(p[1]) * c.w
+				acc[2] += float64(p[2]) * c.w
+				acc[3] += float64(p[3]) * c.w
+			}
+			copy(tmp[(y*dw+x)*4:], acc[:])
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	yw := weights(sh, dh)
+	for y, ws := range yw {
+		for x := 0; x < dw; x++ {
+			var acc [4]float64
+			for _, c := range ws {
+				p := tmp[(c.i*dw+x)*4:]
+				acc[0] += p[0] * c.w
+				acc[1] += p[1] * c.w
+				acc[2] += p[2] * c.w
+				acc[3] += p[3] * c.w
+			}
+			o := out.Pix[y*out.Stride+x*4:]
+			for i := range acc {
+				o[i] = uint8(min(acc[i]+0.5, 255))
+			}
+		}
+	}
+	return out
+}
+
+type contrib struct {
+	i int
+	w float64
+}
+
+// weights returns, for every destination index, the source indexes it
+// covers and how much of each.
+func weights(src, dst int) [][]contrib {
+	scale := float64(src) / float64(dst)
+	out := make([][]contrib, dst)
+	for d := range out {
+		lo, hi := float64(d)*scale, float64(d+1)*scale
+		for s := int(lo); s < src && float64(s) < hi; s++ {
+			w := min(hi, float64(s+1)) - max(lo, float64(s))
+			if w > 0 {
+				out[d] = append(out[d], contrib{s, w / scale})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VP8X feature flags (first byte of the chunk payload).
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebPMetadata rewrites a WebP container without its EXIF and XMP
+// chunks. Image data and the colour profile are copied unchanged.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("%w: truncated webp", ErrUnsupportedFormat)
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for p := data[12:]; len(p) > 0; {
+		if len(p) < 8 {
+			return nil, fmt.Errorf("%w: truncated webp chunk", ErrUnsupportedFormat)
+		}
+		size := int(binary.LittleEndian.Uint32(p[4:8]))
+		end := 8 + size + size&1 // chunks are padded to even sizes
+		if size < 0 || end > len(p) {
+			return nil, fmt.Errorf("%w: truncated webp chunk", ErrUnsupportedFormat)
+		}
+		switch string(p[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, p[:end]...)
+			if size > 0 {
+				out[start+8] &^= webpFlagEXIF | webpFlagXMP
+			}
+		default:
+			out = append(out, p[:end]...)
+		}
+		p = p[end:]
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
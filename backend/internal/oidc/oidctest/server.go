@@ -0,0 +1,233 @@
+// Package oidctest runs an in-process OpenID Connect provider for tests:
+// discovery, JWKS, an authorization endpoint that signs the configured user
+// straight in, and a token endpoint that enforces PKCE.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// User is who the provider signs in at its authorization endpoint.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type authRequest struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        User
+}
+
+// Server is a mock identity provider. Its issuer is its URL.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	user        User
+	key         *rsa.PrivateKey
+	kid         string
+	keySeq      int
+	codes       map[string]authRequest
+	jwksFetches int
+	// Claims, when set, edits the claims of every ID token issued by the
+	// token endpoint before it is signed.
+	Claims func(map[string]any)
+}
+
+// NewServer starts a provider with one RSA signing key. Close it when done.
+func NewServer() *Server {
+	s := &Server{codes: map[string]authRequest{}}
+	s.RotateKey()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Issuer is the issuer identifier the provider puts in its tokens.
+func (s *Server) Issuer() string { return s.URL }
+
+// SetUser sets who the next authorization signs in.
+func (s *Server) SetUser(u User) {
+	s.mu.Lock()
+	s.user = u
+	s.mu.Unlock()
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID.
+// The old key is no longer published.
+func (s *Server) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	s.keySeq++
+	s.key = key
+	s.kid = fmt.Sprintf("key-%d", s.keySeq)
+	s.mu.Unlock()
+}
+
+// KeyID is the key ID of the current signing key.
+func (s *Server) KeyID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kid
+}
+
+// JWKSFetches counts requests to the JWKS endpoint.
+func (s *Server) JWKSFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksFetches
+}
+
+// IDTokenClaims returns valid claims for clientID and u, issued now and
+// expiring in an hour.
+func (s *Server) IDTokenClaims(clientID string, u User, nonce string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":            s.Issuer(),
+		"aud":            clientID,
+		"sub":            u.Subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          u.Email,
+		"email_verified": u.EmailVerified,
+		"given_name":     u.GivenName,
+		"family_name":    u.FamilyName,
+	}
+}
+
+// Sign serializes claims as an RS256 JWS under the current key.
+func (s *Server) Sign(claims map[string]any) string {
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+	signingInput := Segment(map[string]any{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + Segment(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// Segment encodes v as a base64url JSON token segment.
+func Segment(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.jwksFetches++
+	pub, kid := s.key.PublicKey, s.kid
+	s.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// authorize signs the current user in without a prompt and redirects back
+// with a code.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+	s.mu.Lock()
+	s.codes[code] = authRequest{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		user:        s.user,
+	}
+	s.mu.Unlock()
+	back, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	v := back.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	back.RawQuery = v.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client, redirect URI and PKCE
+// verifier against the authorization request.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	req, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	edit := s.Claims
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok, r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != req.clientID,
+		r.PostForm.Get("redirect_uri") != req.redirectURI,
+		base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	claims := s.IDTokenClaims(req.clientID, req.user, req.nonce)
+	if edit != nil {
+		edit(claims)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     s.Sign(claims),
+	})
+}
@@ -0,0 +1,253 @@
+// Package oidc implements the relying-party side of OpenID Connect: the
+// authorization code flow with PKCE, and ID token verification against the
+// provider's published JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid id token")
+	ErrNonce        = errors.New("oidc: nonce mismatch")
+)
+
+// Config describes one identity provider.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// TrustEmail marks the provider's verified emails as proof of owning
+	// the matching local account.
+	TrustEmail bool
+}
+
+// Provider is a discovered identity provider.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu   sync.Mutex
+	keys map[string]any // kid -> *rsa.PublicKey | *ecdsa.PublicKey
+}
+
+type discoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider fetches the provider's discovery document. A nil client uses a
+// default client with a short timeout.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	var doc discoveryDoc
+	if err := getJSON(ctx, client, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", cfg.Name, err)
+	}
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer mismatch %q", cfg.Name, doc.Issuer)
+	}
+	return &Provider{
+		cfg:      cfg,
+		client:   client,
+		authURL:  doc.AuthorizationEndpoint,
+		tokenURL: doc.TokenEndpoint,
+		jwksURL:  doc.JWKSURI,
+		keys:     map[string]any{},
+	}, nil
+}
+
+func (p *Provider) Name() string { return p.cfg.Name }
+
+// TrustsEmail reports whether the provider's verified emails may sign in to
+// existing local accounts.
+func (p *Provider) TrustsEmail() bool { return p.cfg.TrustEmail }
+
+// AuthCodeURL builds the URL the browser is sent to. The verifier is the PKCE
+// code verifier; only its S256 challenge leaves the server.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + v.Encode()
+}
+
+// Claims are the ID token claims the application uses.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	Name          string   `json:"name"`
+}
+
+// Exchange trades an authorization code for tokens and returns the verified
+// ID token claims. The nonce must match the one sent in AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token exchange: status %d", resp.StatusCode)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("oidc token exchange: no id_token in response")
+	}
+	claims, err := p.Verify(ctx, tok.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonce
+	}
+	return claims, nil
+}
+
+// Verify checks the ID token signature, issuer, audience and expiry.
+func (p *Provider) Verify(ctx context.Context, rawIDToken string) (*Claims, error) {
+	var claims Claims
+	if err := p.verifySignature(ctx, rawIDToken, &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	const leeway = 60
+	switch {
+	case claims.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: issuer", ErrInvalidToken)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: audience", ErrInvalidToken)
+	case claims.Expiry+leeway < now:
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.IssuedAt > now+leeway:
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+// audience accepts both the string and array forms of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(v string) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RandomString returns a URL-safe random string for state, nonce and PKCE
+// verifier values.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
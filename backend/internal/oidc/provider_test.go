@@ -0,0 +1,212 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/backend/internal/oidc"
+	"social-network/backend/internal/oidc/oidctest"
+)
+
+const clientID = "client-1"
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	srv := oidctest.NewServer()
+	t.Cleanup(srv.Close)
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:        "mock",
+		Issuer:      srv.Issuer(),
+		ClientID:    clientID,
+		RedirectURL: "http://app.test/callback",
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, p
+}
+
+// authorize runs the browser leg of the flow and returns the code.
+func authorize(t *testing.T, srv *oidctest.Server, authURL string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	srv, p := newProvider(t)
+	srv.SetUser(oidctest.User{Subject: "sub-1", Email: "a@example.com", EmailVerified: true})
+	code := authorize(t, srv, p.AuthCodeURL("state", "nonce", "verifier"))
+
+	claims, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "sub-1" || claims.Email != "a@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestExchangePKCEMismatch(t *testing.T) {
+	srv, p := newProvider(t)
+	srv.SetUser(oidctest.User{Subject: "sub-1"})
+	code := authorize(t, srv, p.AuthCodeURL("state", "nonce", "verifier"))
+
+	if _, err := p.Exchange(context.Background(), code, "another-verifier", "nonce"); err == nil {
+		t.Fatal("exchange with the wrong code verifier succeeded")
+	}
+}
+
+func TestExchangeNonceMismatch(t *testing.T) {
+	srv, p := newProvider(t)
+	srv.SetUser(oidctest.User{Subject: "sub-1"})
+	code := authorize(t, srv, p.AuthCodeURL("state", "nonce", "verifier"))
+
+	if _, err := p.Exchange(context.Background(), code, "verifier", "other-nonce"); !errors.Is(err, oidc.ErrNonce) {
+		t.Fatalf("err = %v, want ErrNonce", err)
+	}
+}
+
+func TestAuthCodeURLSendsOnlyChallenge(t *testing.T) {
+	_, p := newProvider(t)
+	u, err := url.Parse(p.AuthCodeURL("state", "nonce", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge") != oidc.CodeChallenge("verifier") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("challenge = %q (%q)", q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if strings.Contains(u.RawQuery, "verifier") {
+		t.Error("authorization URL leaks the code verifier")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	srv, p := newProvider(t)
+	valid := func() map[string]any {
+		return srv.IDTokenClaims(clientID, oidctest.User{Subject: "sub-1"}, "nonce")
+	}
+	with := func(key string, v any) string {
+		c := valid()
+		c[key] = v
+		return srv.Sign(c)
+	}
+	unsigned := func(alg string) string {
+		hdr := oidctest.Segment(map[string]string{"alg": alg, "kid": srv.KeyID()})
+		return hdr + "." + oidctest.Segment(valid()) + "."
+	}
+	// an HMAC token keyed with something public, as in alg confusion attacks
+	hs256 := func() string {
+		input := oidctest.Segment(map[string]string{"alg": "HS256", "kid": srv.KeyID()}) + "." + oidctest.Segment(valid())
+		mac := hmac.New(sha256.New, []byte(clientID))
+		mac.Write([]byte(input))
+		return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	tampered := func() string {
+		parts := strings.Split(srv.Sign(valid()), ".")
+		c := valid()
+		c["sub"] = "someone-else"
+		return parts[0] + "." + oidctest.Segment(c) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong issuer", with("iss", "https://evil.example")},
+		{"wrong audience", with("aud", "other-client")},
+		{"audience list without client", with("aud", []string{"a", "b"})},
+		{"expired", with("exp", time.Now().Add(-time.Hour).Unix())},
+		{"issued in the future", with("iat", time.Now().Add(time.Hour).Unix())},
+		{"missing subject", with("sub", "")},
+		{"alg none", unsigned("none")},
+		{"HS256", hs256()},
+		{"tampered payload", tampered()},
+		{"malformed", "not-a-jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Verify(context.Background(), tt.token); !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsAudienceList(t *testing.T) {
+	srv, p := newProvider(t)
+	c := srv.IDTokenClaims(clientID, oidctest.User{Subject: "sub-1"}, "")
+	c["aud"] = []string{"other", clientID}
+	if _, err := p.Verify(context.Background(), srv.Sign(c)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownKeyRefreshesJWKS(t *testing.T) {
+	srv, p := newProvider(t)
+	claims := srv.IDTokenClaims(clientID, oidctest.User{Subject: "sub-1"}, "")
+	if _, err := p.Verify(context.Background(), srv.Sign(claims)); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.JWKSFetches(); n != 1 {
+		t.Fatalf("JWKS fetched %d times for the first token, want 1", n)
+	}
+	// a known key is served from the cache
+	if _, err := p.Verify(context.Background(), srv.Sign(claims)); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.JWKSFetches(); n != 1 {
+		t.Fatalf("JWKS fetched %d times with a cached key, want 1", n)
+	}
+
+	srv.RotateKey()
+	if _, err := p.Verify(context.Background(), srv.Sign(claims)); err != nil {
+		t.Fatalf("token under a rotated key: %v", err)
+	}
+	if n := srv.JWKSFetches(); n != 2 {
+		t.Fatalf("JWKS fetched %d times after rotation, want 2", n)
+	}
+}
+
+func TestUnknownKeyStaysRejected(t *testing.T) {
+	srv, p := newProvider(t)
+	c := srv.IDTokenClaims(clientID, oidctest.User{Subject: "sub-1"}, "")
+	parts := strings.Split(srv.Sign(c), ".")
+	hdr := oidctest.Segment(map[string]string{"alg": "RS256", "kid": "missing"})
+	if _, err := p.Verify(context.Background(), hdr+"."+parts[1]+"."+parts[2]); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+	if n := srv.JWKSFetches(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+	_, err := oidc.NewProvider(context.Background(), oidc.Config{Name: "mock", Issuer: srv.Issuer() + "/", ClientID: clientID}, srv.Client())
+	if err == nil {
+		t.Fatal("discovery accepted a different issuer")
+	}
+}
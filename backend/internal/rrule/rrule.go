@@ -0,0 +1,456 @@
+// Package rrule implements the part of RFC 5545 recurrence rules that group
+// events use: FREQ=DAILY, WEEKLY, MONTHLY or YEARLY with INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY, BYMONTH, BYSETPOS and WKST. Occurrences keep
+// the wall-clock time of the first one in its location, across DST changes.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum is a BYDAY entry: a weekday, optionally the Nth (negative:
+// from the end) of the month or year.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int       // 0 = no limit
+	Until      time.Time // zero = no limit
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+var dayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// maxGap ends the search for the next occurrence of a rule that has
+// stopped matching (BYMONTHDAY=30;BYMONTH=2); leap days repeat within it.
+const maxGap = 10 * 366 * 24 * time.Hour
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE", with or without the
+// "RRULE:" prefix. A floating or date-only UNTIL is read in loc; a date
+// includes the whole day.
+func Parse(s string, loc *time.Location) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToUpper(strings.TrimSpace(k))
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if !ok || v == "" {
+			return nil, fmt.Errorf("rrule: malformed part %q", part)
+		}
+		if seen[k] {
+			return nil, fmt.Errorf("rrule: %s given twice", k)
+		}
+		seen[k] = true
+		var err error
+		switch k {
+		case "FREQ":
+			switch f := Frequency(v); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			case "SECONDLY", "MINUTELY", "HOURLY":
+				return nil, fmt.Errorf("rrule: FREQ=%s is not supported", v)
+			default:
+				return nil, fmt.Errorf("rrule: unknown FREQ %q", v)
+			}
+		case "INTERVAL":
+			r.Interval, err = positive(v)
+		case "COUNT":
+			r.Count, err = positive(v)
+		case "UNTIL":
+			r.Until, err = parseUntil(v, loc)
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = intList(v, -31, 31)
+		case "BYMONTH":
+			r.ByMonth, err = intList(v, 1, 12)
+		case "BYSETPOS":
+			r.BySetPos, err = intList(v, -366, 366)
+		case "WKST":
+			r.WeekStart, err = parseWeekday(v)
+		case "BYSECOND", "BYMINUTE", "BYHOUR", "BYYEARDAY", "BYWEEKNO":
+			return nil, fmt.Errorf("rrule: %s is not supported", k)
+		default:
+			return nil, fmt.Errorf("rrule: unknown part %s", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rrule: %s: %w", k, err)
+		}
+	}
+	switch {
+	case r.Freq == "":
+		return nil, errors.New("rrule: FREQ is required")
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, errors.New("rrule: COUNT and UNTIL can't both be given")
+	case len(r.BySetPos) > 0 && len(r.ByDay)+len(r.ByMonthDay)+len(r.ByMonth) == 0:
+		return nil, errors.New("rrule: BYSETPOS needs another BY part")
+	case len(r.ByMonthDay) > 0 && r.Freq == Weekly:
+		return nil, errors.New("rrule: BYMONTHDAY can't be used with FREQ=WEEKLY")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, errors.New("rrule: numbered BYDAY needs FREQ=MONTHLY or YEARLY")
+		}
+	}
+	return r, nil
+}
+
+func positive(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive number", v)
+	}
+	return n, nil
+}
+
+func intList(v string, lo, hi int) ([]int, error) {
+	var out []int
+	for _, s := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+		if err != nil || n == 0 || n < lo || n > hi {
+			return nil, fmt.Errorf("%q is out of range", s)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func parseWeekday(v string) (time.Weekday, error) {
+	for i, name := range dayNames {
+		if v == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", v)
+}
+
+func parseWeekdayNum(v string) (WeekdayNum, error) {
+	if len(v) < 2 {
+		return WeekdayNum{}, fmt.Errorf("rrule: BYDAY: unknown weekday %q", v)
+	}
+	day, err := parseWeekday(v[len(v)-2:])
+	if err != nil {
+		return WeekdayNum{}, fmt.Errorf("rrule: BYDAY: %w", err)
+	}
+	wd := WeekdayNum{Day: day}
+	if num := v[:len(v)-2]; num != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(num, "+"))
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("rrule: BYDAY: %q is out of range", v)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+func parseUntil(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", v, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", v, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date or time", v)
+}
+
+// String renders the rule in its canonical form, UNTIL in UTC.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	ints := func(name string, ns []int) {
+		if len(ns) > 0 {
+			s := make([]string, len(ns))
+			for i, n := range ns {
+				s[i] = strconv.Itoa(n)
+			}
+			parts = append(parts, name+"="+strings.Join(s, ","))
+		}
+	}
+	ints("BYMONTH", r.ByMonth)
+	ints("BYMONTHDAY", r.ByMonthDay)
+	if len(r.ByDay) > 0 {
+		s := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			s[i] = dayNames[d.Day]
+			if d.N != 0 {
+				s[i] = strconv.Itoa(d.N) + s[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(s, ","))
+	}
+	ints("BYSETPOS", r.BySetPos)
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of the series starting at dtstart that
+// start in [from, to), at most limit of them. DTSTART is always the first
+// occurrence, as RFC 5545 has it.
+func (r *Rule) Between(dtstart, from, to time.Time, limit int) []time.Time {
+	var out []time.Time
+	r.iterate(dtstart, from, to, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) {
+			out = append(out, t)
+		}
+		return len(out) < limit
+	})
+	return out
+}
+
+// Includes reports whether t is an occurrence of the series.
+func (r *Rule) Includes(dtstart, t time.Time) bool {
+	got := r.Between(dtstart, t, t.Add(time.Second), 1)
+	return len(got) == 1 && got[0].Equal(t)
+}
+
+// iterate yields occurrences in order until bound. Without COUNT nothing
+// before from depends on earlier periods, so it starts at the period holding
+// from instead of walking there from DTSTART.
+func (r *Rule) iterate(dtstart, from, bound time.Time, yield func(time.Time) bool) {
+	loc := dtstart.Location()
+	hh, mm, ss := dtstart.Clock()
+	n := 0
+	emit := func(t time.Time) bool {
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		n++
+		return yield(t) && (r.Count == 0 || n < r.Count)
+	}
+	if !emit(dtstart) {
+		return
+	}
+	first := civil(dtstart)
+	last := first
+	p := 0
+	if r.Count == 0 {
+		p = r.periodsBefore(first, civil(from.In(loc)))
+		if p > 0 {
+			last, _ = r.period(first, p)
+		}
+	}
+	stop := civil(bound.In(loc)).AddDate(0, 0, 1)
+	for ; ; p++ {
+		start, days := r.period(first, p)
+		if start.After(stop) || start.Sub(last) > maxGap {
+			return
+		}
+		for _, d := range r.filter(days, dtstart) {
+			t := time.Date(d.Year(), d.Month(), d.Day(), hh, mm, ss, 0, loc)
+			if !t.After(dtstart) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+			last = d
+		}
+	}
+}
+
+// civil is t's calendar date, as midnight UTC for day arithmetic.
+func civil(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// periodsBefore counts the whole periods between the one holding first and
+// the one holding day.
+func (r *Rule) periodsBefore(first, day time.Time) int {
+	if !day.After(first) {
+		return 0
+	}
+	// not Sub: a Duration only spans 292 years
+	days := int((day.Unix() - first.Unix()) / 86400)
+	var units int
+	switch r.Freq {
+	case Daily:
+		units = days
+	case Weekly:
+		back := (int(first.Weekday()) - int(r.WeekStart) + 7) % 7
+		units = (days + back) / 7
+	case Monthly:
+		units = (day.Year()-first.Year())*12 + int(day.Month()) - int(first.Month())
+	case Yearly:
+		units = day.Year() - first.Year()
+	}
+	return units / r.Interval
+}
+
+// period returns the first day and all days of the pth period after the
+// one holding first.
+func (r *Rule) period(first time.Time, p int) (time.Time, []time.Time) {
+	var start, end time.Time
+	step := p * r.Interval
+	switch r.Freq {
+	case Daily:
+		start = first.AddDate(0, 0, step)
+		end = start.AddDate(0, 0, 1)
+	case Weekly:
+		back := (int(first.Weekday()) - int(r.WeekStart) + 7) % 7
+		start = first.AddDate(0, 0, step*7-back)
+		end = start.AddDate(0, 0, 7)
+	case Monthly:
+		start = time.Date(first.Year(), first.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+	case Yearly:
+		start = time.Date(first.Year()+step, 1, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(1, 0, 0)
+	}
+	var days []time.Time
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return start, days
+}
+
+// filter keeps the days of a period the BY parts select, then applies
+// BYSETPOS.
+func (r *Rule) filter(days []time.Time, dtstart time.Time) []time.Time {
+	var out []time.Time
+	implicit := len(r.ByDay) == 0 && len(r.ByMonthDay) == 0
+	for _, d := range days {
+		if len(r.ByMonth) > 0 && !contains(r.ByMonth, int(d.Month())) {
+			continue
+		}
+		if len(r.ByMonthDay) > 0 && !r.matchMonthDay(d) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !r.matchDay(d) {
+			continue
+		}
+		if implicit {
+			switch r.Freq {
+			case Weekly:
+				if d.Weekday() != dtstart.Weekday() {
+					continue
+				}
+			case Monthly:
+				if d.Day() != dtstart.Day() {
+					continue
+				}
+			case Yearly:
+				if d.Day() != dtstart.Day() || (len(r.ByMonth) == 0 && d.Month() != dtstart.Month()) {
+					continue
+				}
+			}
+		}
+		out = append(out, d)
+	}
+	if len(r.BySetPos) == 0 || len(out) == 0 {
+		return out
+	}
+	var picked []time.Time
+	seen := map[int]bool{}
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(out) + pos
+		}
+		if i >= 0 && i < len(out) && !seen[i] {
+			seen[i] = true
+			picked = append(picked, out[i])
+		}
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].Before(picked[j]) })
+	return picked
+}
+
+func (r *Rule) matchMonthDay(d time.Time) bool {
+	dim := daysIn(d.Year(), d.Month())
+	for _, n := range r.ByMonthDay {
+		if n == d.Day() || (n < 0 && dim+n+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDay checks BYDAY; numbered entries count within the month, or within
+// the year for yearly rules without BYMONTH.
+func (r *Rule) matchDay(d time.Time) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day != d.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+		var index, total int
+		if r.Freq == Yearly && len(r.ByMonth) == 0 {
+			index, total = d.YearDay(), time.Date(d.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		} else {
+			index, total = d.Day(), daysIn(d.Year(), d.Month())
+		}
+		if wd.N > 0 && (index-1)/7+1 == wd.N {
+			return true
+		}
+		if wd.N < 0 && -((total-index)/7+1) == wd.N {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func contains(ns []int, n int) bool {
+	for _, x := range ns {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
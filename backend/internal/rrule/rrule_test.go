@@ -0,0 +1,183 @@
+package rrule
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string, loc *time.Location) *Rule {
+	t.Helper()
+	r, err := Parse(s, loc)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return r
+}
+
+func dates(ts []time.Time) []string {
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		out[i] = t.Format("2006-01-02 15:04 MST")
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=3;UNTIL=20260101",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		if _, err := Parse(s, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
+
+func TestStringIsCanonical(t *testing.T) {
+	r := mustParse(t, "rrule:byday=-1fr,mo;freq=monthly;wkst=su;interval=2;until=20261231", time.UTC)
+	want := "FREQ=MONTHLY;INTERVAL=2;UNTIL=20261231T235959Z;BYDAY=-1FR,MO;WKST=SU"
+	if got := r.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if again := mustParse(t, want, time.UTC).String(); again != want {
+		t.Errorf("round trip = %q", again)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	utc := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		rule    string
+		dtstart string
+		want    []string
+	}{
+		{"FREQ=DAILY;INTERVAL=2;COUNT=3", "2026-03-01 09:00",
+			[]string{"2026-03-01 09:00 UTC", "2026-03-03 09:00 UTC", "2026-03-05 09:00 UTC"}},
+		{"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", "2026-03-02 18:30",
+			[]string{"2026-03-02 18:30 UTC", "2026-03-04 18:30 UTC", "2026-03-09 18:30 UTC", "2026-03-11 18:30 UTC"}},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=3", "2026-01-30 12:00",
+			[]string{"2026-01-30 12:00 UTC", "2026-02-27 12:00 UTC", "2026-03-31 12:00 UTC"}},
+		{"FREQ=MONTHLY;BYDAY=2TU;UNTIL=20260430", "2026-01-13 19:00",
+			[]string{"2026-01-13 19:00 UTC", "2026-02-10 19:00 UTC", "2026-03-10 19:00 UTC", "2026-04-14 19:00 UTC"}},
+		{"FREQ=YEARLY;COUNT=3", "2024-02-29 08:00",
+			[]string{"2024-02-29 08:00 UTC", "2028-02-29 08:00 UTC", "2032-02-29 08:00 UTC"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", "2026-01-31 07:00",
+			[]string{"2026-01-31 07:00 UTC", "2026-02-28 07:00 UTC", "2026-03-31 07:00 UTC"}},
+		// only DTSTART: February never has a 30th
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "2026-01-10 10:00",
+			[]string{"2026-01-10 10:00 UTC"}},
+	}
+	for _, tt := range tests {
+		start := utc(tt.dtstart)
+		got := dates(mustParse(t, tt.rule, time.UTC).Between(start, start, start.AddDate(20, 0, 0), 100))
+		if !equal(got, tt.want) {
+			t.Errorf("%s from %s:\n got %v\nwant %v", tt.rule, tt.dtstart, got, tt.want)
+		}
+	}
+}
+
+func TestBetweenKeepsWallClockAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	start := time.Date(2026, 3, 28, 9, 0, 0, 0, loc)
+	got := dates(mustParse(t, "FREQ=DAILY;COUNT=3", loc).Between(start, start, start.AddDate(0, 1, 0), 10))
+	want := []string{"2026-03-28 09:00 CET", "2026-03-29 09:00 CEST", "2026-03-30 09:00 CEST"}
+	if !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Starting at the period holding from must give what walking from DTSTART
+// does.
+func TestBetweenFromLaterWindow(t *testing.T) {
+	start := time.Date(2021, 5, 17, 20, 0, 0, 0, time.UTC)
+	from := time.Date(2026, 2, 11, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 4, 0)
+	for _, s := range []string{
+		"FREQ=DAILY;INTERVAL=3",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,TH;WKST=SU",
+		"FREQ=MONTHLY;INTERVAL=5;BYDAY=-1FR",
+		"FREQ=MONTHLY;BYMONTHDAY=31",
+		"FREQ=YEARLY;BYMONTH=3,5;BYDAY=1MO",
+		"FREQ=WEEKLY;UNTIL=20260301",
+	} {
+		r := mustParse(t, s, time.UTC)
+		var want []string
+		for _, d := range r.Between(start, start, to, 10000) {
+			if !d.Before(from) {
+				want = append(want, d.Format(time.RFC3339))
+			}
+		}
+		var got []string
+		for _, d := range r.Between(start, from, to, 10000) {
+			got = append(got, d.Format(time.RFC3339))
+		}
+		if !equal(got, want) {
+			t.Errorf("%s:\n got %v\nwant %v", s, got, want)
+		}
+	}
+}
+
+func TestBetweenSkipsToWindow(t *testing.T) {
+	r := mustParse(t, "FREQ=DAILY", time.UTC)
+	start := time.Date(1, 1, 1, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	got := r.Between(start, from, from.AddDate(0, 0, 7), 100)
+	runtime.ReadMemStats(&after)
+	if len(got) != 7 || !got[0].Equal(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %v", dates(got))
+	}
+	// walking 740,000 days from DTSTART allocates far more than this
+	if n := after.Mallocs - before.Mallocs; n > 1000 {
+		t.Errorf("%d allocations for one week", n)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	r := mustParse(t, "FREQ=WEEKLY;BYDAY=TU", time.UTC)
+	start := time.Date(1990, 1, 2, 10, 0, 0, 0, time.UTC)
+	if !r.Includes(start, time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)) {
+		t.Error("a Tuesday at 10:00 is not included")
+	}
+	if r.Includes(start, time.Date(2026, 10, 20, 11, 0, 0, 0, time.UTC)) {
+		t.Error("a Tuesday at 11:00 is included")
+	}
+	if r.Includes(start, time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC)) {
+		t.Error("a Wednesday is included")
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// AccountService handles account lifecycle work that spans many tables:
+// scheduled deletion and the hard delete that follows the grace period.
+type AccountService struct {
+	DB *sql.DB
+	// Every configured store by Name(), so media kept in a backend that is
+	// no longer the active one is still removed.
+	Stores map[string]MediaStore
+	// How long a deletion request can be cancelled before it is carried out.
+	GracePeriod time.Duration
+}
+
+// ScheduleDeletion marks the user for deletion after the grace period and
+// returns when the hard delete will happen.
+func (s *AccountService) ScheduleDeletion(userID string) (time.Time, error) {
+	at := time.Now().Add(s.GracePeriod).UTC()
+	if _, err := s.DB.Exec("UPDATE users SET delete_after = ? WHERE id = ?", at, userID); err != nil {
+		return time.Time{}, err
+	}
+	return at, nil
+}
+
+// CancelDeletion clears a pending deletion request.
+func (s *AccountService) CancelDeletion(userID string) error {
+	_, err := s.DB.Exec("UPDATE users SET delete_after = NULL WHERE id = ?", userID)
+	return err
+}
+
+// DeletionScheduledAt returns the pending deletion time, if any.
+func (s *AccountService) DeletionScheduledAt(userID string) (*time.Time, error) {
+	var at sql.NullTime
+	if err := s.DB.QueryRow("SELECT delete_after FROM users WHERE id = ?", userID).Scan(&at); err != nil {
+		return nil, err
+	}
+	if !at.Valid {
+		return nil, nil
+	}
+	return &at.Time, nil
+}
+
+// DeleteUser permanently removes a user. Owned groups are handed to their
+// longest-standing member (or deleted when the owner is alone), every row
+// referencing the user goes through the foreign key cascades, and the user's
+// media is removed from the store holding it once the transaction has
+// committed.
+func (s *AccountService) DeleteUser(ctx context.Context, userID string) error {
+	media, err := s.userMedia(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	groups, err := tx.Query("SELECT id FROM groups WHERE owner_user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var owned []string
+	for groups.Next() {
+		var gid string
+		if err := groups.Scan(&gid); err != nil {
+			groups.Close()
+			return err
+		}
+		owned = append(owned, gid)
+	}
+	groups.Close()
+
+	for _, gid := range owned {
+		var heir string
+		err := tx.QueryRow(`SELECT user_id FROM group_members WHERE group_id = ? AND user_id != ?
+			ORDER BY joined_at ASC LIMIT 1`, gid, userID).Scan(&heir)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := tx.Exec("DELETE FROM groups WHERE id = ?", gid); err != nil {
+				return fmt.Errorf("delete group %s: %w", gid, err)
+			}
+		case err != nil:
+			return err
+		default:
+			if _, err := tx.Exec("UPDATE groups SET owner_user_id = ? WHERE id = ?", heir, gid); err != nil {
+				return fmt.Errorf("transfer group %s: %w", gid, err)
+			}
+			if _, err := tx.Exec("UPDATE group_members SET role = 'owner' WHERE group_id = ? AND user_id = ?", gid, heir); err != nil {
+				return fmt.Errorf("transfer group %s: %w", gid, err)
+			}
+		}
+	}
+
+	// everything else cascades from users (notifications keep the row with a NULL actor)
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, m := range media {
+		store := s.Stores[m.storage]
+		if store == nil {
+			log.Printf("account deletion %s: no %q store for %s", userID, m.storage, m.key)
+			continue
+		}
+		if err := DeleteImage(ctx, s.DB, store, m.key); err != nil {
+			log.Printf("account deletion %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+type storedKey struct{ storage, key string }
+
+// userMedia lists where the user's avatar, post images and attachments are
+// stored, whichever backend holds them.
+func (s *AccountService) userMedia(userID string) ([]storedKey, error) {
+	rows, err := s.DB.Query(`
+		SELECT COALESCE(avatar_storage, ''), avatar_path FROM profiles WHERE user_id = ?1 AND avatar_path IS NOT NULL
+		UNION
+		SELECT COALESCE(pi.storage, ''), pi.path FROM post_images pi JOIN posts p ON p.id = pi.post_id
+		WHERE p.user_id = ?1
+		UNION
+		SELECT storage, path FROM attachments WHERE uploader_id = ?1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var media []storedKey
+	for rows.Next() {
+		var m storedKey
+		if err := rows.Scan(&m.storage, &m.key); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+// PurgeDue hard-deletes every account whose grace period has elapsed.
+func (s *AccountService) PurgeDue(ctx context.Context) error {
+	rows, err := s.DB.Query("SELECT id FROM users WHERE delete_after IS NOT NULL AND delete_after <= ?", time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	var due []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			due = append(due, id)
+		}
+	}
+	rows.Close()
+	for _, id := range due {
+		if err := s.DeleteUser(ctx, id); err != nil {
+			log.Printf("account deletion %s failed: %v", id, err)
+			continue
+		}
+		log.Printf("account %s deleted", id)
+	}
+	return nil
+}
+
+// RunPurger calls PurgeDue every interval until ctx is cancelled.
+func (s *AccountService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.PurgeDue(ctx); err != nil {
+			log.Printf("account purger: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"social-network/backend/internal/db"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.OpenSQLite(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.ApplyMigrations(conn, "../db/migrations/sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// memStore is a MediaStore that only records deletions.
+type memStore struct {
+	name    string
+	deleted []string
+}
+
+func (m *memStore) Name() string { return m.name }
+func (m *memStore) Put(context.Context, io.Reader, PutOptions) (*StoredMedia, error) {
+	return nil, nil
+}
+func (m *memStore) Open(context.Context, string) (io.ReadCloser, error) { return nil, ErrMediaNotFound }
+func (m *memStore) Delete(_ context.Context, key string) error {
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+func (m *memStore) URL(key string) string                                { return key }
+func (m *memStore) List(context.Context, func(StoredObject) error) error { return nil }
+
+func TestDeleteUserRemovesMediaFromEveryStore(t *testing.T) {
+	conn := newTestDB(t)
+	local := &memStore{name: "local"}
+	cloud := &memStore{name: "cloudinary"}
+	svc := &AccountService{DB: conn, Stores: map[string]MediaStore{"local": local, "cloudinary": cloud}}
+
+	for _, q := range []string{
+		`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth) VALUES('u1', 'u1@x', 'h', 'U', 'One', '2000-01-01')`,
+		// the avatar predates a switch to the local backend
+		`INSERT INTO profiles(user_id, public, avatar_path, avatar_storage) VALUES('u1', 1, 'avatars/u1', 'cloudinary')`,
+		`INSERT INTO posts(id, user_id, text, privacy) VALUES('p1', 'u1', 'hi', 'public')`,
+		`INSERT INTO post_images(id, post_id, path, mime, storage) VALUES('i1', 'p1', 'posts/p1', 'image/jpeg', 'cloudinary')`,
+		`INSERT INTO post_images(id, post_id, path, mime, storage) VALUES('i2', 'p1', 'ab/cd.jpg', 'image/jpeg', 'local')`,
+		`INSERT INTO media_variants(storage, source_key, variant, format, key, width, height) VALUES('cloudinary', 'posts/p1', 'thumb', 'jpeg', 'posts/p1_thumb', 96, 96)`,
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if err := svc.DeleteUser(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(cloud.deleted)
+	if got := cloud.deleted; len(got) != 3 || got[0] != "avatars/u1" || got[1] != "posts/p1" || got[2] != "posts/p1_thumb" {
+		t.Errorf("cloudinary deletions = %v", got)
+	}
+	if got := local.deleted; len(got) != 1 || got[0] != "ab/cd.jpg" {
+		t.Errorf("local deletions = %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"social-network/backend/internal/auth"
+
+	"github.com/google/uuid"
+)
+
+// ErrAdminEmailTaken means the admin email already belongs to an account,
+// which is never promoted: anyone could have registered it.
+var ErrAdminEmailTaken = errors.New("the admin email belongs to an existing account; set ADMIN_EMAIL to an unused address, or if the account is yours, set its role to 'admin' in the users table")
+
+// SeedAdmin makes sure the site has an admin. While nobody has the admin
+// role, it creates the account with email and password. It reports whether
+// it created one.
+func SeedAdmin(db *sql.DB, email, password string) (bool, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE role = ?)", auth.RoleAdmin).Scan(&exists); err != nil || exists {
+		return false, err
+	}
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? COLLATE NOCASE)", email).Scan(&taken); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, ErrAdminEmailTaken
+	}
+	if password == "" {
+		return false, errors.New("no admin yet and no admin password to create one")
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	id := uuid.NewString()
+	if _, err := tx.Exec(`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth, role)
+		VALUES(?, ?, ?, 'Site', 'Admin', '1970-01-01', ?)`, id, email, hash, auth.RoleAdmin); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO profiles(user_id, public, nickname, about) VALUES(?, 0, 'admin', '')", id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSeedAdminNeverPromotes(t *testing.T) {
+	conn := newTestDB(t)
+	if _, err := conn.Exec(`INSERT INTO users(id, email, password_hash, first_name, last_name, date_of_birth)
+		VALUES('u1', 'Admin@example.com', 'h', 'Eve', 'Early', '2000-01-01')`); err != nil {
+		t.Fatal(err)
+	}
+	seeded, err := SeedAdmin(conn, "admin@example.com", "secret-password")
+	if !errors.Is(err, ErrAdminEmailTaken) || seeded {
+		t.Fatalf("SeedAdmin = %v, %v; want ErrAdminEmailTaken", seeded, err)
+	}
+	var role string
+	if err := conn.QueryRow("SELECT role FROM users WHERE id = 'u1'").Scan(&role); err != nil {
+		t.Fatal(err)
+	}
+	if role != "user" {
+		t.Errorf("registered account got role %q", role)
+	}
+}
+
+func TestSeedAdminCreatesOnce(t *testing.T) {
+	conn := newTestDB(t)
+	if seeded, err := SeedAdmin(conn, "admin@example.com", "secret-password"); err != nil || !seeded {
+		t.Fatalf("first SeedAdmin = %v, %v", seeded, err)
+	}
+	if seeded, err := SeedAdmin(conn, "admin@example.com", "secret-password"); err != nil || seeded {
+		t.Fatalf("second SeedAdmin = %v, %v", seeded, err)
+	}
+	var n int
+	_ = conn.QueryRow("SELECT COUNT(1) FROM users WHERE role = 'admin'").Scan(&n)
+	if n != 1 {
+		t.Errorf("%d admins, want 1", n)
+	}
+}
+
+func TestSeedAdminNeedsPassword(t *testing.T) {
+	conn := newTestDB(t)
+	if _, err := SeedAdmin(conn, "admin@example.com", ""); err == nil {
+		t.Fatal("SeedAdmin without a password succeeded")
+	}
+}
@@ -3,9 +3,14 @@ package services
 import (
 	"context"
 	"fmt"
-	"mime/multipart"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/google/uuid"
 
@@ -14,6 +19,10 @@ import (
 
 type CloudinaryService struct {
 	cld *cloudinary.Cloudinary
+	// folder prefixes every public ID this instance creates and bounds what
+	// List sees, so instances sharing an account stay out of each other's
+	// assets.
+	folder string
 }
 
 type UploadResult struct {
@@ -36,19 +45,17 @@ func NewCloudinaryService(cfg *config.CloudinaryConfig) (*CloudinaryService, err
 		return nil, fmt.Errorf("failed to initialize cloudinary: %w", err)
 	}
 
-	return &CloudinaryService{cld: cld}, nil
+	return &CloudinaryService{cld: cld, folder: "social-network/" + cfg.Environment + "/"}, nil
 }
 
-func (s *CloudinaryService) UploadAvatar(ctx context.Context, file multipart.File, userID string) (*UploadResult, error) {
+func (s *CloudinaryService) UploadAvatar(ctx context.Context, file io.Reader, userID string) (*UploadResult, error) {
 	// Generate unique public ID for avatar
-	publicID := fmt.Sprintf("avatars/%s", userID)
+	publicID := fmt.Sprintf("%savatars/%s", s.folder, userID)
 
-	// Upload with specific transformations for avatars
+	// The image arrives already cropped and sized by the imaging pipeline
 	result, err := s.cld.Upload.Upload(ctx, file, uploader.UploadParams{
 		PublicID:       publicID,
-		Folder:         "social-network/avatars",
 		ResourceType:   "image",
-		Transformation: "c_thumb,g_face,h_200,w_200/r_max/f_auto/q_auto",
 		Overwrite:      &[]bool{true}[0],
 		UniqueFilename: &[]bool{false}[0],
 	})
@@ -68,19 +75,17 @@ func (s *CloudinaryService) UploadAvatar(ctx context.Context, file multipart.Fil
 	}, nil
 }
 
-func (s *CloudinaryService) UploadPostImage(ctx context.Context, file multipart.File, postID string) (*UploadResult, error) {
+func (s *CloudinaryService) UploadPostImage(ctx context.Context, file io.Reader, postID string) (*UploadResult, error) {
 	// Generate unique public ID for post image
 	imageID := uuid.NewString()
-	publicID := fmt.Sprintf("posts/%s/%s", postID, imageID)
+	publicID := fmt.Sprintf("%sposts/%s/%s", s.folder, postID, imageID)
 
-	fmt.Printf("Cloudinary upload params: PublicID=%s, Folder=social-network/posts\n", publicID)
+	fmt.Printf("Cloudinary upload params: PublicID=%s\n", publicID)
 
-	// Upload with optimizations for post images
+	// The image arrives already sized by the imaging pipeline
 	result, err := s.cld.Upload.Upload(ctx, file, uploader.UploadParams{
 		PublicID:       publicID,
-		Folder:         "social-network/posts",
 		ResourceType:   "image",
-		Transformation: "c_limit,w_1200/f_auto/q_auto",
 		Overwrite:      &[]bool{false}[0],
 		UniqueFilename: &[]bool{true}[0],
 	})
@@ -111,9 +116,60 @@ func (s *CloudinaryService) UploadPostImage(ctx context.Context, file multipart.
 	}, nil
 }
 
+// UploadAttachment stores a message or group post attachment as an
+// authenticated asset: Cloudinary only delivers it through a signed URL,
+// which never leaves the server (see Open).
+func (s *CloudinaryService) UploadAttachment(ctx context.Context, file io.Reader, attachmentID string) (*UploadResult, error) {
+	result, err := s.cld.Upload.Upload(ctx, file, uploader.UploadParams{
+		PublicID:       s.folder + PrivateMediaPrefix + "attachments/" + attachmentID,
+		Type:           api.Authenticated,
+		ResourceType:   "image",
+		Overwrite:      &[]bool{false}[0],
+		UniqueFilename: &[]bool{false}[0],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload attachment: %w", err)
+	}
+	if result.PublicID == "" {
+		return nil, fmt.Errorf("upload succeeded but no public ID returned")
+	}
+	// the URLs in the result don't work without a signature
+	return &UploadResult{
+		PublicID: result.PublicID,
+		Width:    result.Width,
+		Height:   result.Height,
+		Format:   result.Format,
+		Bytes:    result.Bytes,
+	}, nil
+}
+
+// deliveryType is where a stored key lives: attachments are authenticated,
+// everything else is a public upload.
+func (s *CloudinaryService) deliveryType(key string) api.DeliveryType {
+	if strings.HasPrefix(strings.TrimPrefix(key, s.folder), PrivateMediaPrefix) {
+		return api.Authenticated
+	}
+	return api.Upload
+}
+
+// signedURL is a delivery URL for an authenticated asset. Anyone holding it
+// can fetch the image, so it is only ever used server-side.
+func (s *CloudinaryService) signedURL(key string) (string, error) {
+	img, err := s.cld.Image(key)
+	if err != nil {
+		return "", err
+	}
+	img.DeliveryType = api.Authenticated
+	img.Config.URL.Secure = true
+	img.Config.URL.SignURL = true
+	img.Config.URL.Analytics = false
+	return img.String()
+}
+
 func (s *CloudinaryService) DeleteImage(ctx context.Context, publicID string) error {
 	_, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{
 		PublicID:     publicID,
+		Type:         string(s.deliveryType(publicID)),
 		ResourceType: "image",
 	})
 
@@ -140,6 +196,113 @@ func (s *CloudinaryService) GetOptimizedURL(publicID string, maxWidth int) strin
 	return fmt.Sprintf("https://res.cloudinary.com/%s/image/upload/%s/%s", s.cld.Config.Cloud.CloudName, transformStr, publicID)
 }
 
+// MediaStore implementation
+
+func (s *CloudinaryService) Name() string { return "cloudinary" }
+
+func (s *CloudinaryService) Put(ctx context.Context, r io.Reader, opts PutOptions) (*StoredMedia, error) {
+	var res *UploadResult
+	var err error
+	owner := opts.OwnerID
+	if opts.Variant != "" {
+		owner += "_" + opts.Variant
+	}
+	switch opts.Kind {
+	case MediaAvatar:
+		res, err = s.UploadAvatar(ctx, r, owner)
+	case MediaAttachment:
+		res, err = s.UploadAttachment(ctx, r, owner)
+	default:
+		res, err = s.UploadPostImage(ctx, r, owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &StoredMedia{
+		Key:       res.PublicID,
+		URL:       res.URL,
+		SecureURL: res.SecureURL,
+		Width:     res.Width,
+		Height:    res.Height,
+		Format:    res.Format,
+		Bytes:     int64(res.Bytes),
+	}, nil
+}
+
+// Open fetches a stored image. Attachments are fetched through a signed URL,
+// so callers must have checked the viewer's access first.
+func (s *CloudinaryService) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	u := s.GetImageURL(key)
+	if s.deliveryType(key) == api.Authenticated {
+		var err error
+		if u, err = s.signedURL(key); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrMediaNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: status %d", key, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (s *CloudinaryService) Delete(ctx context.Context, key string) error {
+	return s.DeleteImage(ctx, key)
+}
+
+// URL is the public delivery URL of key. Attachments have none that works:
+// they are streamed by the access-checked attachment handler instead.
+func (s *CloudinaryService) URL(key string) string {
+	return s.GetImageURL(key)
+}
+
+// List pages through the Admin API for this instance's images: public
+// uploads and authenticated attachments under its folder. Other assets on
+// the account, including those of other environments and any uploaded
+// before uploads were scoped to a folder, are never listed.
+func (s *CloudinaryService) List(ctx context.Context, fn func(StoredObject) error) error {
+	for _, delivery := range []api.DeliveryType{api.Upload, api.Authenticated} {
+		cursor := ""
+		for {
+			res, err := s.cld.Admin.Assets(ctx, admin.AssetsParams{
+				AssetType:    api.Image,
+				DeliveryType: string(delivery),
+				Prefix:       s.folder,
+				MaxResults:   500,
+				NextCursor:   cursor,
+			})
+			if err != nil {
+				return fmt.Errorf("list cloudinary assets: %w", err)
+			}
+			if res.Error.Message != "" {
+				return fmt.Errorf("list cloudinary assets: %s", res.Error.Message)
+			}
+			for _, a := range res.Assets {
+				if err := fn(StoredObject{Key: a.PublicID, Bytes: int64(a.Bytes), ModTime: a.CreatedAt}); err != nil {
+					return err
+				}
+			}
+			if res.NextCursor == "" {
+				break
+			}
+			cursor = res.NextCursor
+		}
+	}
+	return nil
+}
+
 // Helper function to get file extension from content type
 func getFileExtension(contentType string) string {
 	switch contentType {
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"social-network/backend/internal/config"
+)
+
+func newTestCloudinary(t *testing.T) *CloudinaryService {
+	t.Helper()
+	s, err := NewCloudinaryService(&config.CloudinaryConfig{CloudName: "demo", APIKey: "key", APISecret: "secret", Environment: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCloudinaryAttachmentsAreSigned(t *testing.T) {
+	s := newTestCloudinary(t)
+	key := "social-network/test/" + PrivateMediaPrefix + "attachments/a1"
+	u, err := s.signedURL(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, "https://res.cloudinary.com/demo/image/authenticated/s--") || !strings.HasSuffix(u, "/v1/"+key) {
+		t.Errorf("signed URL = %s", u)
+	}
+	if got := s.deliveryType(key); got != "authenticated" {
+		t.Errorf("attachment delivery type = %s", got)
+	}
+	for _, key := range []string{"social-network/test/posts/p1/i1", "avatars/u1"} {
+		if got := s.deliveryType(key); got != "upload" {
+			t.Errorf("%s delivery type = %s", key, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"social-network/backend/internal/rrule"
+)
+
+// MaxOccurrences caps how many occurrences one expansion returns.
+const MaxOccurrences = 500
+
+// OccurrenceKey names an occurrence of a repeating event in the database:
+// its original start in UTC. Events that don't repeat have the key "".
+func OccurrenceKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// EventSeries is the timing of a group event, repeating or not.
+type EventSeries struct {
+	ID       string
+	StartsAt time.Time
+	EndsAt   time.Time
+	Timezone string
+	RRule    string // "" for events that don't repeat
+	ExDates  string // removed occurrences, comma-separated keys
+}
+
+// OccurrenceOverride is an edit to one occurrence; nil fields keep the
+// series' value.
+type OccurrenceOverride struct {
+	Title       *string
+	Description *string
+	Location    *string
+	StartsAt    *time.Time
+	EndsAt      *time.Time
+	CancelledAt *time.Time
+	UpdatedAt   time.Time
+	Sequence    int // iCalendar SEQUENCE of the edit, on top of the series'
+}
+
+// Occurrence is one instance of an event, with its edit if it has one.
+type Occurrence struct {
+	Key      string
+	Original time.Time // start before any edit
+	StartsAt time.Time
+	EndsAt   time.Time
+	Override *OccurrenceOverride
+}
+
+// Location is the zone the event's wall-clock times are kept in.
+func (s *EventSeries) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// Rule parses the series' RRULE; nil for events that don't repeat.
+func (s *EventSeries) Rule() (*rrule.Rule, error) {
+	if s.RRule == "" {
+		return nil, nil
+	}
+	return rrule.Parse(s.RRule, s.Location())
+}
+
+// ExDateKeys returns the keys of the removed occurrences.
+func (s *EventSeries) ExDateKeys() []string {
+	if s.ExDates == "" {
+		return nil
+	}
+	return strings.Split(s.ExDates, ",")
+}
+
+func (s *EventSeries) occurrence(original time.Time, key string, o *OccurrenceOverride) Occurrence {
+	occ := Occurrence{Key: key, Original: original, StartsAt: original, EndsAt: original.Add(s.EndsAt.Sub(s.StartsAt)), Override: o}
+	if o != nil && o.StartsAt != nil {
+		occ.StartsAt = *o.StartsAt
+	}
+	if o != nil && o.EndsAt != nil {
+		occ.EndsAt = *o.EndsAt
+	}
+	return occ
+}
+
+// Occurrences returns the occurrences starting in [from, to), edited ones
+// where their edit puts them, in order of start.
+func (s *EventSeries) Occurrences(overrides map[string]*OccurrenceOverride, from, to time.Time) ([]Occurrence, error) {
+	rule, err := s.Rule()
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		if !s.StartsAt.Before(from) && s.StartsAt.Before(to) {
+			return []Occurrence{{Original: s.StartsAt, StartsAt: s.StartsAt, EndsAt: s.EndsAt}}, nil
+		}
+		return nil, nil
+	}
+	removed := map[string]bool{}
+	for _, k := range s.ExDateKeys() {
+		removed[k] = true
+	}
+	dtstart := s.StartsAt.In(s.Location())
+	var out []Occurrence
+	seen := map[string]bool{}
+	for _, t := range rule.Between(dtstart, from, to, MaxOccurrences+len(removed)) {
+		key := OccurrenceKey(t)
+		seen[key] = true
+		if removed[key] {
+			continue
+		}
+		occ := s.occurrence(t.UTC(), key, overrides[key])
+		if !occ.StartsAt.Before(from) && occ.StartsAt.Before(to) {
+			out = append(out, occ)
+		}
+	}
+	// occurrences moved into the window from outside it
+	for key, o := range overrides {
+		if seen[key] || removed[key] || o.StartsAt == nil || o.StartsAt.Before(from) || !o.StartsAt.Before(to) {
+			continue
+		}
+		if occ, ok := s.Occurrence(key, overrides); ok {
+			out = append(out, occ)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartsAt.Before(out[j].StartsAt) })
+	if len(out) > MaxOccurrences {
+		out = out[:MaxOccurrences]
+	}
+	return out, nil
+}
+
+// Occurrence looks up one occurrence of a repeating event by key; false if
+// the series has no such occurrence or it was removed.
+func (s *EventSeries) Occurrence(key string, overrides map[string]*OccurrenceOverride) (Occurrence, bool) {
+	rule, err := s.Rule()
+	if err != nil || rule == nil {
+		return Occurrence{}, false
+	}
+	for _, k := range s.ExDateKeys() {
+		if k == key {
+			return Occurrence{}, false
+		}
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", key, time.UTC)
+	if err != nil || !rule.Includes(s.StartsAt.In(s.Location()), t) {
+		return Occurrence{}, false
+	}
+	return s.occurrence(t, key, overrides[key]), true
+}
+
+// LoadOccurrenceOverrides reads the edited occurrences of an event.
+func LoadOccurrenceOverrides(db *sql.DB, eventID string) (map[string]*OccurrenceOverride, error) {
+	rows, err := db.Query(`SELECT occurrence, title, description, location, starts_at, ends_at, cancelled_at, updated_at, sequence
+		FROM group_event_occurrences WHERE event_id = ?`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]*OccurrenceOverride{}
+	for rows.Next() {
+		var key string
+		var title, desc, location sql.NullString
+		var start, end, cancelled sql.NullTime
+		o := &OccurrenceOverride{}
+		if err := rows.Scan(&key, &title, &desc, &location, &start, &end, &cancelled, &o.UpdatedAt, &o.Sequence); err != nil {
+			return nil, err
+		}
+		o.Title, o.Description, o.Location = nullString(title), nullString(desc), nullString(location)
+		o.StartsAt, o.EndsAt, o.CancelledAt = nullTime(start), nullTime(end), nullTime(cancelled)
+		out[key] = o
+	}
+	return out, rows.Err()
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
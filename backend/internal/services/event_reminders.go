@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventReminders notifies the members who answered going or maybe that a
+// group event, or an occurrence of a repeating one, is coming up, once per
+// offset before its start. Moving an event re-arms its reminders; cancelled
+// events get none.
+type EventReminders struct {
+	DB      *sql.DB
+	Offsets []time.Duration // e.g. 24h and 1h before the start
+}
+
+// SendDue sends the reminders that are due at now and returns how many
+// occurrences were reminded about. When several offsets are due at once (an
+// event created an hour before it starts) only the nearest is sent.
+func (s *EventReminders) SendDue(ctx context.Context, now time.Time) (int, error) {
+	offsets := append([]time.Duration(nil), s.Offsets...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	sent := 0
+	for _, off := range offsets {
+		due, err := s.due(ctx, now, off)
+		if err != nil {
+			return sent, err
+		}
+		minutes := int(off / time.Minute)
+		for _, d := range due {
+			var done bool
+			err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM group_event_reminders
+				WHERE event_id = ? AND starts_at = ? AND offset_minutes <= ?)`, d.eventID, d.startsAt, minutes).Scan(&done)
+			if err != nil {
+				return sent, err
+			}
+			if done {
+				continue
+			}
+			ok, err := s.remind(ctx, d, minutes)
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// dueOccurrence is an occurrence starting within an offset of now.
+type dueOccurrence struct {
+	eventID  string
+	key      string // "" for events that don't repeat
+	startsAt string
+}
+
+// due lists the occurrences, of single events and of series, that start
+// in (now, now+off] and aren't cancelled.
+func (s *EventReminders) due(ctx context.Context, now time.Time, off time.Duration) ([]dueOccurrence, error) {
+	from, to := now.UTC().Format("2006-01-02 15:04:05"), now.Add(off).UTC().Format("2006-01-02 15:04:05")
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, starts_at, ends_at, timezone, COALESCE(rrule, ''), exdates
+		FROM group_events WHERE cancelled_at IS NULL AND starts_at <= ?2 AND (rrule IS NOT NULL OR starts_at > ?1)`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var events []EventSeries
+	for rows.Next() {
+		var e EventSeries
+		if err := rows.Scan(&e.ID, &e.StartsAt, &e.EndsAt, &e.Timezone, &e.RRule, &e.ExDates); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+
+	var out []dueOccurrence
+	for _, e := range events {
+		if e.RRule == "" {
+			out = append(out, dueOccurrence{eventID: e.ID, startsAt: e.StartsAt.UTC().Format("2006-01-02 15:04:05")})
+			continue
+		}
+		overrides, err := LoadOccurrenceOverrides(s.DB, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		occs, err := e.Occurrences(overrides, now.Add(time.Second), now.Add(off).Add(time.Second))
+		if err != nil {
+			continue // a rule that no longer parses has no occurrences
+		}
+		for _, occ := range occs {
+			if occ.Override != nil && occ.Override.CancelledAt != nil {
+				continue
+			}
+			out = append(out, dueOccurrence{eventID: e.ID, key: occ.Key, startsAt: occ.StartsAt.UTC().Format("2006-01-02 15:04:05")})
+		}
+	}
+	return out, nil
+}
+
+// remind records the reminder and notifies the attendees in one
+// transaction, so a reminder is never sent twice.
+func (s *EventReminders) remind(ctx context.Context, d dueOccurrence, minutes int) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO group_event_reminders(event_id, offset_minutes, starts_at, occurrence)
+		VALUES(?, ?, ?, ?) ON CONFLICT DO NOTHING`, d.eventID, minutes, d.startsAt, d.key)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	rows, err := tx.Query(`SELECT ger.user_id FROM group_event_responses ger
+		JOIN group_events ge ON ge.id = ger.event_id
+		JOIN groups g ON g.id = ge.group_id
+		WHERE ger.event_id = ? AND ger.occurrence = ? AND ger.response IN ('going', 'maybe')
+		AND (g.owner_user_id = ger.user_id
+			OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ger.user_id))`, d.eventID, d.key)
+	if err != nil {
+		return false, err
+	}
+	var users []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			users = append(users, id)
+		}
+	}
+	rows.Close()
+	for _, userID := range users {
+		if _, err := tx.Exec(`INSERT INTO notifications(id, user_id, type, actor_user_id, subject_id)
+			VALUES(?, ?, 'group_event_reminder', NULL, ?)`, uuid.NewString(), userID, d.eventID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// Run calls SendDue every interval until ctx is cancelled.
+func (s *EventReminders) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(ctx, time.Now()); err != nil {
+			log.Printf("event reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
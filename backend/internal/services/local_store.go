@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// LocalStore keeps media on the local filesystem. Files are content
+// addressed (ab/cd/<sha256><ext>), so identical uploads share one file, and
+// are written to a temporary file and renamed into place so readers never see
+// a partial image.
+type LocalStore struct {
+	Dir     string // root directory
+	BaseURL string // public URL prefix, e.g. "/images/"
+}
+
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create media dir: %w", err)
+	}
+	return &LocalStore{Dir: dir, BaseURL: baseURL}, nil
+}
+
+func (s *LocalStore) Name() string { return "local" }
+
+func (s *LocalStore) Put(ctx context.Context, r io.Reader, opts PutOptions) (*StoredMedia, error) {
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write upload: %w", err)
+	}
+
+	// dimensions and format come from the bytes, not the client's claims
+	f, err := os.Open(tmpName)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("not a supported image: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	key := path.Join(sum[:2], sum[2:4], sum+getFileExtension("image/"+format))
+	if opts.Kind == MediaAttachment {
+		key = PrivateMediaPrefix + key
+	}
+	dst := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		if err := os.Rename(tmpName, dst); err != nil {
+			return nil, fmt.Errorf("store upload: %w", err)
+		}
+	} else {
+		// an identical file exists; make it look fresh so the orphan
+		// collector's grace period covers this upload too
+		now := time.Now()
+		_ = os.Chtimes(dst, now, now)
+	}
+	u := s.URL(key)
+	return &StoredMedia{Key: key, URL: u, SecureURL: u, Width: cfg.Width, Height: cfg.Height, Format: format, Bytes: n}, nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, ok := s.path(key)
+	if !ok {
+		return nil, ErrMediaNotFound
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrMediaNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, ok := s.path(key)
+	if !ok {
+		return ErrMediaNotFound
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List walks Dir. Dot files (uploads still being written) are skipped.
+func (s *LocalStore) List(ctx context.Context, fn func(StoredObject) error) error {
+	return filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != s.Dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed while walking
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		return fn(StoredObject{Key: filepath.ToSlash(rel), Bytes: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+func (s *LocalStore) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
+
+// path maps a key to a file inside Dir, rejecting anything that would
+// escape it.
+func (s *LocalStore) path(key string) (string, bool) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != key || strings.HasPrefix(path.Base(clean), ".") {
+		return "", false
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), true
+}
+
+// ServeKey serves the file stored under key. Keys are content addressed, so
+// a file never changes: the hash doubles as a strong ETag and, unless the
+// caller set its own Cache-Control, clients may cache it indefinitely.
+// Conditional and range requests are handled by http.ServeContent.
+func (s *LocalStore) ServeKey(w http.ResponseWriter, r *http.Request, key string) {
+	p, ok := s.path(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	ext := path.Ext(key)
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("ETag", `"`+strings.TrimSuffix(path.Base(key), ext)+`"`)
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, key, fi.ModTime(), f)
+}
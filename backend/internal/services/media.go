@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"social-network/backend/internal/imaging"
+)
+
+// Media kinds understood by the stores. Cloudinary applies different
+// transformations per kind; the local store only uses it for logging.
+const (
+	MediaAvatar     = "avatar"
+	MediaPostImage  = "post"
+	MediaAttachment = "attachment"
+	MediaGroupImage = "group" // group avatars and covers
+)
+
+// PrivateMediaPrefix starts the keys of media that must only be served after
+// an access check (attachments), never by the public /images/ route.
+const PrivateMediaPrefix = "private/"
+
+var ErrMediaNotFound = errors.New("media not found")
+
+// MediaStore stores uploaded images. Keys are opaque to callers and are what
+// the database records (post_images.path, profiles.avatar_path).
+type MediaStore interface {
+	// Name identifies the backend ("cloudinary", "local"); it is stored next
+	// to each key so assets can be found again after switching backends.
+	Name() string
+	Put(ctx context.Context, r io.Reader, opts PutOptions) (*StoredMedia, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+	// List calls fn for every object the store holds for this app.
+	List(ctx context.Context, fn func(StoredObject) error) error
+}
+
+type PutOptions struct {
+	Kind        string // MediaAvatar or MediaPostImage
+	OwnerID     string // user id for avatars, post id for post images, attachment id, group id
+	ContentType string
+	Variant     string // derived size name; empty for the main image
+}
+
+type StoredMedia struct {
+	Key       string
+	URL       string
+	SecureURL string
+	Width     int
+	Height    int
+	Format    string
+	Bytes     int64
+}
+
+// StoredObject is one object found by MediaStore.List.
+type StoredObject struct {
+	Key     string
+	Bytes   int64
+	ModTime time.Time // last written (or re-used, for shared local files)
+}
+
+// SelectMediaStore picks the backend named by the config ("cloudinary",
+// "local" or "auto"). Auto uses Cloudinary when it is configured and the
+// local disk otherwise, so development needs no network.
+func SelectMediaStore(backend string, cld *CloudinaryService, local *LocalStore) (MediaStore, error) {
+	switch backend {
+	case "cloudinary":
+		if cld == nil {
+			return nil, errors.New("media backend cloudinary selected but cloudinary is not configured")
+		}
+		return cld, nil
+	case "local":
+		return local, nil
+	case "", "auto":
+		if cld != nil {
+			return cld, nil
+		}
+		return local, nil
+	}
+	return nil, errors.New("unknown media backend " + backend)
+}
+
+// StoredImage is a processed upload and its derived sizes, as held by a store.
+type StoredImage struct {
+	Main       *StoredMedia
+	Alternates []*StoredMedia // Main in other formats
+	Variants   map[string]*StoredMedia
+	Blurhash   string
+}
+
+// PutImage stores the output of the imaging pipeline. On error the returned
+// image holds whatever was stored before the failure, for DiscardImage.
+func PutImage(ctx context.Context, store MediaStore, res *imaging.Result, opts PutOptions) (*StoredImage, error) {
+	put := func(enc imaging.Encoded, variant string) (*StoredMedia, error) {
+		o := opts
+		o.ContentType, o.Variant = enc.ContentType, variant
+		return store.Put(ctx, bytes.NewReader(enc.Data), o)
+	}
+	img := &StoredImage{Variants: map[string]*StoredMedia{}, Blurhash: res.Blurhash}
+	main, err := put(res.Main, "")
+	if err != nil {
+		return img, err
+	}
+	img.Main = main
+	for _, alt := range res.Alternates {
+		m, err := put(alt, "alt_"+alt.Format)
+		if err != nil {
+			return img, err
+		}
+		img.Alternates = append(img.Alternates, m)
+	}
+	for _, v := range res.Variants {
+		m, err := put(v, v.Name)
+		if err != nil {
+			return img, err
+		}
+		img.Variants[v.Name] = m
+	}
+	return img, nil
+}
+
+// DiscardImage deletes the stored files of an image whose database rows were
+// never committed. Files that an existing row still uses (identical uploads
+// share local keys) are kept.
+func DiscardImage(ctx context.Context, db *sql.DB, store MediaStore, img *StoredImage) {
+	if img == nil {
+		return
+	}
+	var all []*StoredMedia
+	if img.Main != nil {
+		all = append(all, img.Main)
+	}
+	all = append(all, img.Alternates...)
+	for _, v := range img.Variants {
+		all = append(all, v)
+	}
+	for _, m := range all {
+		if mediaReferenced(db, store.Name(), m.Key) {
+			continue
+		}
+		if err := store.Delete(ctx, m.Key); err != nil && !errors.Is(err, ErrMediaNotFound) {
+			log.Printf("discard media %s: %v", m.Key, err)
+		}
+	}
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// RecordVariants remembers the derived sizes and alternate formats of a
+// stored image so they can be served and deleted along with it. Alternates
+// are recorded under the empty variant name.
+func RecordVariants(db Execer, storage string, img *StoredImage) error {
+	record := func(name string, v *StoredMedia) error {
+		_, err := db.Exec(`INSERT OR REPLACE INTO media_variants(storage, source_key, variant, format, key, width, height)
+			VALUES(?, ?, ?, ?, ?, ?, ?)`, storage, img.Main.Key, name, v.Format, v.Key, v.Width, v.Height)
+		return err
+	}
+	for _, alt := range img.Alternates {
+		if err := record("", alt); err != nil {
+			return err
+		}
+	}
+	for name, v := range img.Variants {
+		if err := record(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImage removes key and its variants from the store unless a row still
+// references it; local keys are content addressed and may be shared.
+func DeleteImage(ctx context.Context, db *sql.DB, store MediaStore, key string) error {
+	if mediaReferenced(db, store.Name(), key) {
+		return nil
+	}
+	rows, err := db.Query("SELECT key FROM media_variants WHERE storage = ? AND source_key = ?", store.Name(), key)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	rows.Close()
+	for _, k := range append(keys, key) {
+		if err := store.Delete(ctx, k); err != nil && !errors.Is(err, ErrMediaNotFound) {
+			log.Printf("delete media %s: %v", k, err)
+		}
+	}
+	_, err = db.Exec("DELETE FROM media_variants WHERE storage = ? AND source_key = ?", store.Name(), key)
+	return err
+}
+
+// mediaReferenced reports whether any row still points at the stored key.
+func mediaReferenced(db *sql.DB, storage, key string) bool {
+	var n int
+	err := db.QueryRow(`SELECT
+		(SELECT COUNT(1) FROM profiles WHERE avatar_path = ?1 AND avatar_storage = ?2) +
+		(SELECT COUNT(1) FROM post_images WHERE path = ?1 AND storage = ?2) +
+		(SELECT COUNT(1) FROM groups WHERE (avatar_path = ?1 AND avatar_storage = ?2) OR (cover_path = ?1 AND cover_storage = ?2)) +
+		(SELECT COUNT(1) FROM attachments WHERE path = ?1 AND storage = ?2) +
+		-- a variant identical to its own source doesn't keep it alive
+		(SELECT COUNT(1) FROM media_variants WHERE key = ?1 AND storage = ?2 AND source_key != ?1)`, key, storage).Scan(&n)
+	// when in doubt, keep the file
+	return err != nil || n > 0
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// MediaGC reconciles the media store with the database: objects no row
+// references any more (replaced avatars and group images, images of deleted posts, uploads
+// that were never used) are deleted. Objects younger than GracePeriod are
+// left alone, because an upload is stored before the row that references it
+// is committed.
+type MediaGC struct {
+	DB          *sql.DB
+	Store       MediaStore
+	GracePeriod time.Duration
+	// DryRun makes Run only log what it would remove.
+	DryRun bool
+}
+
+// GCReport describes one reconciliation.
+type GCReport struct {
+	Storage     string
+	DryRun      bool
+	Scanned     int            // objects listed in the store
+	Orphans     []StoredObject // unreferenced and older than the grace period
+	OrphanBytes int64
+	Deleted     int
+	// Pending attachment uploads older than the grace period that were never
+	// claimed by a message or post; their rows are removed.
+	ExpiredAttachments int
+	// media_variants rows whose original no row references any more.
+	StaleVariants int
+	// Referenced keys the store does not have.
+	Missing []string
+}
+
+// Reconcile compares the store with the database. With dryRun nothing is
+// changed and the report says what would be removed.
+func (g *MediaGC) Reconcile(ctx context.Context, dryRun bool) (*GCReport, error) {
+	storage := g.Store.Name()
+	cutoff := time.Now().Add(-g.GracePeriod).UTC().Format("2006-01-02 15:04:05")
+	report := &GCReport{Storage: storage, DryRun: dryRun}
+
+	err := g.DB.QueryRow(`SELECT COUNT(1) FROM attachments
+		WHERE storage = ? AND subject_id IS NULL AND created_at < ?`, storage, cutoff).Scan(&report.ExpiredAttachments)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun && report.ExpiredAttachments > 0 {
+		if _, err := g.DB.Exec(`DELETE FROM attachments
+			WHERE storage = ? AND subject_id IS NULL AND created_at < ?`, storage, cutoff); err != nil {
+			return nil, err
+		}
+	}
+
+	// originals still in use; expired attachments no longer count
+	referenced := map[string]bool{}
+	if err := collectKeys(g.DB, referenced, `
+		SELECT avatar_path FROM profiles WHERE avatar_storage = ?1 AND avatar_path IS NOT NULL AND avatar_path != ''
+		UNION SELECT path FROM post_images WHERE storage = ?1
+		UNION SELECT avatar_path FROM groups WHERE avatar_storage = ?1 AND avatar_path IS NOT NULL
+		UNION SELECT cover_path FROM groups WHERE cover_storage = ?1 AND cover_path IS NOT NULL
+		UNION SELECT path FROM attachments WHERE storage = ?1 AND NOT (subject_id IS NULL AND created_at < ?2)`,
+		storage, cutoff); err != nil {
+		return nil, err
+	}
+
+	// derived sizes live as long as their original; rows of recent uploads
+	// are kept even before the original's row exists
+	rows, err := g.DB.Query("SELECT source_key, key, created_at < ? FROM media_variants WHERE storage = ?", cutoff, storage)
+	if err != nil {
+		return nil, err
+	}
+	variants := map[string]bool{}
+	stale := map[string]bool{}
+	for rows.Next() {
+		var source, key string
+		var old bool
+		if err := rows.Scan(&source, &key, &old); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if referenced[source] || !old {
+			variants[key] = true
+			continue
+		}
+		stale[source] = true
+		report.StaleVariants++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for k := range variants {
+		referenced[k] = true
+	}
+	if !dryRun {
+		for source := range stale {
+			if _, err := g.DB.Exec("DELETE FROM media_variants WHERE storage = ? AND source_key = ? AND created_at < ?",
+				storage, source, cutoff); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	deadline := time.Now().Add(-g.GracePeriod)
+	err = g.Store.List(ctx, func(obj StoredObject) error {
+		report.Scanned++
+		seen[obj.Key] = true
+		if referenced[obj.Key] || obj.ModTime.After(deadline) {
+			return nil
+		}
+		report.Orphans = append(report.Orphans, obj)
+		report.OrphanBytes += obj.Bytes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for k := range referenced {
+		if !seen[k] {
+			report.Missing = append(report.Missing, k)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, obj := range report.Orphans {
+		// a row may have claimed the key since the snapshot above
+		if mediaReferenced(g.DB, storage, obj.Key) {
+			continue
+		}
+		if err := g.Store.Delete(ctx, obj.Key); err != nil && !errors.Is(err, ErrMediaNotFound) {
+			log.Printf("media gc: delete %s: %v", obj.Key, err)
+			continue
+		}
+		report.Deleted++
+	}
+	return report, nil
+}
+
+// Run reconciles every interval until ctx is cancelled.
+func (g *MediaGC) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := g.Reconcile(ctx, g.DryRun)
+		switch {
+		case err != nil:
+			log.Printf("media gc: %v", err)
+		case report.DryRun && len(report.Orphans) > 0:
+			log.Printf("media gc (%s, dry run): would delete %d of %d objects (%d bytes); run cmd/mediagc to review",
+				report.Storage, len(report.Orphans), report.Scanned, report.OrphanBytes)
+		case report.Deleted > 0 || report.ExpiredAttachments > 0 || report.StaleVariants > 0:
+			log.Printf("media gc (%s): deleted %d of %d objects (%d bytes), %d expired attachments, %d stale variant rows",
+				report.Storage, report.Deleted, report.Scanned, report.OrphanBytes, report.ExpiredAttachments, report.StaleVariants)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectKeys(db *sql.DB, into map[string]bool, query string, args ...any) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return err
+		}
+		into[k] = true
+	}
+	return rows.Err()
+}
@@ -23,14 +23,16 @@ const (
 	maxMessageSize = 512
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from frontend
-		origin := r.Header.Get("Origin")
-		return origin == "http://localhost:5173" || origin == "http://127.0.0.1:5173"
-	},
+// newUpgrader builds an upgrader that only accepts connections from origins
+// the hub was configured to allow.
+func newUpgrader(hub *Hub) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return hub.originAllowed(r.Header.Get("Origin"))
+		},
+	}
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -61,6 +63,33 @@ type Message struct {
 	Content     string `json:"content"`
 	CreatedAt   string `json:"created_at"`
 	ReadAt      string `json:"read_at,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Sender      *UserSummary `json:"sender,omitempty"`
+}
+
+// UserSummary is how a user appears inside other payloads. AvatarURL always
+// resolves to an image: the uploaded avatar, or one generated from the
+// initials when there is none.
+type UserSummary struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname"`
+	AvatarURL   string `json:"avatar_url"`
+	Initials    string `json:"initials"`
+	HasAvatar   bool   `json:"has_avatar"`
+}
+
+// Attachment describes an image attached to a message or group post. URLs
+// point at the access-checked attachments endpoint.
+type Attachment struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	ThumbURL string `json:"thumb_url"`
+	Mime     string `json:"mime"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Blurhash string `json:"blurhash,omitempty"`
 }
 
 // Notification represents a system notification
@@ -130,7 +159,7 @@ func (c *Client) writePump() {
 
 // ServeWS handles websocket requests from the peer.
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID string, groupID string) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := newUpgrader(hub).Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
@@ -27,10 +27,14 @@ type Hub struct {
 
 	// Mutex for thread-safe access
 	mutex sync.RWMutex
+
+	// Decides which Origin headers may open a WebSocket connection
+	originAllowed func(origin string) bool
 }
 
-// NewHub creates a new Hub
-func NewHub() *Hub {
+// NewHub creates a new Hub that accepts WebSocket connections from origins
+// approved by originAllowed.
+func NewHub(originAllowed func(origin string) bool) *Hub {
 	return &Hub{
 		clients:      make(map[*Client]bool),
 		broadcast:    make(chan []byte),
@@ -38,6 +42,8 @@ func NewHub() *Hub {
 		unregister:   make(chan *Client),
 		userClients:  make(map[string][]*Client),
 		groupClients: make(map[string][]*Client),
+
+		originAllowed: originAllowed,
 	}
 }
 
@@ -168,3 +174,48 @@ func (h *Hub) GetGroupClients(groupID string) []*Client {
 	}
 	return []*Client{}
 }
+
+// DisconnectUser closes all of a user's connections, as when they are signed
+// out everywhere.
+func (h *Hub) DisconnectUser(userID string) {
+	h.mutex.RLock()
+	clients := append([]*Client(nil), h.userClients[userID]...)
+	h.mutex.RUnlock()
+	for _, c := range clients {
+		c.conn.Close()
+	}
+}
+
+// LeaveGroup closes userID's connections to the group's chat, as when they
+// are removed from the group. They stop receiving its messages at once.
+func (h *Hub) LeaveGroup(groupID, userID string) {
+	h.closeGroupClients(groupID, func(c *Client) bool { return c.userID == userID })
+}
+
+// CloseGroup closes every connection to the group's chat, as when the group
+// is deleted.
+func (h *Hub) CloseGroup(groupID string) {
+	h.closeGroupClients(groupID, func(*Client) bool { return true })
+}
+
+func (h *Hub) closeGroupClients(groupID string, match func(*Client) bool) {
+	h.mutex.Lock()
+	var kept, gone []*Client
+	for _, c := range h.groupClients[groupID] {
+		if match(c) {
+			gone = append(gone, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		delete(h.groupClients, groupID)
+	} else {
+		h.groupClients[groupID] = kept
+	}
+	h.mutex.Unlock()
+	// the read pumps unregister them once the connections are closed
+	for _, c := range gone {
+		c.conn.Close()
+	}
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialGroup(t *testing.T, srv *httptest.Server, user, group string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?user=" + user + "&group=" + group
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// closedBy reports whether err means the server closed the connection,
+// rather than the read timing out.
+func closedBy(err error) bool {
+	var ne net.Error
+	return err != nil && !(errors.As(err, &ne) && ne.Timeout())
+}
+
+func TestLeaveGroupStopsDelivery(t *testing.T) {
+	hub := NewHub(func(string) bool { return true })
+	go hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(hub, w, r, r.URL.Query().Get("user"), r.URL.Query().Get("group"))
+	}))
+	defer srv.Close()
+
+	alice := dialGroup(t, srv, "alice", "g1")
+	bob := dialGroup(t, srv, "bob", "g1")
+	for deadline := time.Now().Add(2 * time.Second); len(hub.GetGroupClients("g1")) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("clients never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	hub.LeaveGroup("g1", "bob")
+	hub.BroadcastToGroup("g1", []byte("after"))
+
+	_ = alice.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := alice.ReadMessage(); err != nil || string(msg) != "after" {
+		t.Fatalf("alice got %q, %v", msg, err)
+	}
+	_ = bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := bob.ReadMessage(); !closedBy(err) {
+		t.Fatalf("bob got %q, %v; want the connection closed", msg, err)
+	}
+	if n := len(hub.GetGroupClients("g1")); n != 1 {
+		t.Errorf("%d clients left in the group, want 1", n)
+	}
+}
+
+func TestCloseGroup(t *testing.T) {
+	hub := NewHub(func(string) bool { return true })
+	go hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(hub, w, r, r.URL.Query().Get("user"), r.URL.Query().Get("group"))
+	}))
+	defer srv.Close()
+
+	conn := dialGroup(t, srv, "alice", "g1")
+	for deadline := time.Now().Add(2 * time.Second); len(hub.GetGroupClients("g1")) < 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("client never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	hub.CloseGroup("g1")
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !closedBy(err) {
+		t.Fatalf("read: %v; want the connection closed", err)
+	}
+}
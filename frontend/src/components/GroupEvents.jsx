@@ -43,7 +43,9 @@ export default function GroupEvents({ groupId, isMember }) {
       title: formData.get('title'),
       description: formData.get('description'),
       event_date: formData.get('event_date'),
-      location: formData.get('location')
+      timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+      location: formData.get('location'),
+      capacity: Number(formData.get('capacity')) || 0
     };
 
     setCreateLoading(true);
@@ -73,12 +75,12 @@ export default function GroupEvents({ groupId, isMember }) {
     }
   };
 
-  const handleEventResponse = async (eventId, response) => {
+  const handleEventResponse = async (eventId, response, occurrence) => {
     try {
       const res = await fetch(`/api/groups/${groupId}/events/${eventId}/respond`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ response }),
+        body: JSON.stringify({ response, occurrence }),
         credentials: 'include'
       });
 
@@ -86,7 +88,7 @@ export default function GroupEvents({ groupId, isMember }) {
         // Refresh events to get updated response counts
         fetchEvents();
       } else {
-        console.error('Failed to respond to event');
+        setError(await res.text());
       }
     } catch (err) {
       console.error('Error responding to event:', err);
@@ -195,6 +197,17 @@ export default function GroupEvents({ groupId, isMember }) {
                     disabled={createLoading}
                   />
                 </div>
+                <div className="form-group">
+                  <label className="form-label">Capacity</label>
+                  <input
+                    type="number"
+                    name="capacity"
+                    min="0"
+                    className="form-input"
+                    placeholder="No limit"
+                    disabled={createLoading}
+                  />
+                </div>
                 <div className="form-actions">
                   <button
                     type="submit"
@@ -228,7 +241,7 @@ export default function GroupEvents({ groupId, isMember }) {
       ) : (
         <div className="events-list">
           {events.map(event => (
-            <div key={event.id} className="event-card">
+            <div key={`${event.id}-${event.occurrence || ''}`} className="event-card">
               <div className="event-header">
                 <h4 className="event-title">{event.title}</h4>
                 <div className="event-meta">
@@ -264,25 +277,34 @@ export default function GroupEvents({ groupId, isMember }) {
                     <span className="response-icon">❌</span>
                     {event.not_going_count} not going
                   </span>
+                  {event.capacity && (
+                    <span className="response-count">
+                      {event.spots_left} of {event.capacity} spots left
+                      {event.waitlist_count > 0 && `, ${event.waitlist_count} waiting`}
+                    </span>
+                  )}
                 </div>
+                {event.waitlist_position > 0 && (
+                  <p className="text-muted">You are #{event.waitlist_position} on the waitlist</p>
+                )}
                 
                 {isMember && (
                   <div className="response-actions">
                     <button
-                      onClick={() => handleEventResponse(event.id, 'going')}
-                      className="btn btn-success btn-sm"
+                      onClick={() => handleEventResponse(event.id, 'going', event.occurrence)}
+                      className={`btn btn-success btn-sm ${event.my_response === 'going' || event.my_response === 'waitlisted' ? 'active' : ''}`}
                     >
                       Going
                     </button>
                     <button
-                      onClick={() => handleEventResponse(event.id, 'maybe')}
-                      className="btn btn-warning btn-sm"
+                      onClick={() => handleEventResponse(event.id, 'maybe', event.occurrence)}
+                      className={`btn btn-warning btn-sm ${event.my_response === 'maybe' ? 'active' : ''}`}
                     >
                       Maybe
                     </button>
                     <button
-                      onClick={() => handleEventResponse(event.id, 'not_going')}
-                      className="btn btn-outline btn-sm"
+                      onClick={() => handleEventResponse(event.id, 'not_going', event.occurrence)}
+                      className={`btn btn-outline btn-sm ${event.my_response === 'not_going' ? 'active' : ''}`}
                     >
                       Not Going
                     </button>
@@ -111,7 +111,15 @@ export default function Post({ post }) {
     <div className="post">
       <div className="post-header">
         <div className="post-avatar">
-          {getInitials(post.first_name, post.last_name) || '?'}
+          {post.author?.avatar_url ? (
+            <img
+              src={post.author.avatar_url}
+              alt={post.author.display_name}
+              style={{ width: '100%', height: '100%', borderRadius: '50%', objectFit: 'cover' }}
+            />
+          ) : (
+            getInitials(post.first_name, post.last_name) || '?'
+          )}
         </div>
         <div className="post-author">
           <Link
@@ -194,7 +202,15 @@ export default function Post({ post }) {
           {comments.map((comment) => (
             <div key={comment.id} className="comment">
               <div className="comment-avatar">
-                {comment.user_id === 'current_user' ? 'Me' : 'U'}
+                {comment.author?.avatar_url ? (
+                  <img
+                    src={comment.author.avatar_url}
+                    alt={comment.author.display_name}
+                    style={{ width: '100%', height: '100%', borderRadius: '50%', objectFit: 'cover' }}
+                  />
+                ) : (
+                  comment.user_id === 'current_user' ? 'Me' : 'U'
+                )}
               </div>
               <div className="comment-content">
                 <div className="comment-author">
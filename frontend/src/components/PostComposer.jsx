@@ -18,24 +18,6 @@ export default function PostComposer({ onPostCreated }) {
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
 
-  const uploadImage = async (image, postId) => {
-    const formData = new FormData();
-    formData.append('image', image.file);
-    formData.append('post_id', postId);
-
-    const res = await fetch('/api/images/post', {
-      method: 'POST',
-      body: formData,
-      credentials: 'include'
-    });
-
-    if (!res.ok) {
-      throw new Error('Failed to upload image');
-    }
-
-    return await res.json(); // Returns Cloudinary data
-  };
-
   const handleSubmit = async (e) => {
     e.preventDefault();
     if (!text.trim() && images.length === 0) return;
@@ -44,42 +26,22 @@ export default function PostComposer({ onPostCreated }) {
     setError('');
 
     try {
-      // First create the post
+      // The post and its images are created in a single request, so a failed
+      // upload never leaves a post without its images
+      const formData = new FormData();
+      formData.append('text', text.trim());
+      formData.append('privacy', privacy);
+      images.forEach(image => formData.append('images', image.file));
+
       const res = await fetch('/api/posts', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
-          text: text.trim(),
-          privacy: privacy
-        }),
+        body: formData,
         credentials: 'include'
       });
 
       if (res.ok) {
         const newPost = await res.json();
-        
-        // Upload images if any and collect Cloudinary data
-        let uploadedImages = [];
-        if (images.length > 0) {
-          try {
-            console.log('Uploading images for post:', newPost.id, 'Images:', images);
-            const uploadResults = await Promise.all(
-              images.map(image => uploadImage(image, newPost.id))
-            );
-            console.log('Upload results:', uploadResults);
-            uploadedImages = uploadResults.map(result => ({
-              id: result.id,
-              url: result.secure_url || result.url,
-              format: result.format
-            }));
-            console.log('Mapped uploaded images:', uploadedImages);
-          } catch (imgError) {
-            console.error('Image upload failed:', imgError);
-            // Continue even if image upload fails
-          }
-        }
 
-        // Create a post object for the feed with Cloudinary URLs
         const post = {
           id: newPost.id,
           user_id: user.id,
@@ -88,10 +50,9 @@ export default function PostComposer({ onPostCreated }) {
           created_at: new Date().toISOString(),
           first_name: user.first_name,
           last_name: user.last_name,
-          images: uploadedImages
+          images: newPost.images || []
         };
-        
-        console.log('Created post object:', post);
+
         onPostCreated(post);
         setText('');
         setImages([]);
@@ -142,7 +103,7 @@ export default function PostComposer({ onPostCreated }) {
           <button
             type="submit"
             className="btn btn-primary"
-            disabled={loading || !text.trim()}
+            disabled={loading || (!text.trim() && images.length === 0)}
           >
             {loading ? <span className="loading"></span> : 'Post'}
           </button>
@@ -3,6 +3,9 @@ import { createRoot } from 'react-dom/client'
 import './styles/globals.css'
 import './styles/components.css'
 import App from './App.jsx'
+import { installCsrfFetch } from './utils/csrf.js'
+
+installCsrfFetch()
 
 createRoot(document.getElementById('root')).render(
   <StrictMode>
@@ -172,7 +172,7 @@ export default function GroupDetail() {
       const res = await fetch(`/api/groups/${id}/events`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(eventForm),
+        body: JSON.stringify({ ...eventForm, timezone: Intl.DateTimeFormat().resolvedOptions().timeZone }),
         credentials: 'include'
       });
 
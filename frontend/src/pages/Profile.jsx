@@ -243,9 +243,9 @@ export default function Profile() {
       <div className="profile-header">
         <div className="profile-cover">
           <div className="profile-avatar-large">
-            {profile.avatar_path ? (
+            {profile.user?.avatar_url || profile.avatar_path ? (
               <img 
-                src={getAvatarUrl(profile.avatar_path)} 
+                src={profile.user?.avatar_url || getAvatarUrl(profile.avatar_path)} 
                 alt={`${profile.first_name} ${profile.last_name}`}
                 className="w-full h-full"
                 style={{ borderRadius: '50%', objectFit: 'cover' }}
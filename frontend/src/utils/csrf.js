@@ -0,0 +1,41 @@
+// Double-submit CSRF support: the backend sets a readable `csrf_token` cookie
+// and expects it echoed back in the X-CSRF-Token header on every
+// state-changing request. This wraps window.fetch so components don't have
+// to remember to do it.
+
+const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS', 'TRACE'];
+
+function readCsrfCookie() {
+  const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+  return match ? decodeURIComponent(match[1]) : null;
+}
+
+export function installCsrfFetch() {
+  const originalFetch = window.fetch.bind(window);
+  let pending = null;
+
+  const ensureToken = async () => {
+    const existing = readCsrfCookie();
+    if (existing) return existing;
+    if (!pending) {
+      pending = originalFetch('/api/auth/csrf', { credentials: 'include' })
+        .then((res) => (res.ok ? res.json() : {}))
+        .then((data) => readCsrfCookie() || data.csrf_token || null)
+        .finally(() => {
+          pending = null;
+        });
+    }
+    return pending;
+  };
+
+  window.fetch = async (input, init = {}) => {
+    const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+    if (SAFE_METHODS.includes(method)) {
+      return originalFetch(input, init);
+    }
+    const token = await ensureToken();
+    const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+    if (token) headers.set('X-CSRF-Token', token);
+    return originalFetch(input, { ...init, headers });
+  };
+}